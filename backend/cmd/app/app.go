@@ -4,46 +4,96 @@ import (
 	"context"
 	"errors"
 	"example/internal/api"
+	"example/internal/audit"
 	"example/internal/database"
+	"example/internal/dav"
+	"example/internal/drive"
+	"example/internal/events"
+	"example/internal/jobs"
 	"example/internal/middleware"
+	"example/internal/s3"
+	"example/internal/scim"
 	"example/internal/services/mail"
-	"example/internal/services/minio"
+	"example/internal/sftpd"
+	"example/internal/storage"
+	"example/internal/webhook"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 var port = 1323
 
+// s3Port is the port of the S3 gateway, it can be changed with S3_PORT.
+var s3Port = envPort("S3_PORT", 1324)
+
+// sftpPort is the port of the SFTP server, which only runs if SFTP_PORT is
+// set.
+var sftpPort = os.Getenv("SFTP_PORT")
+
+// sftpHostKeyFile is where the SFTP server keeps its host key, it can be
+// changed with SFTP_HOST_KEY_FILE.
+var sftpHostKeyFile = os.Getenv("SFTP_HOST_KEY_FILE")
+
 func main() {
 	// Init database
 	conn := database.NewClient()
 	defer conn.DB.Close()
 
-	// Init minio
-	minioClient, err := minio.New(minio.Config{
-		Host:      os.Getenv("MINIO_HOST"),
-		Port:      os.Getenv("MINIO_PORT"),
-		AccessKey: os.Getenv("MINIO_ACCESS_KEY_ID"),
-		SecretKey: os.Getenv("MINIO_SECRET_ACCESS_KEY"),
-		SSL:       os.Getenv("MINIO_SSL") == "true",
-	})
+	// Init storage, MinIO unless STORAGE_DRIVER selects another driver
+	store, err := storage.New(storage.ConfigFromEnv(), conn)
+	if err != nil {
+		slog.Error("error creating storage", "err", err)
+		os.Exit(1)
+	}
+
+	// Mailer, SMTP unless MAIL_TRANSPORT selects the file or console
+	// transport
+	mailer, err := mail.NewClient(conn)
+	if err != nil {
+		slog.Error("error creating mailer", "err", err)
+		os.Exit(1)
+	}
+
+	// File tree shared by the REST and WebDAV endpoints
+	driveService := drive.New(conn, store)
+
+	// Audit log of file and account activity, pruned after the retention
+	// period
+	auditLog := audit.New(conn)
+
+	// Wakes the event streams when files change, on all replicas
+	hub := events.New(conn)
+	go hub.Run(context.Background())
 
-	// Mailer
-	mailer := mail.NewClient()
+	// Sends the queued webhooks of all organisations
+	webhooks := webhook.New(conn)
+
+	// Background jobs, including the periodic clean ups
+	queue := jobs.New(conn)
 
 	// Init router
 	router := http.NewServeMux()
 	handler := api.NewServer(api.Config{
-		DB:     conn,
-		MinIO:  minioClient,
-		Mailer: &mailer,
+		DB:      conn,
+		Storage: store,
+		Mailer:  &mailer,
+		Drive:   driveService,
+		Audit:   auditLog,
+		Hub:     hub,
+		Webhook: webhooks,
+		Queue:   queue,
 	})
 
+	registerJobs(queue, &mailer, driveService, auditLog, webhooks)
+	go queue.Run(context.Background())
+
 	// Middlewares
 	stack := middleware.CreateStack(
 		middleware.CORS,
+		middleware.ClientInfo,
 		middleware.Authentication,
 	)
 
@@ -51,6 +101,10 @@ func main() {
 	router.HandleFunc("GET /", wrap(handler.RootRoute))
 	router.HandleFunc("GET /healthz", wrap(handler.Healthz))
 
+	// Presigned URLs of the local and memory storage drivers and of encrypted
+	// objects
+	router.Handle("GET /storage", storage.Handler(store))
+
 	// Auth routes
 	router.HandleFunc("POST /one_time_login", wrap(handler.OneTimeLogin))
 	router.HandleFunc("POST /sign_in", wrap(handler.SignIn))
@@ -60,25 +114,130 @@ func main() {
 	// File routes
 	router.HandleFunc("GET /files", wrap(handler.Files))
 	router.HandleFunc("POST /files", wrap(handler.FileUpload))
+	router.HandleFunc("POST /files/archive", handler.FilesArchive)
+	router.HandleFunc("POST /files/extract", handler.FileExtract)
 
 	router.HandleFunc("PATCH /files/{id}", wrap(handler.FilePatch))
 	router.HandleFunc("DELETE /files/{id}", wrap(handler.FileDelete))
+	router.HandleFunc("POST /files/{id}/restore", wrap(handler.FileRestore))
 
 	router.HandleFunc("GET /files/{id}/preview", wrap(handler.FilePreview))
 	router.HandleFunc("GET /files/{id}/download", handler.FileDownload)
+	router.HandleFunc("GET /files/{id}/thumbnail", handler.FileThumbnail)
+	router.HandleFunc("GET /files/{id}/activity", wrap(handler.FileActivity))
+	router.HandleFunc("POST /files/{id}/transfer", wrap(handler.FileTransfer))
+	router.HandleFunc("POST /files/{id}/star", wrap(handler.FileStar))
+	router.HandleFunc("DELETE /files/{id}/star", wrap(handler.FileUnstar))
 
 	// Folder routes
 	router.HandleFunc("GET /folders/{id}", wrap(handler.Folders))
+	router.HandleFunc("GET /folders/{id}/archive", handler.FolderArchive)
+	router.HandleFunc("GET /folders/{id}/activity", wrap(handler.FolderActivity))
+
+	// Views across folders
+	router.HandleFunc("GET /starred", wrap(handler.Starred))
+	router.HandleFunc("GET /recent", wrap(handler.Recent))
+	router.HandleFunc("GET /shared_with_me", wrap(handler.SharedWithMe))
+
+	// Changes feed for sync clients and the event stream of the web app
+	router.HandleFunc("GET /changes", handler.Changes)
+	router.HandleFunc("GET /events", handler.Events)
+
+	// Path routes
+	router.HandleFunc("GET /paths", wrap(handler.Paths))
+
+	// Search routes
+	router.HandleFunc("GET /search", wrap(handler.Search))
 
 	// Shared drive routes
 	router.HandleFunc("GET /shared_drives", wrap(handler.SharedDrives))
 
+	// SCIM token routes
+	router.HandleFunc("GET /scim_tokens", wrap(handler.ScimTokens))
+	router.HandleFunc("POST /scim_tokens", wrap(handler.ScimTokenCreate))
+	router.HandleFunc("DELETE /scim_tokens/{id}", wrap(handler.ScimTokenDelete))
+
+	// API token routes
+	router.HandleFunc("GET /api_tokens", wrap(handler.ApiTokens))
+	router.HandleFunc("POST /api_tokens", wrap(handler.ApiTokenCreate))
+	router.HandleFunc("DELETE /api_tokens/{id}", wrap(handler.ApiTokenDelete))
+
+	// SSH key routes
+	router.HandleFunc("GET /ssh_keys", wrap(handler.SshKeys))
+	router.HandleFunc("POST /ssh_keys", wrap(handler.SshKeyCreate))
+	router.HandleFunc("DELETE /ssh_keys/{id}", wrap(handler.SshKeyDelete))
+
+	// S3 access key routes
+	router.HandleFunc("GET /access_keys", wrap(handler.AccessKeys))
+	router.HandleFunc("POST /access_keys", wrap(handler.AccessKeyCreate))
+	router.HandleFunc("DELETE /access_keys/{id}", wrap(handler.AccessKeyDelete))
+
+	// Audit log routes
+	router.HandleFunc("GET /audit_events", wrap(handler.AuditEvents))
+	router.HandleFunc("GET /audit_events/export", handler.AuditExport)
+
+	// Job routes
+	router.HandleFunc("GET /jobs", wrap(handler.Jobs))
+	router.HandleFunc("GET /jobs/{id}", wrap(handler.Job))
+	router.HandleFunc("POST /jobs/{id}/retry", wrap(handler.JobRetry))
+
+	// Email routes
+	router.HandleFunc("GET /emails", wrap(handler.Emails))
+	router.HandleFunc("GET /emails/{id}", wrap(handler.Email))
+
+	// Webhook routes
+	router.HandleFunc("GET /webhooks", wrap(handler.Webhooks))
+	router.HandleFunc("POST /webhooks", wrap(handler.WebhookCreate))
+	router.HandleFunc("PATCH /webhooks/{id}", wrap(handler.WebhookUpdate))
+	router.HandleFunc("DELETE /webhooks/{id}", wrap(handler.WebhookDelete))
+	router.HandleFunc("GET /webhooks/{id}/deliveries", wrap(handler.WebhookDeliveries))
+	router.HandleFunc("POST /webhooks/{id}/deliveries/{delivery_id}/replay", wrap(handler.WebhookDeliveryReplay))
+
+	// WebDAV, authenticated with an API token
+	router.Handle(dav.Prefix+"/", dav.NewServer(conn, driveService, auditLog))
+
+	// SCIM provisioning, authenticated with an organisation scoped bearer token
+	router.Handle("/scim/v2/", scim.NewServer(conn, auditLog))
+
 	// Server
 	server := http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: stack(router),
 	}
 
+	// The S3 gateway gets its own listener, since buckets are addressed at
+	// the root path and requests are authenticated with SigV4
+	s3Server := http.Server{
+		Addr:    fmt.Sprintf(":%d", s3Port),
+		Handler: middleware.ClientInfo(s3.NewServer(conn, driveService, auditLog)),
+	}
+
+	go func() {
+		slog.Info(fmt.Sprintf("starting s3 gateway on http://localhost:%d", s3Port))
+
+		err := s3Server.ListenAndServe()
+		if err != nil {
+			slog.Error("error starting s3 gateway", "err", err)
+		}
+	}()
+
+	if sftpPort != "" {
+		sftpServer, err := sftpd.NewServer(conn, driveService, auditLog, sftpHostKeyFile)
+		if err != nil {
+			slog.Error("error creating sftp server", "err", err)
+			os.Exit(1)
+		}
+
+		go func() {
+			slog.Info(fmt.Sprintf("starting sftp server on sftp://localhost:%s", sftpPort))
+
+			err := sftpServer.ListenAndServe(":" + sftpPort)
+			if err != nil {
+				slog.Error("error starting sftp server", "err", err)
+			}
+		}()
+	}
+
 	slog.Info(fmt.Sprintf("starting server on http://localhost:%d", port))
 
 	// Start server
@@ -100,6 +259,15 @@ func wrap(handler func(ctx context.Context, r *http.Request) ([]byte, error)) ht
 		case errors.Is(err, api.ErrBadRequest):
 			w.WriteHeader(http.StatusBadRequest)
 			return
+		case errors.Is(err, api.ErrForbidden):
+			w.WriteHeader(http.StatusForbidden)
+			return
+		case errors.Is(err, api.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case errors.Is(err, api.ErrQuotaExceeded):
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return
 		case errors.Is(err, api.ErrInternal):
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -117,3 +285,12 @@ func wrap(handler func(ctx context.Context, r *http.Request) ([]byte, error)) ht
 		}
 	}
 }
+
+// envPort returns the port set in the environment variable or fallback.
+func envPort(name string, fallback int) int {
+	port, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return port
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"example/internal/audit"
+	"example/internal/drive"
+	"example/internal/jobs"
+	"example/internal/services/mail"
+	"example/internal/webhook"
+	"log/slog"
+	"time"
+)
+
+// Periodic jobs of the whole system, they run on one replica at a time.
+var (
+	collectGarbageJob   = jobs.Kind[struct{}]{Name: "drive.collect_garbage"}
+	thumbnailJob        = jobs.Kind[struct{}]{Name: "drive.generate_thumbnails", Timeout: 15 * time.Minute}
+	extractJob          = jobs.Kind[struct{}]{Name: "drive.extract_texts", Timeout: 15 * time.Minute}
+	pruneChangesJob     = jobs.Kind[struct{}]{Name: "drive.prune_changes"}
+	purgeTrashJob       = jobs.Kind[struct{}]{Name: "drive.purge_trash", Timeout: 15 * time.Minute}
+	abortUploadsJob     = jobs.Kind[struct{}]{Name: "drive.abort_uploads", Timeout: 15 * time.Minute}
+	pruneAuditEventsJob = jobs.Kind[struct{}]{Name: "audit.prune"}
+	sendWebhooksJob     = jobs.Kind[struct{}]{Name: "webhook.send"}
+)
+
+// registerJobs registers the handlers of all jobs and schedules the periodic
+// ones.
+func registerJobs(queue *jobs.Queue, mailer *mail.Mailer, driveService *drive.Service, auditLog *audit.Log, webhooks *webhook.Service) {
+	jobs.Handle(queue, mail.SendJob, mailer.Deliver)
+
+	// Deletes blobs of content addressed storage that are no longer used
+	jobs.Handle(queue, collectGarbageJob, func(ctx context.Context, _ struct{}) error {
+		deleted, err := driveService.CollectGarbage(ctx)
+		if deleted > 0 {
+			slog.Info("deleted unreferenced blobs", "count", deleted)
+		}
+		return err
+	})
+	jobs.Every(queue, collectGarbageJob, time.Hour, struct{}{})
+
+	// Creates thumbnails of new and changed images and PDFs
+	jobs.Handle(queue, thumbnailJob, func(ctx context.Context, _ struct{}) error {
+		created, err := driveService.GenerateThumbnails(ctx)
+		if created > 0 {
+			slog.Info("generated thumbnails", "count", created)
+		}
+		return err
+	})
+	jobs.Every(queue, thumbnailJob, time.Minute, struct{}{})
+
+	// Extracts the text of new and changed documents for the search
+	jobs.Handle(queue, extractJob, func(ctx context.Context, _ struct{}) error {
+		extracted, err := driveService.ExtractTexts(ctx)
+		if extracted > 0 {
+			slog.Info("extracted texts", "count", extracted)
+		}
+		return err
+	})
+	jobs.Every(queue, extractJob, time.Minute, struct{}{})
+
+	// Deletes changes and activity after the retention period
+	jobs.Handle(queue, pruneChangesJob, func(ctx context.Context, _ struct{}) error {
+		deleted, err := driveService.PruneChanges(ctx)
+		if deleted > 0 {
+			slog.Info("deleted expired changes", "count", deleted)
+		}
+		return err
+	})
+	jobs.Every(queue, pruneChangesJob, time.Hour, struct{}{})
+
+	// Purges files after they were in the trash for the retention period
+	jobs.Handle(queue, purgeTrashJob, func(ctx context.Context, _ struct{}) error {
+		purged, err := driveService.PurgeTrash(ctx)
+		if purged > 0 {
+			slog.Info("purged trashed files", "count", purged)
+		}
+		return err
+	})
+	jobs.Every(queue, purgeTrashJob, time.Hour, struct{}{})
+
+	// Deletes the parts of multipart uploads that were never completed
+	jobs.Handle(queue, abortUploadsJob, func(ctx context.Context, _ struct{}) error {
+		aborted, err := driveService.AbortStaleUploads(ctx)
+		if aborted > 0 {
+			slog.Info("aborted stale multipart uploads", "count", aborted)
+		}
+		return err
+	})
+	jobs.Every(queue, abortUploadsJob, time.Hour, struct{}{})
+
+	// Deletes audit events after the retention period
+	jobs.Handle(queue, pruneAuditEventsJob, func(ctx context.Context, _ struct{}) error {
+		deleted, err := auditLog.Prune(ctx)
+		if deleted > 0 {
+			slog.Info("deleted expired audit events", "count", deleted)
+		}
+		return err
+	})
+	jobs.Every(queue, pruneAuditEventsJob, time.Hour, struct{}{})
+
+	// Sends the queued webhooks of all organisations
+	jobs.Handle(queue, sendWebhooksJob, func(ctx context.Context, _ struct{}) error {
+		_, err := webhooks.Send(ctx)
+		return err
+	})
+	jobs.Every(queue, sendWebhooksJob, 10*time.Second, struct{}{})
+}
@@ -0,0 +1,76 @@
+// Command jobs lists background jobs and retries dead ones. Without -org it
+// shows the jobs of the whole system, e.g. the periodic clean ups, which
+// admins of organisations can't see.
+package main
+
+import (
+	"context"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/jobs"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func main() {
+	org := flag.String("org", "", "ID of the organisation whose jobs are shown, the system jobs if empty")
+	status := flag.String("status", "", "only show jobs with this status, e.g. dead")
+	kind := flag.String("kind", "", "only show jobs of this kind")
+	limit := flag.Int("limit", 50, "maximum number of jobs shown")
+	retry := flag.String("retry", "", "ID of a dead or pending job to run again right away")
+	flag.Parse()
+
+	conn := database.NewClient()
+	defer conn.DB.Close()
+
+	ctx := context.Background()
+	organisationID := pgtype.Text{String: *org, Valid: *org != ""}
+
+	if *retry != "" {
+		job, err := conn.JobRequeue(ctx, db.JobRequeueParams{ID: *retry, OrganisationID: organisationID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			fmt.Fprintf(os.Stderr, "no dead or pending job %q\n", *retry)
+			os.Exit(1)
+		}
+		if err != nil {
+			slog.Error("error retrying job", "err", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Retrying %s (%s)\n", job.ID, job.Kind)
+		return
+	}
+
+	queue := jobs.New(conn)
+	list, _, err := queue.Jobs(ctx, *org, jobs.Filter{Status: db.JobStatus(*status), Kind: *kind}, *limit, "")
+	if err != nil {
+		slog.Error("error listing jobs", "err", err)
+		os.Exit(1)
+	}
+
+	err = writeText(os.Stdout, list)
+	if err != nil {
+		slog.Error("error writing jobs", "err", err)
+		os.Exit(1)
+	}
+}
+
+func writeText(out io.Writer, list []db.Job) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tKIND\tSTATUS\tATTEMPTS\tRUN AT\tERROR")
+	for _, j := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", j.ID, j.Kind, j.Status, j.Attempts, j.MaxAttempts, j.RunAt.Format(time.RFC3339), j.Error)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,35 @@
+SET statement_timeout = 0;
+
+ALTER TABLE users
+    ADD COLUMN external_id text NULL;
+
+CREATE TABLE groups
+(
+    id              text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text        NOT NULL REFERENCES organisations,
+    name            text        NOT NULL,
+    external_id     text        NULL,
+    created_at      timestamptz NOT NULL             DEFAULT NOW(),
+    deleted_at      timestamptz NULL
+);
+
+CREATE TABLE group_members
+(
+    group_id   text        NOT NULL REFERENCES groups,
+    user_id    text        NOT NULL REFERENCES users,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+-- Bearer tokens used by identity providers to talk to the SCIM endpoint.
+-- Only the SHA-256 hash of the token is stored.
+CREATE TABLE scim_tokens
+(
+    id              text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text        NOT NULL REFERENCES organisations,
+    name            text        NOT NULL,
+    token_hash      text        NOT NULL UNIQUE,
+    last_used_at    timestamptz NULL,
+    created_at      timestamptz NOT NULL             DEFAULT NOW(),
+    deleted_at      timestamptz NULL
+);
@@ -0,0 +1,20 @@
+SET statement_timeout = 0;
+
+-- Personal tokens used by WebDAV clients and scripts, either as a bearer token
+-- or as an app password. Only the SHA-256 hash of the token is stored.
+CREATE TABLE api_tokens
+(
+    id           text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    user_id      text        NOT NULL REFERENCES users,
+    name         text        NOT NULL,
+    token_hash   text        NOT NULL UNIQUE,
+    last_used_at timestamptz NULL,
+    created_at   timestamptz NOT NULL             DEFAULT NOW(),
+    deleted_at   timestamptz NULL
+);
+
+ALTER TABLE file_permissions
+    ADD COLUMN group_id text NULL REFERENCES groups;
+
+CREATE INDEX file_permissions_file_id_idx ON file_permissions (file_id) WHERE deleted_at IS NULL;
+CREATE INDEX files_parent_id_idx ON files (parent_id) WHERE deleted_at IS NULL;
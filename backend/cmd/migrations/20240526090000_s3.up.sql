@@ -0,0 +1,26 @@
+SET statement_timeout = 0;
+
+-- Credentials for the S3 gateway. SigV4 signatures are HMACs over the secret,
+-- so unlike api_tokens the secret has to be kept in plain text.
+CREATE TABLE access_keys
+(
+    id                text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    user_id           text        NOT NULL REFERENCES users,
+    name              text        NOT NULL,
+    access_key_id     text        NOT NULL UNIQUE,
+    secret_access_key text        NOT NULL,
+    last_used_at      timestamptz NULL,
+    created_at        timestamptz NOT NULL             DEFAULT NOW(),
+    deleted_at        timestamptz NULL
+);
+
+-- Multipart uploads in progress. The parts are stored in MinIO until the
+-- upload is completed or aborted.
+CREATE TABLE multipart_uploads
+(
+    id         text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    user_id    text        NOT NULL REFERENCES users,
+    bucket_id  text        NOT NULL REFERENCES files,
+    key        text        NOT NULL,
+    created_at timestamptz NOT NULL             DEFAULT NOW()
+);
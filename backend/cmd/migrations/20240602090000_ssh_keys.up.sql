@@ -0,0 +1,17 @@
+SET statement_timeout = 0;
+
+-- Public keys used to authenticate at the SFTP server. The SHA-256
+-- fingerprint identifies the key during the handshake.
+CREATE TABLE ssh_keys
+(
+    id           text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    user_id      text        NOT NULL REFERENCES users,
+    name         text        NOT NULL,
+    public_key   text        NOT NULL,
+    fingerprint  text        NOT NULL,
+    last_used_at timestamptz NULL,
+    created_at   timestamptz NOT NULL             DEFAULT NOW(),
+    deleted_at   timestamptz NULL
+);
+
+CREATE UNIQUE INDEX ssh_keys_fingerprint_idx ON ssh_keys (fingerprint) WHERE deleted_at IS NULL;
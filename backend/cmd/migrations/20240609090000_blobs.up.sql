@@ -0,0 +1,19 @@
+SET statement_timeout = 0;
+
+-- Content addressed objects, keyed by the SHA-256 of their contents. Files
+-- referencing the same contents share a blob; it is garbage collected once
+-- ref_count drops to zero.
+CREATE TABLE blobs
+(
+    hash       text        NOT NULL PRIMARY KEY,
+    size       bigint      NOT NULL,
+    ref_count  bigint      NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX blobs_unreferenced_idx ON blobs (updated_at) WHERE ref_count = 0;
+
+-- Files without a blob keep their contents in the object named by their ID.
+ALTER TABLE files
+    ADD COLUMN blob_hash text NULL REFERENCES blobs;
@@ -0,0 +1,12 @@
+SET statement_timeout = 0;
+
+-- Checksums of the contents, computed while uploading. md5 matches the ETag
+-- S3 clients expect. The scrubber re-reads the objects and sets corrupted_at
+-- if they don't match anymore.
+ALTER TABLE files
+    ADD COLUMN sha256       text        NULL,
+    ADD COLUMN md5          text        NULL,
+    ADD COLUMN scrubbed_at  timestamptz NULL,
+    ADD COLUMN corrupted_at timestamptz NULL;
+
+CREATE INDEX files_scrubbed_at_idx ON files (scrubbed_at NULLS FIRST) WHERE is_folder IS FALSE AND deleted_at IS NULL;
@@ -0,0 +1,14 @@
+SET statement_timeout = 0;
+
+-- Data keys of encrypted objects. Each object is encrypted with its own data
+-- key, which is stored wrapped with the key encryption key (kek_id) of the
+-- organisation. Rotating the key encryption key only re-wraps the data keys.
+CREATE TABLE data_keys
+(
+    id              text        NOT NULL PRIMARY KEY,
+    organisation_id text        NOT NULL REFERENCES organisations,
+    kek_id          text        NOT NULL,
+    wrapped_key     bytea       NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT NOW(),
+    rotated_at      timestamptz NULL
+);
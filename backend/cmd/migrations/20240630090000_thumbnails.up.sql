@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+
+-- Thumbnails are generated in the background and stored as derived objects.
+-- thumbnailed_at is reset whenever the contents change; has_thumbnail is
+-- false for files whose type has no thumbnails.
+ALTER TABLE files
+    ADD COLUMN thumbnailed_at timestamptz NULL,
+    ADD COLUMN has_thumbnail  boolean     NOT NULL DEFAULT FALSE;
+
+CREATE INDEX files_unthumbnailed_idx ON files (created_at) WHERE thumbnailed_at IS NULL AND is_folder IS FALSE AND deleted_at IS NULL;
@@ -0,0 +1,37 @@
+SET statement_timeout = 0;
+
+-- Full-text search over names and the text extracted from contents. Words are
+-- stemmed with both the English and the German configuration, as documents of
+-- either language are stored side by side; simple keeps numbers and words
+-- neither knows. Separators are removed from names first, otherwise
+-- "report_2024.pdf" is parsed as a single host name.
+CREATE FUNCTION file_name_tsvector(name text) RETURNS tsvector
+    LANGUAGE sql
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT setweight(to_tsvector('simple', translate(name, '._-', '   ')) ||
+                 to_tsvector('english', translate(name, '._-', '   ')) ||
+                 to_tsvector('german', translate(name, '._-', '   ')), 'A')
+$$;
+
+CREATE INDEX files_name_search_idx ON files USING gin (file_name_tsvector(name)) WHERE deleted_at IS NULL;
+
+-- The text of documents, extracted in the background. extracted_at is reset
+-- whenever the contents change.
+ALTER TABLE files
+    ADD COLUMN extracted_at timestamptz NULL;
+
+CREATE INDEX files_unextracted_idx ON files (created_at) WHERE extracted_at IS NULL AND is_folder IS FALSE AND deleted_at IS NULL;
+
+CREATE TABLE file_texts
+(
+    file_id       text        NOT NULL PRIMARY KEY REFERENCES files,
+    content       text        NOT NULL,
+    search_vector tsvector    NOT NULL GENERATED ALWAYS AS (setweight(to_tsvector('english', content), 'B') ||
+                                                            setweight(to_tsvector('german', content), 'B')) STORED,
+    created_at    timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX file_texts_search_idx ON file_texts USING gin (search_vector);
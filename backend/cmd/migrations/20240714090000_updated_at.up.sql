@@ -0,0 +1,16 @@
+SET statement_timeout = 0;
+
+-- updated_at is the time the contents, the name or the location of a file
+-- last changed. Listings can be sorted by it.
+ALTER TABLE files
+    ADD COLUMN updated_at timestamptz NULL;
+
+UPDATE files
+SET updated_at = created_at;
+
+ALTER TABLE files
+    ALTER COLUMN updated_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+-- Listings are sorted by folders first, then by the chosen column
+CREATE INDEX files_parent_name_idx ON files (parent_id, is_folder DESC, name, id) WHERE deleted_at IS NULL;
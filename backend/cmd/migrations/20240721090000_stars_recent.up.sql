@@ -0,0 +1,31 @@
+SET statement_timeout = 0;
+
+-- Files starred by a user.
+CREATE TABLE file_stars
+(
+    user_id    text        NOT NULL REFERENCES users,
+    file_id    text        NOT NULL REFERENCES files,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, file_id)
+);
+
+CREATE INDEX file_stars_recent_idx ON file_stars (user_id, created_at DESC, file_id DESC);
+
+-- The last time a user opened, downloaded or edited a file, for the recent
+-- files. Only the latest access per file is kept.
+CREATE TYPE file_access_kind AS ENUM ('open', 'download', 'edit');
+
+CREATE TABLE file_accesses
+(
+    user_id     text             NOT NULL REFERENCES users,
+    file_id     text             NOT NULL REFERENCES files,
+    kind        file_access_kind NOT NULL,
+    accessed_at timestamptz      NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, file_id)
+);
+
+CREATE INDEX file_accesses_recent_idx ON file_accesses (user_id, accessed_at DESC, file_id DESC);
+
+-- Files shared with a user are found by their permissions
+CREATE INDEX file_permissions_user_id_idx ON file_permissions (user_id) WHERE deleted_at IS NULL;
+CREATE INDEX file_permissions_group_id_idx ON file_permissions (group_id) WHERE deleted_at IS NULL;
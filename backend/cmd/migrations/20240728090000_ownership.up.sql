@@ -0,0 +1,21 @@
+SET statement_timeout = 0;
+
+-- Every file has a creator and an owner. Files at the top level of the
+-- personal root ("My Files") belong to their owner and are only visible to
+-- them and the users they are shared with.
+ALTER TABLE files
+    ADD COLUMN owner_id   text NULL REFERENCES users,
+    ADD COLUMN created_by text NULL REFERENCES users;
+
+-- Existing files are assigned to the owner of their organisation, or to its
+-- first admin or user if it has none
+UPDATE files f
+SET owner_id   = o.user_id,
+    created_by = o.user_id
+FROM (SELECT DISTINCT ON (organisation_id) organisation_id, id AS user_id
+      FROM users
+      WHERE deleted_at IS NULL
+      ORDER BY organisation_id, CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, created_at) o
+WHERE o.organisation_id = f.organisation_id;
+
+CREATE INDEX files_owner_root_idx ON files (owner_id, name) WHERE parent_id IS NULL AND shared_drive IS FALSE AND deleted_at IS NULL;
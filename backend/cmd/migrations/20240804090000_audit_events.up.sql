@@ -0,0 +1,42 @@
+SET statement_timeout = 0;
+
+-- Audit log of file and account activity. Events are only ever inserted,
+-- and deleted once they are older than the retention period.
+CREATE TYPE audit_action AS ENUM ('upload', 'download', 'preview', 'rename', 'move', 'delete', 'share', 'transfer', 'login', 'role_change');
+
+CREATE TABLE audit_events
+(
+    id              text         NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text         NOT NULL REFERENCES organisations,
+    -- user_id is the actor
+    user_id         text         NULL REFERENCES users,
+    action          audit_action NOT NULL,
+    -- The target is a file or a user. target_name is its name at the time
+    -- of the event.
+    file_id         text         NULL REFERENCES files,
+    target_user_id  text         NULL REFERENCES users,
+    target_name     text         NOT NULL DEFAULT '',
+    -- details depend on the action, e.g. the old and new name of a rename
+    details         jsonb        NOT NULL DEFAULT '{}',
+    ip_address      text         NULL,
+    user_agent      text         NOT NULL DEFAULT '',
+    created_at      timestamptz  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_events_organisation_idx ON audit_events (organisation_id, created_at DESC, id DESC);
+CREATE INDEX audit_events_file_id_idx ON audit_events (file_id) WHERE file_id IS NOT NULL;
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION audit_events_immutable() RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit events can not be changed';
+END;
+$$;
+
+CREATE TRIGGER audit_events_immutable
+    BEFORE UPDATE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_immutable();
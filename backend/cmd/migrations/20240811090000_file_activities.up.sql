@@ -0,0 +1,19 @@
+SET statement_timeout = 0;
+
+-- Changes to files shown in their activity feed, e.g. renames or new
+-- versions. user_id is who made the change.
+CREATE TYPE file_activity_action AS ENUM ('create', 'version', 'rename', 'move', 'delete', 'transfer');
+
+CREATE TABLE file_activities
+(
+    id              text                 NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text                 NOT NULL REFERENCES organisations,
+    file_id         text                 NOT NULL REFERENCES files,
+    user_id         text                 NULL REFERENCES users,
+    action          file_activity_action NOT NULL,
+    -- details depend on the action, e.g. the old and new name of a rename
+    details         jsonb                NOT NULL DEFAULT '{}',
+    created_at      timestamptz          NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX file_activities_file_id_idx ON file_activities (file_id, created_at DESC, id DESC);
@@ -0,0 +1,34 @@
+SET statement_timeout = 0;
+
+ALTER TYPE file_activity_action ADD VALUE 'restore';
+
+-- The last change number of an organisation. Changes lock the row until they
+-- commit, so they become visible in the order of their numbers. Changes up to
+-- pruned_seq have been deleted.
+CREATE TABLE change_sequences
+(
+    organisation_id text   NOT NULL PRIMARY KEY REFERENCES organisations,
+    seq             bigint NOT NULL DEFAULT 0,
+    pruned_seq      bigint NOT NULL DEFAULT 0
+);
+
+-- Every activity of a file is a change of the changes feed
+ALTER TABLE file_activities
+    ADD COLUMN seq bigint NULL;
+
+UPDATE file_activities a
+SET seq = n.seq
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY organisation_id ORDER BY created_at, id) AS seq
+      FROM file_activities) n
+WHERE n.id = a.id;
+
+INSERT INTO change_sequences (organisation_id, seq)
+SELECT organisation_id, MAX(seq)
+FROM file_activities
+GROUP BY organisation_id;
+
+ALTER TABLE file_activities
+    ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX file_activities_seq_idx ON file_activities (organisation_id, seq);
+CREATE INDEX file_activities_created_at_idx ON file_activities (created_at);
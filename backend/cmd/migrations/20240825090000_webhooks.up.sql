@@ -0,0 +1,45 @@
+SET statement_timeout = 0;
+
+-- Endpoints of an organisation that are sent its events. The secret signs
+-- the deliveries. Endpoints are disabled after failure_count consecutive
+-- failed attempts.
+CREATE TABLE webhooks
+(
+    id              text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text        NOT NULL REFERENCES organisations,
+    url             text        NOT NULL,
+    secret          text        NOT NULL,
+    event_types     text[]      NOT NULL,
+    failure_count   int         NOT NULL DEFAULT 0,
+    disabled_at     timestamptz NULL,
+    created_at      timestamptz NOT NULL DEFAULT NOW(),
+    deleted_at      timestamptz NULL
+);
+
+CREATE INDEX webhooks_organisation_idx ON webhooks (organisation_id) WHERE deleted_at IS NULL;
+
+CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'succeeded', 'failed');
+
+-- Deliveries are the queue of the sender and the log of the endpoint. A
+-- replay is a new delivery of the same event.
+CREATE TABLE webhook_deliveries
+(
+    id              text                    NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text                    NOT NULL REFERENCES organisations,
+    webhook_id      text                    NOT NULL REFERENCES webhooks,
+    event_id        text                    NOT NULL,
+    event_type      text                    NOT NULL,
+    payload         jsonb                   NOT NULL,
+    status          webhook_delivery_status NOT NULL DEFAULT 'pending',
+    attempts        int                     NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz             NOT NULL DEFAULT NOW(),
+    -- The response of the last attempt, error is set if there was none
+    response_status int                     NULL,
+    response_body   text                    NOT NULL DEFAULT '',
+    error           text                    NOT NULL DEFAULT '',
+    created_at      timestamptz             NOT NULL DEFAULT NOW(),
+    delivered_at    timestamptz             NULL
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC, id DESC);
@@ -0,0 +1,33 @@
+SET statement_timeout = 0;
+
+-- Background jobs. Workers take pending jobs with FOR UPDATE SKIP LOCKED, so
+-- that every job runs once even with several replicas. Jobs that failed
+-- max_attempts times are dead until an admin retries them.
+CREATE TYPE job_status AS ENUM ('pending', 'running', 'succeeded', 'dead');
+
+CREATE TABLE jobs
+(
+    id              text        NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    -- organisation_id is empty for jobs of the whole system, e.g. periodic
+    -- clean ups
+    organisation_id text        NULL REFERENCES organisations,
+    kind            text        NOT NULL,
+    payload         jsonb       NOT NULL DEFAULT '{}',
+    status          job_status  NOT NULL DEFAULT 'pending',
+    attempts        int         NOT NULL DEFAULT 0,
+    max_attempts    int         NOT NULL,
+    run_at          timestamptz NOT NULL DEFAULT NOW(),
+    -- unique_key deduplicates jobs, e.g. the runs of a periodic job
+    -- scheduled by every replica
+    unique_key      text        NULL UNIQUE,
+    -- error is the one of the last failed attempt
+    error           text        NOT NULL DEFAULT '',
+    locked_at       timestamptz NULL,
+    created_at      timestamptz NOT NULL DEFAULT NOW(),
+    finished_at     timestamptz NULL
+);
+
+CREATE INDEX jobs_pending_idx ON jobs (kind, run_at) WHERE status = 'pending';
+CREATE INDEX jobs_running_idx ON jobs (kind, locked_at) WHERE status = 'running';
+CREATE INDEX jobs_finished_idx ON jobs (finished_at) WHERE finished_at IS NOT NULL;
+CREATE INDEX jobs_organisation_idx ON jobs (organisation_id, created_at DESC, id DESC);
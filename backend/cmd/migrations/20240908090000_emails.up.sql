@@ -0,0 +1,25 @@
+SET statement_timeout = 0;
+
+-- Outbox of emails. Emails are written in the transaction of the change that
+-- sends them and delivered by the mail.send job, so that they are neither
+-- lost nor sent for changes that are rolled back.
+CREATE TYPE email_status AS ENUM ('pending', 'sent', 'failed');
+
+CREATE TABLE emails
+(
+    id              text         NOT NULL PRIMARY KEY DEFAULT nanoid(),
+    organisation_id text         NOT NULL REFERENCES organisations,
+    -- template is the kind of email, e.g. login_link
+    template        text         NOT NULL,
+    to_address      text         NOT NULL,
+    subject         text         NOT NULL,
+    body            text         NOT NULL,
+    status          email_status NOT NULL DEFAULT 'pending',
+    attempts        int          NOT NULL DEFAULT 0,
+    -- error is the one of the last failed attempt
+    error           text         NOT NULL DEFAULT '',
+    created_at      timestamptz  NOT NULL DEFAULT NOW(),
+    sent_at         timestamptz  NULL
+);
+
+CREATE INDEX emails_organisation_idx ON emails (organisation_id, created_at DESC, id DESC);
@@ -0,0 +1,9 @@
+SET statement_timeout = 0;
+
+-- Files are purged after they were in the trash for the retention period.
+-- Their contents are released, the rows stay for the activity and the audit
+-- log.
+ALTER TABLE files
+    ADD COLUMN purged_at timestamptz NULL;
+
+CREATE INDEX files_trashed_idx ON files (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+
+-- Restores, created credentials and the changes identity providers make to
+-- users through SCIM are recorded as well.
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'restore';
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'credential_create';
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'user_create';
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'user_update';
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'user_deactivate';
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'user_reactivate';
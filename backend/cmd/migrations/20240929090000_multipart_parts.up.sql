@@ -0,0 +1,14 @@
+SET statement_timeout = 0;
+
+-- Sizes of the uploaded parts of multipart uploads. They count against the
+-- quota of the organisation until the upload is completed or aborted.
+CREATE TABLE multipart_parts
+(
+    upload_id       text    NOT NULL REFERENCES multipart_uploads ON DELETE CASCADE,
+    number          integer NOT NULL,
+    organisation_id text    NOT NULL REFERENCES organisations,
+    size            bigint  NOT NULL,
+    PRIMARY KEY (upload_id, number)
+);
+
+CREATE INDEX multipart_parts_organisation_idx ON multipart_parts (organisation_id);
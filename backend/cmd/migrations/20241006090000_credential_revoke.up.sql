@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+
+-- Revoked credentials are recorded like created ones.
+ALTER TYPE audit_action ADD VALUE IF NOT EXISTS 'credential_revoke';
@@ -0,0 +1,89 @@
+// Command reconcile compares the objects in the storage with the files table.
+// It reports objects no file references and files whose contents are
+// missing. Nothing is changed unless -fix is given.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database"
+	"example/internal/drive"
+	"example/internal/storage"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "delete orphaned objects and trash files with missing contents")
+	format := flag.String("format", "text", "output format, text or json")
+	minAge := flag.Duration("min-age", 24*time.Hour, "skip objects and files changed more recently")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	conn := database.NewClient()
+	defer conn.DB.Close()
+
+	store, err := storage.New(storage.ConfigFromEnv(), conn)
+	if err != nil {
+		slog.Error("error creating storage", "err", err)
+		os.Exit(1)
+	}
+
+	service := drive.New(conn, store)
+
+	report, err := service.Reconcile(context.Background(), drive.ReconcileOptions{Fix: *fix, MinAge: *minAge})
+	if err != nil {
+		slog.Error("error reconciling storage", "err", err)
+		os.Exit(1)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeText(os.Stdout, report)
+	}
+	if err != nil {
+		slog.Error("error writing report", "err", err)
+		os.Exit(1)
+	}
+}
+
+func writeText(out io.Writer, report drive.ReconcileReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	mode := "fix"
+	if report.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "Checked %d objects and %d files (%s)\n\n", report.ObjectsChecked, report.FilesChecked, mode)
+
+	fmt.Fprintf(w, "Orphaned objects: %d\n", len(report.OrphanedObjects))
+	if len(report.OrphanedObjects) > 0 {
+		fmt.Fprintln(w, "KEY\tSIZE\tLAST MODIFIED\tFIXED")
+		for _, o := range report.OrphanedObjects {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%t\n", o.Key, o.Size, o.LastModified.Format(time.RFC3339), o.Fixed)
+		}
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Files with missing objects: %d\n", len(report.MissingObjects))
+	if len(report.MissingObjects) > 0 {
+		fmt.Fprintln(w, "FILE\tORGANISATION\tNAME\tKEY\tTRASHED\tFIXED")
+		for _, m := range report.MissingObjects {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%t\n", m.FileID, m.OrganisationID, m.Name, m.Key, m.Trashed, m.Fixed)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,37 @@
+// Command rotate-keys re-wraps the data keys of encrypted objects with the
+// current key encryption key of their organisation, e.g. after a new master
+// key was made current in STORAGE_KEYRING. The contents aren't re-encrypted.
+package main
+
+import (
+	"context"
+	"example/internal/database"
+	"example/internal/storage"
+	"log/slog"
+	"os"
+)
+
+func main() {
+	conn := database.NewClient()
+	defer conn.DB.Close()
+
+	store, err := storage.New(storage.ConfigFromEnv(), conn)
+	if err != nil {
+		slog.Error("error creating storage", "err", err)
+		os.Exit(1)
+	}
+
+	encrypted, ok := store.(*storage.Encrypted)
+	if !ok {
+		slog.Error("encryption is not enabled, STORAGE_KEYRING is not set")
+		os.Exit(1)
+	}
+
+	rotated, err := encrypted.Rotate(context.Background())
+	if err != nil {
+		slog.Error("error rotating data keys", "rotated", rotated, "err", err)
+		os.Exit(1)
+	}
+
+	slog.Info("rotated data keys", "rotated", rotated)
+}
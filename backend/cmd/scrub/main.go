@@ -0,0 +1,61 @@
+// Command scrub re-reads file contents from the storage and flags files whose
+// checksums don't match anymore. It checks the files verified longest ago,
+// either once (e.g. from cron) or every -interval.
+package main
+
+import (
+	"context"
+	"example/internal/database"
+	"example/internal/drive"
+	"example/internal/storage"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+)
+
+func main() {
+	interval := flag.Duration("interval", 0, "run every interval instead of once")
+	age := flag.Duration("age", 30*24*time.Hour, "re-check files verified longer ago than this")
+	limit := flag.Int("limit", 1000, "maximum number of files checked per run")
+	flag.Parse()
+
+	conn := database.NewClient()
+	defer conn.DB.Close()
+
+	store, err := storage.New(storage.ConfigFromEnv(), conn)
+	if err != nil {
+		slog.Error("error creating storage", "err", err)
+		os.Exit(1)
+	}
+
+	service := drive.New(conn, store)
+	ctx := context.Background()
+
+	if *interval == 0 {
+		result, err := scrub(ctx, service, *age, int32(*limit))
+		if err != nil {
+			os.Exit(1)
+		}
+		if len(result.Corrupted) > 0 {
+			os.Exit(2)
+		}
+		return
+	}
+
+	for {
+		_, _ = scrub(ctx, service, *age, int32(*limit))
+		time.Sleep(*interval)
+	}
+}
+
+func scrub(ctx context.Context, service *drive.Service, age time.Duration, limit int32) (drive.ScrubResult, error) {
+	result, err := service.Scrub(ctx, time.Now().Add(-age), limit)
+	if err != nil {
+		slog.Error("error scrubbing files", "checked", result.Checked, "err", err)
+		return result, err
+	}
+
+	slog.Info("scrubbed files", "checked", result.Checked, "corrupted", len(result.Corrupted))
+	return result, nil
+}
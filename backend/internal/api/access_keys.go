@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"net/http"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+type AccessKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	AccessKeyID string     `json:"access_key_id"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type AccessKeysResponse struct {
+	Data []AccessKey `json:"data"`
+}
+
+type AccessKeyCreateResponse struct {
+	Data            AccessKey `json:"data"`
+	SecretAccessKey string    `json:"secret_access_key"`
+}
+
+func toAccessKey(k db.AccessKey) AccessKey {
+	key := AccessKey{
+		ID:          k.ID,
+		Name:        k.Name,
+		AccessKeyID: k.AccessKeyID,
+		CreatedAt:   k.CreatedAt,
+	}
+	if k.LastUsedAt.Valid {
+		key.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return key
+}
+
+func (s *Config) AccessKeys(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	keys, err := s.DB.AccessKeyFindAll(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := AccessKeysResponse{Data: make([]AccessKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Data = append(resp.Data, toAccessKey(k))
+	}
+
+	return json.Marshal(resp)
+}
+
+// AccessKeyCreate creates credentials for the S3 gateway. The secret is only
+// returned once.
+func (s *Config) AccessKeyCreate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		return nil, ErrBadRequest
+	}
+
+	// Same format as AWS access keys, some clients validate them
+	accessKeyID, err := gonanoid.Generate("ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", 20)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	secret := gonanoid.Must(40)
+
+	created, err := s.DB.AccessKeyCreate(ctx, db.AccessKeyCreateParams{
+		Name:            name,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secret,
+		UserID:          user.ID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	s.Audit.Record(ctx, user, audit.CredentialEvent("access_key", created.ID, created.Name))
+	return json.Marshal(AccessKeyCreateResponse{
+		Data:            toAccessKey(created),
+		SecretAccessKey: secret,
+	})
+}
+
+func (s *Config) AccessKeyDelete(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	err := s.DB.AccessKeyRevoke(ctx, db.AccessKeyRevokeParams{
+		ID:     r.PathValue("id"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ActivityUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ActivityFile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Activity struct {
+	Action db.FileActivityAction `json:"action"`
+	// User is null if the user doesn't exist anymore.
+	User  *ActivityUser  `json:"user"`
+	Files []ActivityFile `json:"files"`
+	// Count is the number of grouped events.
+	Count   int               `json:"count"`
+	Details map[string]string `json:"details"`
+	// Summary describes the activity in a sentence, e.g. "Anna Schmidt
+	// renamed Notes.txt from Draft.txt".
+	Summary   string    `json:"summary"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+type ActivityResponse struct {
+	Data       []Activity `json:"data"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+func toActivity(a drive.Activity) Activity {
+	activity := Activity{
+		Action:    a.Action,
+		Files:     make([]ActivityFile, 0, len(a.Files)),
+		Count:     a.Count,
+		Details:   a.Details,
+		Summary:   activitySummary(a),
+		StartedAt: a.StartedAt,
+		EndedAt:   a.EndedAt,
+	}
+	if a.UserID != "" {
+		activity.User = &ActivityUser{ID: a.UserID, Name: a.UserName}
+	}
+	for _, f := range a.Files {
+		activity.Files = append(activity.Files, ActivityFile{ID: f.ID, Name: f.Name})
+	}
+	return activity
+}
+
+// activitySummary describes an activity in an English sentence.
+func activitySummary(a drive.Activity) string {
+	user := a.UserName
+	if user == "" {
+		user = "Someone"
+	}
+
+	target := a.Files[0].Name
+	if len(a.Files) > 1 {
+		target = fmt.Sprintf("%d files", len(a.Files))
+	}
+
+	switch a.Action {
+	case drive.ActivityCreate:
+		return fmt.Sprintf("%s created %s", user, target)
+	case drive.ActivityVersion:
+		if a.Count > 1 && len(a.Files) == 1 {
+			return fmt.Sprintf("%s uploaded %d new versions of %s", user, a.Count, target)
+		}
+		if len(a.Files) > 1 {
+			return fmt.Sprintf("%s uploaded new versions of %s", user, target)
+		}
+		return fmt.Sprintf("%s uploaded a new version of %s", user, target)
+	case drive.ActivityRename:
+		if len(a.Files) == 1 {
+			return fmt.Sprintf("%s renamed %s to %s", user, a.Details["from"], a.Details["to"])
+		}
+		return fmt.Sprintf("%s renamed %s", user, target)
+	case drive.ActivityMove:
+		if len(a.Files) == 1 {
+			return fmt.Sprintf("%s moved %s from %s to %s", user, target, a.Details["from"], a.Details["to"])
+		}
+		return fmt.Sprintf("%s moved %s to %s", user, target, a.Details["to"])
+	case drive.ActivityDelete:
+		return fmt.Sprintf("%s deleted %s", user, target)
+	case drive.ActivityRestore:
+		return fmt.Sprintf("%s restored %s", user, target)
+	case drive.ActivityTransfer:
+		return fmt.Sprintf("%s transferred %s to %s", user, target, a.Details["to_name"])
+	default:
+		return fmt.Sprintf("%s changed %s", user, target)
+	}
+}
+
+// activity responds with a page of the activity feed of the file or folder
+// id, selected by the query parameters limit and cursor.
+func (s *Config) activity(ctx context.Context, r *http.Request, descendants bool) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	limit, err := parseInt(r.URL.Query(), "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	page, err := s.Drive.Activity(ctx, user, node, drive.ActivityOptions{
+		Descendants: descendants,
+		Limit:       limit,
+		Cursor:      r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	resp := ActivityResponse{Data: make([]Activity, 0, len(page.Activities)), NextCursor: page.NextCursor}
+	for _, a := range page.Activities {
+		resp.Data = append(resp.Data, toActivity(a))
+	}
+
+	return json.Marshal(resp)
+}
+
+// FileActivity lists the changes of a file, the latest first.
+func (s *Config) FileActivity(ctx context.Context, r *http.Request) ([]byte, error) {
+	return s.activity(ctx, r, false)
+}
+
+// FolderActivity lists the changes of a folder and all files in it, the
+// latest first.
+func (s *Config) FolderActivity(ctx context.Context, r *http.Request) ([]byte, error) {
+	return s.activity(ctx, r, true)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"net/http"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+type ApiToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ApiTokensResponse struct {
+	Data []ApiToken `json:"data"`
+}
+
+type ApiTokenCreateResponse struct {
+	Data  ApiToken `json:"data"`
+	Token string   `json:"token"`
+}
+
+func toApiToken(t db.ApiToken) ApiToken {
+	token := ApiToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.LastUsedAt.Valid {
+		token.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return token
+}
+
+func (s *Config) ApiTokens(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	tokens, err := s.DB.ApiTokenFindAll(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := ApiTokensResponse{Data: make([]ApiToken, 0, len(tokens))}
+	for _, t := range tokens {
+		resp.Data = append(resp.Data, toApiToken(t))
+	}
+
+	return json.Marshal(resp)
+}
+
+// ApiTokenCreate creates a personal token, e.g. an app password for WebDAV
+// clients. The plain token is only returned once.
+func (s *Config) ApiTokenCreate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		return nil, ErrBadRequest
+	}
+
+	token := gonanoid.Must(48)
+
+	created, err := s.DB.ApiTokenCreate(ctx, db.ApiTokenCreateParams{
+		Name:      name,
+		TokenHash: middleware.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	s.Audit.Record(ctx, user, audit.CredentialEvent("api_token", created.ID, created.Name))
+	return json.Marshal(ApiTokenCreateResponse{
+		Data:  toApiToken(created),
+		Token: token,
+	})
+}
+
+func (s *Config) ApiTokenDelete(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	err := s.DB.ApiTokenRevoke(ctx, db.ApiTokenRevokeParams{
+		ID:     r.PathValue("id"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+// FolderArchive streams a folder with all its contents as ZIP archive.
+func (s *Config) FolderArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folder, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if errors.Is(err, drive.ErrNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("error finding folder", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !folder.IsDir() {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	s.serveArchive(w, r, user, []drive.Node{folder}, folder.Name+".zip")
+}
+
+type FilesArchiveRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// FilesArchive streams the selected files and folders as ZIP archive. IDs
+// that don't exist or that the user can't see are skipped.
+func (s *Config) FilesArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req FilesArchiveRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.IDs) == 0 {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	nodes := make([]drive.Node, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		node, err := s.Drive.Find(ctx, user, id)
+		if errors.Is(err, drive.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.Error("error finding file", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	name := "download.zip"
+	if len(nodes) == 1 {
+		name = nodes[0].Name + ".zip"
+	}
+
+	s.serveArchive(w, r, user, nodes, name)
+}
+
+func (s *Config) serveArchive(w http.ResponseWriter, r *http.Request, user *db.User, nodes []drive.Node, name string) {
+	ctx := r.Context()
+
+	archive, err := s.Drive.Archive(ctx, user, nodes)
+	if errors.Is(err, drive.ErrTooLarge) {
+		http.Error(w, "Archive Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		slog.Error("error collecting archive", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The size of the archive isn't known in advance, so it is sent chunked
+	for _, node := range nodes {
+		event := audit.FileEvent(audit.ActionDownload, node.File)
+		event.Details = map[string]string{"archive": name}
+		s.Audit.Record(ctx, user, event)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+
+	err = archive.Write(ctx, w)
+	if err != nil {
+		// The status is sent already, the client sees a truncated archive
+		slog.Error("error writing archive", "err", err)
+	}
+}
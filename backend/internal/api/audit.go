@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type AuditEvent struct {
+	ID           string          `json:"id"`
+	UserID       *string         `json:"user_id"`
+	Action       db.AuditAction  `json:"action"`
+	FileID       *string         `json:"file_id"`
+	TargetUserID *string         `json:"target_user_id"`
+	TargetName   string          `json:"target_name"`
+	Details      json.RawMessage `json:"details"`
+	IpAddress    *string         `json:"ip_address"`
+	UserAgent    string          `json:"user_agent"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+type AuditEventsResponse struct {
+	Data []AuditEvent `json:"data"`
+	// NextCursor is passed as cursor to get the next page. It is omitted on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func toAuditEvent(e db.AuditEvent) AuditEvent {
+	event := AuditEvent{
+		ID:         e.ID,
+		Action:     e.Action,
+		TargetName: e.TargetName,
+		Details:    e.Details,
+		UserAgent:  e.UserAgent,
+		CreatedAt:  e.CreatedAt,
+	}
+	if e.UserID.Valid {
+		event.UserID = &e.UserID.String
+	}
+	if e.FileID.Valid {
+		event.FileID = &e.FileID.String
+	}
+	if e.TargetUserID.Valid {
+		event.TargetUserID = &e.TargetUserID.String
+	}
+	if e.IpAddress.Valid {
+		event.IpAddress = &e.IpAddress.String
+	}
+	return event
+}
+
+// auditFilter parses the filters user_id, action (repeatable), file_id,
+// created_after and created_before.
+func auditFilter(query url.Values) (audit.Filter, error) {
+	f := audit.Filter{
+		UserID: query.Get("user_id"),
+		FileID: query.Get("file_id"),
+	}
+	for _, action := range query["action"] {
+		f.Actions = append(f.Actions, db.AuditAction(action))
+	}
+
+	var err error
+	f.After, err = parseDate(query, "created_after", false)
+	if err != nil {
+		return audit.Filter{}, ErrBadRequest
+	}
+	f.Before, err = parseDate(query, "created_before", true)
+	if err != nil {
+		return audit.Filter{}, ErrBadRequest
+	}
+	return f, nil
+}
+
+// AuditEvents returns a page of the audit log of the organisation, the latest
+// events first. Only admins may read it.
+func (s *Config) AuditEvents(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	query := r.URL.Query()
+	f, err := auditFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseInt(query, "limit")
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := s.Audit.Events(ctx, user.OrganisationID, f, limit, query.Get("cursor"))
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		return nil, ErrBadRequest
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := AuditEventsResponse{Data: make([]AuditEvent, 0, len(events)), NextCursor: next}
+	for _, e := range events {
+		resp.Data = append(resp.Data, toAuditEvent(e))
+	}
+
+	return json.Marshal(resp)
+}
+
+// auditColumns is the header of the CSV export.
+var auditColumns = []string{"id", "created_at", "user_id", "action", "file_id", "target_user_id", "target_name", "details", "ip_address", "user_agent"}
+
+// AuditExport streams all events of the audit log matching the filters of
+// AuditEvents as CSV (format=csv, the default) or JSON Lines (format=jsonl).
+func (s *Config) AuditExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !isAdmin(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	f, err := auditFilter(query)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var write func(db.AuditEvent) error
+	var writer *csv.Writer
+	format := query.Get("format")
+	switch format {
+	case "", "csv":
+		format = "csv"
+		writer = csv.NewWriter(w)
+		write = func(e db.AuditEvent) error {
+			return writer.Write([]string{
+				e.ID,
+				e.CreatedAt.Format(time.RFC3339Nano),
+				e.UserID.String,
+				string(e.Action),
+				e.FileID.String,
+				e.TargetUserID.String,
+				csvField(e.TargetName),
+				string(e.Details),
+				e.IpAddress.String,
+				csvField(e.UserAgent),
+			})
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		write = func(e db.AuditEvent) error {
+			return encoder.Encode(toAuditEvent(e))
+		}
+		w.Header().Set("Content-Type", "application/jsonl")
+	default:
+		http.Error(w, "Unsupported Format", http.StatusBadRequest)
+		return
+	}
+
+	name := "audit-" + time.Now().UTC().Format(time.DateOnly) + "." + format
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+
+	if writer != nil {
+		err = writer.Write(auditColumns)
+		if err == nil {
+			err = s.Audit.Export(ctx, user.OrganisationID, f, write)
+		}
+		writer.Flush()
+		err = errors.Join(err, writer.Error())
+	} else {
+		err = s.Audit.Export(ctx, user.OrganisationID, f, write)
+	}
+	if err != nil {
+		// The status is sent already, the client sees a truncated export
+		slog.Error("error exporting audit log", "err", err)
+	}
+}
+
+// csvField keeps spreadsheets from evaluating user provided values, such as
+// file names, as formulas.
+func csvField(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"example/internal/audit"
 	"example/internal/database/db"
 	"example/internal/middleware"
 	"net/http"
@@ -47,14 +48,26 @@ func (s *Config) OneTimeLogin(ctx context.Context, r *http.Request) ([]byte, err
 		ID:             user.ID,
 	}
 
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.DB.WithTx(tx)
+
 	// Save the token in db
-	_, err = s.DB.UpdateUserConfirmationToken(ctx, updateUserConfirmationTokenParams)
+	_, err = qtx.UpdateUserConfirmationToken(ctx, updateUserConfirmationTokenParams)
 	if err != nil {
 		return nil, ErrInternal
 	}
 
 	// Send email with token
-	err = s.Mailer.SendToken(user.Email, user.FirstName, token)
+	err = s.Mailer.SendToken(ctx, qtx, user, token)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, ErrInternal
 	}
@@ -100,6 +113,8 @@ func (s *Config) SignIn(ctx context.Context, r *http.Request) ([]byte, error) {
 		return nil, ErrInternal
 	}
 
+	s.Audit.Record(ctx, &user, audit.Event{Action: audit.ActionLogin})
+
 	response := SignInResponse{
 		Token: session.Token,
 		User: User{
@@ -148,8 +163,15 @@ func (s *Config) SignUp(ctx context.Context, r *http.Request) ([]byte, error) {
 		return nil, ErrBadRequest
 	}
 
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.DB.WithTx(tx)
+
 	// Create organisation
-	org, err := s.DB.CreateOrganisation(ctx, organisation)
+	org, err := qtx.CreateOrganisation(ctx, organisation)
 	if err != nil {
 		return nil, ErrInternal
 	}
@@ -163,7 +185,7 @@ func (s *Config) SignUp(ctx context.Context, r *http.Request) ([]byte, error) {
 	}
 
 	// Create user
-	user, err := s.DB.CreateUser(ctx, createUserParams)
+	user, err := qtx.CreateUser(ctx, createUserParams)
 	if err != nil {
 		return nil, ErrInternal
 	}
@@ -178,13 +200,18 @@ func (s *Config) SignUp(ctx context.Context, r *http.Request) ([]byte, error) {
 	}
 
 	// Save the token in db
-	_, err = s.DB.UpdateUserConfirmationToken(ctx, confirmationTokenParams)
+	_, err = qtx.UpdateUserConfirmationToken(ctx, confirmationTokenParams)
 	if err != nil {
 		return nil, ErrInternal
 	}
 
 	// Send email with token
-	err = s.Mailer.SendToken(user.Email, user.FirstName, token)
+	err = s.Mailer.SendToken(ctx, qtx, user, token)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, ErrInternal
 	}
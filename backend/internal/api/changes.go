@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Change struct {
+	Seq    int64                 `json:"seq"`
+	Action db.FileActivityAction `json:"action"`
+	FileID string                `json:"file_id"`
+	// File is the current state of the file, deleted_at is set if it is in
+	// the trash. It is omitted if the file was removed.
+	File *db.File `json:"file,omitempty"`
+	// Removed is true if the user can no longer see the file, which the
+	// client drops.
+	Removed   bool      `json:"removed,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func toChange(c drive.Change) Change {
+	change := Change{Seq: c.Seq, Action: c.Action, FileID: c.File.ID, Removed: c.Removed, ChangedAt: c.ChangedAt}
+	if !c.Removed {
+		change.File = &c.File
+	}
+	return change
+}
+
+type ChangesResponse struct {
+	Data []Change `json:"data"`
+	// Cursor is passed as cursor of the next request.
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"has_more"`
+}
+
+// ChangesExpiredResponse is sent with 410 Gone if the changes after the
+// cursor were pruned. The client lists all files again and continues from
+// Cursor.
+type ChangesExpiredResponse struct {
+	Error  string `json:"error"`
+	Resync bool   `json:"resync"`
+	Cursor string `json:"cursor"`
+}
+
+// Changes returns the changes of the files the user may see after the
+// query parameter cursor, in order. Files the user no longer sees after a
+// move or transfer come as removed, with only their ID. Revoked permissions
+// and group memberships don't show up, clients list all files again from
+// time to time to notice them. Without a cursor it returns no changes
+// and the latest cursor, to start syncing after listing all files.
+func (s *Config) Changes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parseInt(query, "limit")
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	var resp any
+	if query.Get("cursor") == "" {
+		latest, err := s.Drive.LatestCursor(ctx, user)
+		if err != nil {
+			slog.Error("error finding latest change", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		resp = ChangesResponse{Data: []Change{}, Cursor: strconv.FormatInt(latest, 10)}
+	} else {
+		cursor, err := strconv.ParseInt(query.Get("cursor"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		page, err := s.Drive.Changes(ctx, user, cursor, limit)
+		switch {
+		case errors.Is(err, drive.ErrCursorExpired):
+			latest, err := s.Drive.LatestCursor(ctx, user)
+			if err != nil {
+				slog.Error("error finding latest change", "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			status = http.StatusGone
+			resp = ChangesExpiredResponse{Error: "cursor_expired", Resync: true, Cursor: strconv.FormatInt(latest, 10)}
+		case errors.Is(err, drive.ErrInvalid):
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		case err != nil:
+			slog.Error("error listing changes", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		default:
+			changes := ChangesResponse{
+				Data:    make([]Change, 0, len(page.Changes)),
+				Cursor:  strconv.FormatInt(page.Cursor, 10),
+				HasMore: page.HasMore,
+			}
+			for _, c := range page.Changes {
+				changes.Data = append(changes.Data, toChange(c))
+			}
+			resp = changes
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		slog.Error("error writing changes", "err", err)
+	}
+}
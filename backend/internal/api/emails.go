@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"example/internal/services/mail"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Email is an email of the outbox. The body is left out, it may contain login
+// tokens.
+type Email struct {
+	ID       string         `json:"id"`
+	Template string         `json:"template"`
+	To       string         `json:"to"`
+	Subject  string         `json:"subject"`
+	Status   db.EmailStatus `json:"status"`
+	Attempts int32          `json:"attempts"`
+	// Error is the one of the last failed attempt.
+	Error     string     `json:"error"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at"`
+}
+
+type EmailsResponse struct {
+	Data []Email `json:"data"`
+	// NextCursor is passed as cursor to get the next page. It is omitted on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func toEmail(e db.Email) Email {
+	email := Email{
+		ID:        e.ID,
+		Template:  e.Template,
+		To:        e.ToAddress,
+		Subject:   e.Subject,
+		Status:    e.Status,
+		Attempts:  e.Attempts,
+		Error:     e.Error,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.SentAt.Valid {
+		email.SentAt = &e.SentAt.Time
+	}
+	return email
+}
+
+// Emails returns a page of the emails of the organisation, the latest first,
+// filtered by the query parameters status and template. Only admins may see
+// them.
+func (s *Config) Emails(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	query := r.URL.Query()
+	limit, err := parseInt(query, "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	f := mail.Filter{
+		Status:   db.EmailStatus(query.Get("status")),
+		Template: query.Get("template"),
+	}
+
+	emails, next, err := s.Mailer.Emails(ctx, user.OrganisationID, f, limit, query.Get("cursor"))
+	if errors.Is(err, mail.ErrInvalidCursor) {
+		return nil, ErrBadRequest
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := EmailsResponse{Data: make([]Email, 0, len(emails)), NextCursor: next}
+	for _, e := range emails {
+		resp.Data = append(resp.Data, toEmail(e))
+	}
+
+	return json.Marshal(resp)
+}
+
+func (s *Config) Email(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	email, err := s.DB.EmailFindByID(ctx, db.EmailFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(toEmail(email))
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// eventsHeartbeat is the interval of comments sent on idle event streams, so
+// that proxies don't close them.
+const eventsHeartbeat = 30 * time.Second
+
+// eventName returns the name of the server-sent event of a change.
+func eventName(c drive.Change) string {
+	if c.Removed {
+		return "file.removed"
+	}
+
+	switch c.Action {
+	case drive.ActivityCreate, drive.ActivityRestore:
+		return "file.created"
+	case drive.ActivityDelete:
+		return "file.deleted"
+	default:
+		return "file.updated"
+	}
+}
+
+func writeEvent(w io.Writer, id int64, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, payload)
+	return err
+}
+
+// Events streams the changes of the files the user may see as server-sent
+// events named file.created, file.updated, file.deleted and file.removed,
+// with the data of a Change. The ID of an event is its cursor of the changes
+// feed, clients resume after it with the Last-Event-ID header. If the changes
+// after it were pruned, a resync event tells the client to list all files
+// again.
+func (s *Config) Events(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var cursor int64
+	var err error
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		cursor, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	} else {
+		cursor, err = s.Drive.LatestCursor(ctx, user)
+		if err != nil {
+			slog.Error("error finding latest change", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Subscribed before catching up, so that no change is missed in between
+	changed, unsubscribe := s.Hub.Subscribe(user.OrganisationID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	send := true
+	for {
+		if send {
+			cursor, err = s.writeChanges(ctx, w, user, cursor)
+		} else {
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("error streaming events", "err", err)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			send = true
+		case <-heartbeat.C:
+			send = false
+		}
+	}
+}
+
+// writeChanges writes the changes after cursor as events and returns the
+// cursor of the last one.
+func (s *Config) writeChanges(ctx context.Context, w io.Writer, user *db.User, cursor int64) (int64, error) {
+	for {
+		page, err := s.Drive.Changes(ctx, user, cursor, drive.MaxChangesLimit)
+		if errors.Is(err, drive.ErrCursorExpired) || errors.Is(err, drive.ErrInvalid) {
+			latest, err := s.Drive.LatestCursor(ctx, user)
+			if err != nil {
+				return cursor, err
+			}
+			return latest, writeEvent(w, latest, "resync", map[string]string{"cursor": strconv.FormatInt(latest, 10)})
+		}
+		if err != nil {
+			return cursor, err
+		}
+
+		for _, c := range page.Changes {
+			err = writeEvent(w, c.Seq, eventName(c), toChange(c))
+			if err != nil {
+				return cursor, err
+			}
+		}
+
+		cursor = page.Cursor
+		if !page.HasMore {
+			return cursor, nil
+		}
+	}
+}
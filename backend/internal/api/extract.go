@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// FileExtractEntry is a line of the FileExtract response.
+type FileExtractEntry struct {
+	Path  string   `json:"path"`
+	File  *db.File `json:"file,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// FileExtractResult is the last line of the FileExtract response.
+type FileExtractResult struct {
+	Done   bool   `json:"done"`
+	Files  int    `json:"files"`
+	Failed int    `json:"failed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FileExtract uploads a ZIP or tar.gz archive and extracts it into the folder
+// given by parent_id. Progress is streamed as JSON lines, one per entry,
+// followed by a FileExtractResult. Errors that occur before the first entry
+// are returned with a status code instead.
+func (s *Config) FileExtract(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	parent := s.Drive.MyFiles(user)
+	if id := r.FormValue("parent_id"); id != "" {
+		parent, err = s.Drive.Find(ctx, user, id)
+		if err != nil {
+			extractError(w, err)
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	result := FileExtractResult{}
+
+	progress := func(entry drive.ExtractEntry) {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		line := FileExtractEntry{Path: entry.Path}
+		if entry.Err != nil {
+			line.Error = extractMessage(entry.Err)
+			result.Failed++
+		} else {
+			line.File = &entry.File
+			result.Files++
+			s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionUpload, entry.File))
+		}
+
+		_ = encoder.Encode(line)
+		_ = rc.Flush()
+	}
+
+	name := strings.ToLower(header.Filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = s.Drive.ExtractZip(ctx, user, parent, file, header.Size, progress)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = s.Drive.ExtractTarGz(ctx, user, parent, file, progress)
+	default:
+		http.Error(w, "Unsupported Archive Format", http.StatusBadRequest)
+		return
+	}
+
+	if !started {
+		if err != nil {
+			extractError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	result.Done = err == nil
+	if err != nil {
+		result.Error = extractMessage(err)
+	}
+	_ = encoder.Encode(result)
+}
+
+// extractError sends the status code for an error that occurred before the
+// extraction started.
+func extractError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, drive.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, drive.ErrInvalid):
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	case errors.Is(err, drive.ErrTooLarge):
+		http.Error(w, "Archive Too Large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, drive.ErrQuotaExceeded):
+		http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+	default:
+		slog.Error("error extracting archive", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// extractMessage returns the message reported for an error. Internal errors
+// are only logged.
+func extractMessage(err error) string {
+	switch {
+	case errors.Is(err, drive.ErrNotFound), errors.Is(err, drive.ErrForbidden), errors.Is(err, drive.ErrExists),
+		errors.Is(err, drive.ErrInvalid), errors.Is(err, drive.ErrTooLarge), errors.Is(err, drive.ErrQuotaExceeded):
+		return err.Error()
+	default:
+		slog.Error("error extracting archive", "err", err)
+		return "internal error"
+	}
+}
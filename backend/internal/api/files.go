@@ -3,20 +3,92 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"example/internal/audit"
 	"example/internal/database/db"
+	"example/internal/drive"
 	"example/internal/middleware"
+	"example/internal/storage"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
-	"os"
 	"time"
-
-	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/minio/minio-go/v7"
 )
 
 type FilesResponse struct {
 	Data []db.File `json:"data"`
+	// NextCursor is passed as cursor to get the next page. It is omitted on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// driveError maps errors of the drive service to API errors.
+func driveError(err error) error {
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, drive.ErrForbidden):
+		return ErrForbidden
+	case errors.Is(err, drive.ErrExists), errors.Is(err, drive.ErrInvalid), errors.Is(err, drive.ErrChecksumMismatch):
+		return ErrBadRequest
+	case errors.Is(err, drive.ErrQuotaExceeded):
+		return ErrQuotaExceeded
+	default:
+		slog.Error("error accessing drive", "err", err)
+		return ErrInternal
+	}
+}
+
+// list returns a page of the files in node the user may see. The page is
+// selected by the query parameters sort (name, size, created or modified),
+// order (asc or desc), type (repeatable: folder, file or a MIME type like
+// "image/*"), limit and cursor.
+func (s *Config) list(ctx context.Context, r *http.Request, user *db.User, node drive.Node) ([]db.File, string, error) {
+	query := r.URL.Query()
+	opts := drive.ListOptions{
+		Sort:   drive.SortKey(query.Get("sort")),
+		Types:  query["type"],
+		Cursor: query.Get("cursor"),
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return nil, "", ErrBadRequest
+	}
+
+	var err error
+	opts.Limit, err = parseInt(query, "limit")
+	if err != nil {
+		return nil, "", ErrBadRequest
+	}
+
+	page, err := s.Drive.ListPage(ctx, user, node, opts)
+	if err != nil {
+		return nil, "", driveError(err)
+	}
+
+	files := make([]db.File, 0, len(page.Nodes))
+	for _, n := range page.Nodes {
+		files = append(files, n.File)
+	}
+	return files, page.NextCursor, nil
+}
+
+// parent returns the folder given by id, or the personal root if id is empty.
+func (s *Config) parent(ctx context.Context, user *db.User, id string) (drive.Node, error) {
+	if id == "" {
+		return s.Drive.MyFiles(user), nil
+	}
+
+	node, err := s.Drive.Find(ctx, user, id)
+	if err != nil {
+		return drive.Node{}, driveError(err)
+	}
+	return node, nil
 }
 
 func (s *Config) Files(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -28,41 +100,31 @@ func (s *Config) Files(ctx context.Context, r *http.Request) ([]byte, error) {
 	parentId := r.URL.Query().Get("parent_id")
 	sharedDrives := r.URL.Query().Get("shared_drive")
 
-	var files []db.File
-	var err error
-	if sharedDrives != "" {
-		files, err = s.DB.FileFindSharedDrives(ctx, user.OrganisationID)
-		if err != nil {
-			return nil, ErrInternal
-		}
-	} else if parentId == "" {
-		files, err = s.DB.FileFindAll(ctx, user.OrganisationID)
+	node := s.Drive.SharedDrives(user)
+	if sharedDrives == "" {
+		var err error
+		node, err = s.parent(ctx, user, parentId)
 		if err != nil {
-			return nil, ErrInternal
+			return nil, err
 		}
-	} else {
-		files, err = s.DB.FileFindByParentID(ctx, db.FileFindByParentIDParams{
-			ParentID:       pgtype.Text{String: parentId, Valid: true},
-			OrganisationID: user.OrganisationID,
-		})
 	}
 
-	switch {
-	case err != nil:
-		return nil, ErrInternal
-	case len(files) == 0:
-		return json.Marshal(FilesResponse{
-			Data: make([]db.File, 0),
-		})
-	default:
-		return json.Marshal(FilesResponse{
-			Data: files,
-		})
+	files, next, err := s.list(ctx, r, user, node)
+	if err != nil {
+		return nil, err
 	}
+
+	return json.Marshal(FilesResponse{
+		Data:       files,
+		NextCursor: next,
+	})
 }
 
 type FoldersResponse struct {
-	Data []db.File `json:"data"`
+	Data       []db.File `json:"data"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	// Breadcrumbs is the path to the folder, ending with the folder itself.
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
 }
 
 func (s *Config) Folders(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -71,30 +133,31 @@ func (s *Config) Folders(ctx context.Context, r *http.Request) ([]byte, error) {
 		return nil, ErrUnauthorized
 	}
 
-	id := r.PathValue("id")
-
-	fileFindByParentIDParams := db.FileFindByParentIDParams{
-		ParentID:       pgtype.Text{String: id, Valid: true},
-		OrganisationID: user.OrganisationID,
+	folder, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
 	}
 
-	folder, err := s.DB.FileFindByParentID(ctx, fileFindByParentIDParams)
+	files, next, err := s.list(ctx, r, user, folder)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, err
 	}
 
-	var resp FoldersResponse
-	resp.Data = folder
-
-	if len(folder) == 0 {
-		resp.Data = make([]db.File, 0)
+	crumbs, err := s.breadcrumbs(ctx, user, folder)
+	if err != nil {
+		return nil, err
 	}
 
-	return json.Marshal(resp)
+	return json.Marshal(FoldersResponse{
+		Data:        files,
+		NextCursor:  next,
+		Breadcrumbs: crumbs,
+	})
 }
 
 type SharedDrivesResponse struct {
-	Data []db.File `json:"data"`
+	Data       []db.File `json:"data"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 func (s *Config) SharedDrives(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -103,19 +166,15 @@ func (s *Config) SharedDrives(ctx context.Context, r *http.Request) ([]byte, err
 		return nil, ErrUnauthorized
 	}
 
-	drives, err := s.DB.FileFindSharedDrives(ctx, user.OrganisationID)
+	drives, next, err := s.list(ctx, r, user, s.Drive.SharedDrives(user))
 	if err != nil {
-		return nil, ErrInternal
-	}
-
-	var resp SharedDrivesResponse
-	resp.Data = drives
-
-	if len(drives) == 0 {
-		resp.Data = make([]db.File, 0)
+		return nil, err
 	}
 
-	return json.Marshal(resp)
+	return json.Marshal(SharedDrivesResponse{
+		Data:       drives,
+		NextCursor: next,
+	})
 }
 
 type FileUploadResponse struct {
@@ -128,16 +187,15 @@ func (s *Config) FileUpload(ctx context.Context, r *http.Request) ([]byte, error
 		return nil, ErrUnauthorized
 	}
 
-	// TODO: handle the case where file doesn't get uploaded but is already in db
-	//  Hint: you can do that with a transaction
+	parent, err := s.parent(ctx, user, r.FormValue("parent_id"))
+	if err != nil {
+		return nil, err
+	}
 
 	if r.FormValue("is_folder") != "" {
-		folder, err := s.DB.FileCreateFolder(ctx, db.FileCreateFolderParams{
-			Name:           r.FormValue("name"),
-			OrganisationID: user.OrganisationID,
-		})
+		folder, err := s.Drive.Mkdir(ctx, user, parent, r.FormValue("name"))
 		if err != nil {
-			return nil, ErrInternal
+			return nil, driveError(err)
 		}
 
 		resp := FileUploadResponse{
@@ -146,7 +204,7 @@ func (s *Config) FileUpload(ctx context.Context, r *http.Request) ([]byte, error
 		return json.Marshal(resp)
 	}
 
-	err := r.ParseMultipartForm(32 << 20)
+	err = r.ParseMultipartForm(32 << 20)
 	if err != nil {
 		return nil, ErrInternal
 	}
@@ -157,27 +215,28 @@ func (s *Config) FileUpload(ctx context.Context, r *http.Request) ([]byte, error
 	}
 	defer file.Close()
 
-	fileCreateParams := db.FileCreateParams{
-		Name:           header.Filename,
-		MimeType:       header.Header.Get("Content-Type"),
-		FileSize:       header.Size,
-		OrganisationID: user.OrganisationID,
+	// Content-Digest is taken from the file part, or from the request if the
+	// client can't set headers on parts
+	var body io.Reader = file
+	digest := header.Header.Get("Content-Digest")
+	if digest == "" {
+		digest = r.Header.Get("Content-Digest")
 	}
-
-	if r.FormValue("parent_id") != "" {
-		fileCreateParams.ParentID = pgtype.Text{String: r.FormValue("parent_id"), Valid: true}
+	if digest != "" {
+		d, err := drive.ParseContentDigest(digest)
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+		body = drive.Verify(file, header.Size, d)
 	}
 
-	fileCreated, err := s.DB.FileCreate(ctx, fileCreateParams)
+	// The row is only committed once the upload succeeded
+	fileCreated, err := s.Drive.Create(ctx, user, parent, header.Filename, header.Header.Get("Content-Type"), body, header.Size)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, driveError(err)
 	}
 
-	// upload to minio
-	_, err = s.MinIO.PutObject(ctx, os.Getenv("MINIO_BUCKET"), fileCreated.ID, file, fileCreateParams.FileSize, minio.PutObjectOptions{})
-	if err != nil {
-		return nil, ErrInternal
-	}
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionUpload, fileCreated))
 
 	return json.Marshal(FileUploadResponse{
 		Data: fileCreated,
@@ -185,19 +244,45 @@ func (s *Config) FileUpload(ctx context.Context, r *http.Request) ([]byte, error
 }
 
 func (s *Config) FileDelete(ctx context.Context, r *http.Request) ([]byte, error) {
-	_, ok := middleware.GetUser(ctx, s.DB)
+	user, ok := middleware.GetUser(ctx, s.DB)
 	if !ok {
 		return nil, ErrUnauthorized
 	}
 
-	err := s.DB.FileSoftDelete(ctx, r.PathValue("id"))
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
 	if err != nil {
-		return nil, ErrInternal
+		return nil, driveError(err)
 	}
 
+	err = s.Drive.Trash(ctx, user, node)
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionDelete, node.File))
 	return nil, nil
 }
 
+// FileRestore moves a file or folder out of the trash.
+func (s *Config) FileRestore(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	file, err := s.Drive.Restore(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionRestore, file))
+	return json.Marshal(file)
+}
+
+// FileDownload streams a file from the storage. Range requests (including
+// multipart byteranges) and conditional requests are handled by
+// http.ServeContent, which seeks in the object, so every range is fetched
+// separately.
 func (s *Config) FileDownload(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, ok := middleware.GetUser(ctx, s.DB)
@@ -206,38 +291,114 @@ func (s *Config) FileDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := r.PathValue("id")
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if errors.Is(err, drive.ErrNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("error finding file", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	file := node.File
 
-	file, err := s.DB.FileFindByID(ctx, db.FileFindByIDParams{
-		ID:             id,
-		OrganisationID: user.OrganisationID,
-	})
+	object, err := s.Drive.Open(ctx, node)
+	if errors.Is(err, drive.ErrInvalid) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storage.ErrNotExist) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("error opening file", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	// Everything that can fail has to happen before the first byte is
+	// written, afterwards the status can't be changed anymore
+	info, err := object.Stat()
+	if errors.Is(err, storage.ErrNotExist) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.Error("error reading file info", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", file.MimeType)
-	w.Header().Set("Content-Disposition", "attachment; filename="+file.Name)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	switch {
+	case file.Sha256.Valid:
+		w.Header().Set("ETag", `"`+file.Sha256.String+`"`)
+	case info.ETag != "":
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	}
 
-	// download from minio
-	object, err := s.MinIO.GetObject(ctx, os.Getenv("MINIO_BUCKET"), file.ID, minio.GetObjectOptions{})
-	if err != nil {
-		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	s.Drive.RecordAccess(ctx, user, file, drive.AccessDownload)
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionDownload, file))
+	http.ServeContent(w, r, file.Name, info.LastModified, object)
+}
+
+// FileThumbnail serves a JPEG thumbnail of a file. The size is one of
+// drive.ThumbnailSizes, files without thumbnail respond with 404.
+func (s *Config) FileThumbnail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer object.Close()
 
-	_, err = io.Copy(w, object)
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = drive.DefaultThumbnailSize
+	}
+
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if errors.Is(err, drive.ErrNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.Error("error finding file", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	file := node.File
+
+	object, err := s.Drive.OpenThumbnail(ctx, node, size)
+	switch {
+	case errors.Is(err, drive.ErrInvalid):
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	case errors.Is(err, drive.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, drive.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	case err != nil:
+		slog.Error("error opening thumbnail", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	defer object.Close()
 
-	return
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if file.Sha256.Valid {
+		w.Header().Set("ETag", `"`+file.Sha256.String+"-"+size+`"`)
+	}
+
+	http.ServeContent(w, r, "", file.ThumbnailedAt.Time, object)
 }
 
 func (s *Config) FilePatch(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -252,48 +413,82 @@ func (s *Config) FilePatch(ctx context.Context, r *http.Request) ([]byte, error)
 		return nil, ErrBadRequest
 	}
 
-	fileUpdateNameParams := db.FileUpdateNameParams{
-		ID:             r.PathValue("id"),
-		OrganisationID: user.OrganisationID,
-		Name:           file.Name,
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
 	}
 
-	file, err = s.DB.FileUpdateName(ctx, fileUpdateNameParams)
+	file, err = s.Drive.Rename(ctx, user, node, file.Name)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, driveError(err)
+	}
+
+	if file.Name != node.File.Name {
+		event := audit.FileEvent(audit.ActionRename, file)
+		event.Details = map[string]string{"from": node.File.Name, "to": file.Name}
+		s.Audit.Record(ctx, user, event)
 	}
 
 	return json.Marshal(file)
 }
 
-type FilePreviewResponse struct {
-	URL string `json:"url"`
+type FileTransferRequest struct {
+	UserID string `json:"user_id"`
 }
 
-func (s *Config) FilePreview(ctx context.Context, r *http.Request) ([]byte, error) {
+// FileTransfer makes another user of the organisation the owner of a file.
+func (s *Config) FileTransfer(ctx context.Context, r *http.Request) ([]byte, error) {
 	user, ok := middleware.GetUser(ctx, s.DB)
 	if !ok {
 		return nil, ErrUnauthorized
 	}
 
-	id := r.PathValue("id")
+	var req FileTransferRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.UserID == "" {
+		return nil, ErrBadRequest
+	}
 
-	fileFindParams := db.FileFindByIDParams{
-		ID:             id,
-		OrganisationID: user.OrganisationID,
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
 	}
 
-	file, err := s.DB.FileFindByID(ctx, fileFindParams)
+	file, err := s.Drive.Transfer(ctx, user, node, req.UserID)
 	if err != nil {
-		return nil, ErrInternal
+		return nil, driveError(err)
 	}
 
-	// Get preview url from minio
-	presignedURL, err := s.MinIO.PresignedGetObject(ctx, os.Getenv("MINIO_BUCKET"), file.ID, time.Second*60, nil)
+	event := audit.FileEvent(audit.ActionTransfer, file)
+	event.Details = map[string]string{"from": node.File.OwnerID.String, "to": file.OwnerID.String}
+	s.Audit.Record(ctx, user, event)
+
+	return json.Marshal(file)
+}
+
+type FilePreviewResponse struct {
+	URL string `json:"url"`
+}
+
+func (s *Config) FilePreview(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	presignedURL, err := s.Storage.PresignGet(ctx, drive.ObjectName(node.File), time.Second*60)
 	if err != nil {
 		return nil, ErrInternal
 	}
 
+	s.Drive.RecordAccess(ctx, user, node.File, drive.AccessOpen)
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionPreview, node.File))
+
 	return json.Marshal(FilePreviewResponse{
 		URL: presignedURL.String(),
 	})
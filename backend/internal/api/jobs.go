@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/jobs"
+	"example/internal/middleware"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      db.JobStatus    `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	// Error is the one of the last failed attempt.
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+type JobsResponse struct {
+	Data []Job `json:"data"`
+	// NextCursor is passed as cursor to get the next page. It is omitted on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func toJob(j db.Job) Job {
+	job := Job{
+		ID:          j.ID,
+		Kind:        j.Kind,
+		Payload:     j.Payload,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt,
+		Error:       j.Error,
+		CreatedAt:   j.CreatedAt,
+	}
+	if j.FinishedAt.Valid {
+		job.FinishedAt = &j.FinishedAt.Time
+	}
+	return job
+}
+
+// Jobs returns a page of the background jobs of the organisation, the latest
+// first, filtered by the query parameters status and kind. Only admins may
+// see them.
+func (s *Config) Jobs(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	query := r.URL.Query()
+	limit, err := parseInt(query, "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	f := jobs.Filter{
+		Status: db.JobStatus(query.Get("status")),
+		Kind:   query.Get("kind"),
+	}
+
+	list, next, err := s.Queue.Jobs(ctx, user.OrganisationID, f, limit, query.Get("cursor"))
+	if errors.Is(err, jobs.ErrInvalidCursor) {
+		return nil, ErrBadRequest
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := JobsResponse{Data: make([]Job, 0, len(list)), NextCursor: next}
+	for _, j := range list {
+		resp.Data = append(resp.Data, toJob(j))
+	}
+
+	return json.Marshal(resp)
+}
+
+func (s *Config) Job(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	job, err := s.DB.JobFindByID(ctx, db.JobFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: pgtype.Text{String: user.OrganisationID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(toJob(job))
+}
+
+// JobRetry runs a dead or pending job right away, with all its attempts.
+func (s *Config) JobRetry(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	job, err := s.DB.JobRequeue(ctx, db.JobRequeueParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: pgtype.Text{String: user.OrganisationID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Running, finished or not there
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(toJob(job))
+}
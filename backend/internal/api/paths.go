@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"net/http"
+)
+
+// Breadcrumb is an element of the path to a file. The virtual roots
+// ("My Files" and "Shared Drives") have no ID.
+type Breadcrumb struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Kind is one of "root", "my_files", "shared_drives", "shared_drive",
+	// "folder" and "file".
+	Kind string `json:"kind"`
+}
+
+func nodeKind(node drive.Node) string {
+	switch {
+	case node.Kind == drive.KindRoot:
+		return "root"
+	case node.Kind == drive.KindMyFiles:
+		return "my_files"
+	case node.Kind == drive.KindSharedDrives:
+		return "shared_drives"
+	case node.File.SharedDrive:
+		return "shared_drive"
+	case node.File.IsFolder:
+		return "folder"
+	default:
+		return "file"
+	}
+}
+
+// breadcrumbs returns the path to node the user may see.
+func (s *Config) breadcrumbs(ctx context.Context, user *db.User, node drive.Node) ([]Breadcrumb, error) {
+	nodes, err := s.Drive.Breadcrumbs(ctx, user, node)
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	crumbs := make([]Breadcrumb, 0, len(nodes))
+	for _, n := range nodes {
+		crumbs = append(crumbs, Breadcrumb{ID: n.File.ID, Name: n.Name, Kind: nodeKind(n)})
+	}
+	return crumbs, nil
+}
+
+type PathResponse struct {
+	// Data is null for the virtual roots.
+	Data        *db.File     `json:"data"`
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
+
+// Paths resolves a path like "/Shared Drives/Teachers/2024/exam.pdf" to the
+// file it names.
+func (s *Config) Paths(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	node, err := s.Drive.Resolve(ctx, user, r.URL.Query().Get("path"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	crumbs, err := s.breadcrumbs(ctx, user, node)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := PathResponse{Breadcrumbs: crumbs}
+	if node.Kind == drive.KindFile {
+		resp.Data = &node.File
+	}
+	return json.Marshal(resp)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+type ScimToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ScimTokensResponse struct {
+	Data []ScimToken `json:"data"`
+}
+
+type ScimTokenCreateResponse struct {
+	Data  ScimToken `json:"data"`
+	Token string    `json:"token"`
+}
+
+func toScimToken(t db.ScimToken) ScimToken {
+	token := ScimToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.LastUsedAt.Valid {
+		token.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return token
+}
+
+// isAdmin reports whether the user may manage organisation wide settings.
+func isAdmin(user *db.User) bool {
+	return user.Role == db.UserRoleOwner || user.Role == db.UserRoleAdmin
+}
+
+func (s *Config) ScimTokens(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	tokens, err := s.DB.ScimTokenFindAll(ctx, user.OrganisationID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := ScimTokensResponse{Data: make([]ScimToken, 0, len(tokens))}
+	for _, t := range tokens {
+		resp.Data = append(resp.Data, toScimToken(t))
+	}
+
+	return json.Marshal(resp)
+}
+
+// ScimTokenCreate creates a new bearer token for the SCIM endpoint. The plain
+// token is only returned once, the database only keeps its hash.
+func (s *Config) ScimTokenCreate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		return nil, ErrBadRequest
+	}
+
+	token := gonanoid.Must(48)
+
+	created, err := s.DB.ScimTokenCreate(ctx, db.ScimTokenCreateParams{
+		Name:           name,
+		TokenHash:      middleware.HashToken(token),
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	s.Audit.Record(ctx, user, audit.CredentialEvent("scim_token", created.ID, created.Name))
+	return json.Marshal(ScimTokenCreateResponse{
+		Data:  toScimToken(created),
+		Token: token,
+	})
+}
+
+func (s *Config) ScimTokenDelete(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	revoked, err := s.DB.ScimTokenRevoke(ctx, db.ScimTokenRevokeParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	s.Audit.Record(ctx, user, audit.CredentialRevokeEvent("scim_token", revoked.ID, revoked.Name))
+	return nil, nil
+}
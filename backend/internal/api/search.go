@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type SearchResponse struct {
+	Data []db.File `json:"data"`
+	// NextOffset is passed as offset to get the next page. It is omitted on
+	// the last page.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// Search finds files by name and contents. Besides q it takes the filters
+// mime_type (repeatable, e.g. "application/pdf" or "image/*"), created_after
+// and created_before (RFC 3339 timestamps or dates, both inclusive),
+// owner_id ("me" for the current user) and folder_id, which limits the
+// results to the descendants of a folder.
+func (s *Config) Search(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	query := r.URL.Query()
+	opts := drive.SearchOptions{
+		Query:     query.Get("q"),
+		MimeTypes: query["mime_type"],
+		OwnerID:   query.Get("owner_id"),
+	}
+	if opts.OwnerID == "me" {
+		opts.OwnerID = user.ID
+	}
+
+	var err error
+	opts.CreatedAfter, err = parseDate(query, "created_after", false)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	opts.CreatedBefore, err = parseDate(query, "created_before", true)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	opts.Limit, err = parseInt(query, "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	opts.Offset, err = parseInt(query, "offset")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	if id := query.Get("folder_id"); id != "" {
+		folder, err := s.Drive.Find(ctx, user, id)
+		if err != nil {
+			return nil, driveError(err)
+		}
+		opts.Folder = &folder
+	}
+
+	result, err := s.Drive.Search(ctx, user, opts)
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	files := make([]db.File, 0, len(result.Nodes))
+	for _, n := range result.Nodes {
+		files = append(files, n.File)
+	}
+
+	return json.Marshal(SearchResponse{
+		Data:       files,
+		NextOffset: result.NextOffset,
+	})
+}
+
+// parseDate parses an RFC 3339 timestamp or a date. For the end of a range
+// (end is true) a date means the end of that day.
+func parseDate(query url.Values, key string, end bool) (time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		if end {
+			t = t.Add(time.Microsecond)
+		}
+		return t, nil
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseInt parses an optional non-negative integer.
+func parseInt(query url.Values, key string) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, ErrBadRequest
+	}
+	return n, nil
+}
@@ -3,12 +3,16 @@ package api
 import (
 	"context"
 	"errors"
+	"example/internal/audit"
+	"example/internal/drive"
+	"example/internal/events"
+	"example/internal/jobs"
 	"example/internal/services/mail"
+	"example/internal/storage"
+	"example/internal/webhook"
 	"net/http"
 
 	"example/internal/database"
-
-	"github.com/minio/minio-go/v7"
 )
 
 type Message string
@@ -23,16 +27,25 @@ var (
 	ErrInternal     = errors.New("internal error")
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrBadRequest   = errors.New("bad request")
+	ErrForbidden    = errors.New("forbidden")
+	// ErrQuotaExceeded is returned if the organisation has used up its
+	// storage.
+	ErrQuotaExceeded = errors.New("quota exceeded")
 )
 
 type Config struct {
-	DB     *database.DB
-	MinIO  *minio.Client
-	Mailer *mail.Mailer
+	DB      *database.DB
+	Storage storage.Storage
+	Mailer  *mail.Mailer
+	Drive   *drive.Service
+	Audit   *audit.Log
+	Hub     *events.Hub
+	Webhook *webhook.Service
+	Queue   *jobs.Queue
 }
 
 func NewServer(cfg Config) *Config {
-	return &Config{DB: cfg.DB, MinIO: cfg.MinIO, Mailer: cfg.Mailer}
+	return &Config{DB: cfg.DB, Storage: cfg.Storage, Mailer: cfg.Mailer, Drive: cfg.Drive, Audit: cfg.Audit, Hub: cfg.Hub, Webhook: cfg.Webhook, Queue: cfg.Queue}
 }
 
 func (s *Config) RootRoute(ctx context.Context, r *http.Request) ([]byte, error) {
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type SshKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Fingerprint string     `json:"fingerprint"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type SshKeysResponse struct {
+	Data []SshKey `json:"data"`
+}
+
+type SshKeyCreateResponse struct {
+	Data SshKey `json:"data"`
+}
+
+func toSshKey(k db.SshKey) SshKey {
+	key := SshKey{
+		ID:          k.ID,
+		Name:        k.Name,
+		Fingerprint: k.Fingerprint,
+		CreatedAt:   k.CreatedAt,
+	}
+	if k.LastUsedAt.Valid {
+		key.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return key
+}
+
+func (s *Config) SshKeys(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	keys, err := s.DB.SshKeyFindAll(ctx, user.ID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := SshKeysResponse{Data: make([]SshKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Data = append(resp.Data, toSshKey(k))
+	}
+
+	return json.Marshal(resp)
+}
+
+// SshKeyCreate registers a public key (in authorized_keys format) for the
+// SFTP server.
+func (s *Config) SshKeyCreate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(r.FormValue("public_key")))
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		name = comment
+	}
+	if name == "" {
+		return nil, ErrBadRequest
+	}
+
+	created, err := s.DB.SshKeyCreate(ctx, db.SshKeyCreateParams{
+		Name:        name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		UserID:      user.ID,
+	})
+	if err != nil {
+		// Most likely the key is already registered
+		return nil, ErrBadRequest
+	}
+
+	s.Audit.Record(ctx, user, audit.CredentialEvent("ssh_key", created.ID, created.Name))
+	return json.Marshal(SshKeyCreateResponse{
+		Data: toSshKey(created),
+	})
+}
+
+func (s *Config) SshKeyDelete(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	err := s.DB.SshKeyRevoke(ctx, db.SshKeyRevokeParams{
+		ID:     r.PathValue("id"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return nil, nil
+}
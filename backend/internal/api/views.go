@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"net/http"
+)
+
+func (s *Config) FileStar(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	err = s.Drive.Star(ctx, user, node)
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	return nil, nil
+}
+
+func (s *Config) FileUnstar(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	node, err := s.Drive.Find(ctx, user, r.PathValue("id"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	err = s.Drive.Unstar(ctx, user, node)
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	return nil, nil
+}
+
+// viewFunc returns a page of one of the views of the files of a user.
+type viewFunc func(ctx context.Context, user *db.User, limit int, cursor string) (drive.Page, error)
+
+// view responds with a page of a view, selected by the query parameters
+// limit and cursor.
+func (s *Config) view(ctx context.Context, r *http.Request, fn viewFunc) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	limit, err := parseInt(r.URL.Query(), "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	page, err := fn(ctx, user, limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		return nil, driveError(err)
+	}
+
+	files := make([]db.File, 0, len(page.Nodes))
+	for _, n := range page.Nodes {
+		files = append(files, n.File)
+	}
+
+	return json.Marshal(FilesResponse{
+		Data:       files,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// Starred lists the files starred by the user, the latest first.
+func (s *Config) Starred(ctx context.Context, r *http.Request) ([]byte, error) {
+	return s.view(ctx, r, s.Drive.Starred)
+}
+
+// Recent lists the files the user opened, downloaded or edited, the latest
+// first.
+func (s *Config) Recent(ctx context.Context, r *http.Request) ([]byte, error) {
+	return s.view(ctx, r, s.Drive.Recent)
+}
+
+// SharedWithMe lists the files shared with the user, the latest first.
+func (s *Config) SharedWithMe(ctx context.Context, r *http.Request) ([]byte, error) {
+	return s.view(ctx, r, s.Drive.SharedWithMe)
+}
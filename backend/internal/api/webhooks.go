@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"example/internal/webhook"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Webhook struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Enabled    bool     `json:"enabled"`
+	// FailureCount is the number of failed attempts in a row.
+	FailureCount int32      `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type WebhooksResponse struct {
+	Data []Webhook `json:"data"`
+}
+
+type WebhookCreateRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type WebhookCreateResponse struct {
+	Data Webhook `json:"data"`
+	// Secret signs the deliveries. It is only returned once.
+	Secret string `json:"secret"`
+}
+
+// WebhookUpdateRequest changes the fields that are set.
+type WebhookUpdateRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+type WebhookDelivery struct {
+	ID             string                   `json:"id"`
+	EventID        string                   `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Payload        json.RawMessage          `json:"payload"`
+	Status         db.WebhookDeliveryStatus `json:"status"`
+	Attempts       int32                    `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at"`
+	ResponseStatus *int32                   `json:"response_status"`
+	ResponseBody   string                   `json:"response_body"`
+	Error          string                   `json:"error"`
+	CreatedAt      time.Time                `json:"created_at"`
+	DeliveredAt    *time.Time               `json:"delivered_at"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Data []WebhookDelivery `json:"data"`
+	// NextCursor is passed as cursor to get the next page. It is omitted on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func toWebhook(w db.Webhook) Webhook {
+	hook := Webhook{
+		ID:           w.ID,
+		URL:          w.Url,
+		EventTypes:   w.EventTypes,
+		Enabled:      !w.DisabledAt.Valid,
+		FailureCount: w.FailureCount,
+		CreatedAt:    w.CreatedAt,
+	}
+	if w.DisabledAt.Valid {
+		hook.DisabledAt = &w.DisabledAt.Time
+	}
+	return hook
+}
+
+func toWebhookDelivery(d db.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:           d.ID,
+		EventID:      d.EventID,
+		EventType:    d.EventType,
+		Payload:      d.Payload,
+		Status:       d.Status,
+		Attempts:     d.Attempts,
+		ResponseBody: d.ResponseBody,
+		Error:        d.Error,
+		CreatedAt:    d.CreatedAt,
+	}
+	if d.Status == db.WebhookDeliveryStatusPending {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.ResponseStatus.Valid {
+		delivery.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	if d.DeliveredAt.Valid {
+		delivery.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return delivery
+}
+
+// adminWebhook returns the webhook of the path for admins.
+func (s *Config) adminWebhook(ctx context.Context, r *http.Request) (*db.User, db.Webhook, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, db.Webhook{}, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, db.Webhook{}, ErrForbidden
+	}
+
+	hook, err := s.DB.WebhookFindByID(ctx, db.WebhookFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, db.Webhook{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, db.Webhook{}, ErrInternal
+	}
+
+	return user, hook, nil
+}
+
+func (s *Config) Webhooks(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	hooks, err := s.DB.WebhookFindAll(ctx, user.OrganisationID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := WebhooksResponse{Data: make([]Webhook, 0, len(hooks))}
+	for _, w := range hooks {
+		resp.Data = append(resp.Data, toWebhook(w))
+	}
+
+	return json.Marshal(resp)
+}
+
+// WebhookCreate registers an endpoint that is sent the events of the
+// organisation of the given types.
+func (s *Config) WebhookCreate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, ok := middleware.GetUser(ctx, s.DB)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if !isAdmin(user) {
+		return nil, ErrForbidden
+	}
+
+	var req WebhookCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || !webhook.ValidURL(req.URL) || !webhook.ValidEventTypes(req.EventTypes) {
+		return nil, ErrBadRequest
+	}
+
+	secret := webhook.NewSecret()
+
+	created, err := s.DB.WebhookCreate(ctx, db.WebhookCreateParams{
+		OrganisationID: user.OrganisationID,
+		Url:            req.URL,
+		Secret:         secret,
+		EventTypes:     req.EventTypes,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(WebhookCreateResponse{
+		Data:   toWebhook(created),
+		Secret: secret,
+	})
+}
+
+// WebhookUpdate changes the URL or event types of a webhook, or disables
+// and enables it.
+func (s *Config) WebhookUpdate(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, hook, err := s.adminWebhook(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var req WebhookUpdateRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	params := db.WebhookUpdateParams{
+		Url:            hook.Url,
+		EventTypes:     hook.EventTypes,
+		Enabled:        !hook.DisabledAt.Valid,
+		ID:             hook.ID,
+		OrganisationID: user.OrganisationID,
+	}
+	if req.URL != nil {
+		params.Url = *req.URL
+	}
+	if req.EventTypes != nil {
+		params.EventTypes = req.EventTypes
+	}
+	if req.Enabled != nil {
+		params.Enabled = *req.Enabled
+	}
+	if !webhook.ValidURL(params.Url) || !webhook.ValidEventTypes(params.EventTypes) {
+		return nil, ErrBadRequest
+	}
+
+	hook, err = s.DB.WebhookUpdate(ctx, params)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(toWebhook(hook))
+}
+
+func (s *Config) WebhookDelete(ctx context.Context, r *http.Request) ([]byte, error) {
+	user, hook, err := s.adminWebhook(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DB.WebhookDelete(ctx, db.WebhookDeleteParams{
+		ID:             hook.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return nil, nil
+}
+
+// WebhookDeliveries returns a page of the deliveries of a webhook, the latest
+// first, with the responses of their last attempts.
+func (s *Config) WebhookDeliveries(ctx context.Context, r *http.Request) ([]byte, error) {
+	_, hook, err := s.adminWebhook(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.URL.Query()
+	limit, err := parseInt(query, "limit")
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+
+	deliveries, next, err := s.Webhook.Deliveries(ctx, hook, limit, query.Get("cursor"))
+	if errors.Is(err, webhook.ErrInvalidCursor) {
+		return nil, ErrBadRequest
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	resp := WebhookDeliveriesResponse{Data: make([]WebhookDelivery, 0, len(deliveries)), NextCursor: next}
+	for _, d := range deliveries {
+		resp.Data = append(resp.Data, toWebhookDelivery(d))
+	}
+
+	return json.Marshal(resp)
+}
+
+// WebhookDeliveryReplay sends the event of a delivery again.
+func (s *Config) WebhookDeliveryReplay(ctx context.Context, r *http.Request) ([]byte, error) {
+	_, hook, err := s.adminWebhook(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.Webhook.Replay(ctx, hook, r.PathValue("delivery_id"))
+	switch {
+	case errors.Is(err, webhook.ErrDisabled):
+		return nil, ErrBadRequest
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, ErrInternal
+	}
+
+	return json.Marshal(toWebhookDelivery(delivery))
+}
@@ -0,0 +1,294 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Actions recorded in the audit log. Files can't be shared through the app
+// yet, ActionShare is for the path that grants permissions once it exists.
+const (
+	ActionUpload           = db.AuditActionUpload
+	ActionDownload         = db.AuditActionDownload
+	ActionPreview          = db.AuditActionPreview
+	ActionRename           = db.AuditActionRename
+	ActionMove             = db.AuditActionMove
+	ActionDelete           = db.AuditActionDelete
+	ActionShare            = db.AuditActionShare
+	ActionTransfer         = db.AuditActionTransfer
+	ActionLogin            = db.AuditActionLogin
+	ActionRoleChange       = db.AuditActionRoleChange
+	ActionRestore          = db.AuditActionRestore
+	ActionCredentialCreate = db.AuditActionCredentialCreate
+	ActionCredentialRevoke = db.AuditActionCredentialRevoke
+	ActionUserCreate       = db.AuditActionUserCreate
+	ActionUserUpdate       = db.AuditActionUserUpdate
+	ActionUserDeactivate   = db.AuditActionUserDeactivate
+	ActionUserReactivate   = db.AuditActionUserReactivate
+)
+
+const (
+	// defaultRetention is how long events are kept unless
+	// AUDIT_RETENTION_DAYS is set.
+	defaultRetention = 365 * 24 * time.Hour
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Log is the append-only audit log of file and account activity of the
+// organisations, for admins.
+type Log struct {
+	DB *database.DB
+	// Retention is how long events are kept. They are kept forever if it is
+	// 0.
+	Retention time.Duration
+}
+
+func New(db *database.DB) *Log {
+	retention := defaultRetention
+	days, err := strconv.Atoi(os.Getenv("AUDIT_RETENTION_DAYS"))
+	if err == nil && days >= 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &Log{DB: db, Retention: retention}
+}
+
+// Event is something a user did.
+type Event struct {
+	Action db.AuditAction
+	// The target is either a file or a user, TargetName is its name.
+	FileID       string
+	TargetUserID string
+	TargetName   string
+	// Details depend on the action, e.g. "from" and "to" of a rename.
+	Details map[string]string
+}
+
+// FileEvent returns the event of an action on a file.
+func FileEvent(action db.AuditAction, file db.File) Event {
+	return Event{Action: action, FileID: file.ID, TargetName: file.Name}
+}
+
+// UserEvent returns the event of an action on the account of a user.
+func UserEvent(action db.AuditAction, user db.User) Event {
+	return Event{Action: action, TargetUserID: user.ID, TargetName: user.Email}
+}
+
+// RoleChangeEvent returns the event of the role of a user changed from before
+// to after.
+func RoleChangeEvent(before db.User, after db.User) Event {
+	e := UserEvent(ActionRoleChange, after)
+	e.Details = map[string]string{"from": string(before.Role), "to": string(after.Role)}
+	return e
+}
+
+// CredentialEvent returns the event of a credential created by a user, e.g.
+// an API token. kind tells which one it is.
+func CredentialEvent(kind string, id string, name string) Event {
+	return Event{Action: ActionCredentialCreate, TargetName: name, Details: map[string]string{"type": kind, "id": id}}
+}
+
+// CredentialRevokeEvent returns the event of a credential revoked by a user.
+func CredentialRevokeEvent(kind string, id string, name string) Event {
+	e := CredentialEvent(kind, id, name)
+	e.Action = ActionCredentialRevoke
+	return e
+}
+
+// MoveEvent returns the event of a file moved and/or renamed from before to
+// after. Moves record the old and new parent, which is empty for the top of
+// the tree.
+func MoveEvent(before db.File, after db.File) Event {
+	if before.ParentID == after.ParentID {
+		e := FileEvent(ActionRename, after)
+		e.Details = map[string]string{"from": before.Name, "to": after.Name}
+		return e
+	}
+
+	e := FileEvent(ActionMove, after)
+	e.Details = map[string]string{"from_parent_id": before.ParentID.String, "to_parent_id": after.ParentID.String}
+	if before.Name != after.Name {
+		e.Details["from"] = before.Name
+		e.Details["to"] = after.Name
+	}
+	return e
+}
+
+// Record appends an event done by user to the log, along with the client of
+// the request in ctx. Failures are only logged, they shouldn't fail the
+// action itself.
+func (l *Log) Record(ctx context.Context, user *db.User, e Event) {
+	l.record(ctx, user.OrganisationID, pgtype.Text{String: user.ID, Valid: true}, e)
+}
+
+// RecordWithoutActor appends an event that no user of the organisation did,
+// e.g. a change of the identity provider through SCIM.
+func (l *Log) RecordWithoutActor(ctx context.Context, organisationID string, e Event) {
+	l.record(ctx, organisationID, pgtype.Text{}, e)
+}
+
+func (l *Log) record(ctx context.Context, organisationID string, userID pgtype.Text, e Event) {
+	details, err := json.Marshal(e.Details)
+	if err != nil || e.Details == nil {
+		details = []byte("{}")
+	}
+
+	client := middleware.GetClient(ctx)
+
+	err = l.DB.AuditEventCreate(ctx, db.AuditEventCreateParams{
+		OrganisationID: organisationID,
+		UserID:         userID,
+		Action:         e.Action,
+		FileID:         pgtype.Text{String: e.FileID, Valid: e.FileID != ""},
+		TargetUserID:   pgtype.Text{String: e.TargetUserID, Valid: e.TargetUserID != ""},
+		TargetName:     e.TargetName,
+		Details:        details,
+		IpAddress:      pgtype.Text{String: client.IP, Valid: client.IP != ""},
+		UserAgent:      client.UserAgent,
+	})
+	if err != nil {
+		slog.Error("error recording audit event", "action", e.Action, "user", userID.String, "err", err)
+	}
+}
+
+// Filter selects events of the log. Empty fields match all events.
+type Filter struct {
+	// UserID is the actor.
+	UserID  string
+	Actions []db.AuditAction
+	FileID  string
+	// After and Before limit the time of the events, After is inclusive.
+	After  time.Time
+	Before time.Time
+}
+
+// cursor is the position after the last event of a page.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+}
+
+func (c cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Events returns a page of the events of an organisation matching the
+// filter, the latest first, and the cursor of the next page, which is empty
+// on the last page.
+func (l *Log) Events(ctx context.Context, organisationID string, f Filter, limit int, after string) ([]db.AuditEvent, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := l.query(organisationID, f)
+	if after != "" {
+		c, err := parseCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", c.CreatedAt, c.ID)
+	}
+
+	// One more row than fits tells if there is another page
+	events, err := database.ScanSelectMany[db.AuditEvent](l.DB, ctx, query.Limit(uint64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(events) <= limit {
+		return events, "", nil
+	}
+
+	last := events[limit-1]
+	return events[:limit], cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String(), nil
+}
+
+// Export calls fn for every event of an organisation matching the filter,
+// the latest first.
+func (l *Log) Export(ctx context.Context, organisationID string, f Filter, fn func(db.AuditEvent) error) error {
+	after := ""
+	for {
+		events, next, err := l.Events(ctx, organisationID, f, MaxPageSize, after)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			err = fn(event)
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		after = next
+	}
+}
+
+func (l *Log) query(organisationID string, f Filter) squirrel.SelectBuilder {
+	query := l.DB.NewQueryBuilder().
+		Select("*").
+		From("audit_events").
+		Where(squirrel.Eq{"organisation_id": organisationID}).
+		OrderBy("created_at DESC", "id DESC")
+
+	if f.UserID != "" {
+		query = query.Where(squirrel.Eq{"user_id": f.UserID})
+	}
+	if len(f.Actions) > 0 {
+		query = query.Where(squirrel.Eq{"action": f.Actions})
+	}
+	if f.FileID != "" {
+		query = query.Where(squirrel.Eq{"file_id": f.FileID})
+	}
+	if !f.After.IsZero() {
+		query = query.Where(squirrel.GtOrEq{"created_at": f.After})
+	}
+	if !f.Before.IsZero() {
+		query = query.Where(squirrel.Lt{"created_at": f.Before})
+	}
+	return query
+}
+
+// Prune deletes the events older than the retention period and returns how
+// many there were.
+func (l *Log) Prune(ctx context.Context) (int64, error) {
+	if l.Retention == 0 {
+		return 0, nil
+	}
+
+	return l.DB.AuditEventDeleteBefore(ctx, pgtype.Timestamptz{Time: time.Now().Add(-l.Retention), Valid: true})
+}
@@ -12,9 +12,9 @@ import (
 )
 
 const fileCreate = `-- name: FileCreate :one
-INSERT INTO files (name, mime_type, file_size, parent_id, organisation_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+INSERT INTO files (name, mime_type, file_size, parent_id, organisation_id, owner_id, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $6)
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 `
 
 type FileCreateParams struct {
@@ -23,6 +23,7 @@ type FileCreateParams struct {
 	FileSize       int64       `db:"file_size" json:"file_size"`
 	ParentID       pgtype.Text `db:"parent_id" json:"parent_id"`
 	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	CreatedBy      pgtype.Text `db:"created_by" json:"created_by"`
 }
 
 func (q *Queries) FileCreate(ctx context.Context, arg FileCreateParams) (File, error) {
@@ -32,6 +33,7 @@ func (q *Queries) FileCreate(ctx context.Context, arg FileCreateParams) (File, e
 		arg.FileSize,
 		arg.ParentID,
 		arg.OrganisationID,
+		arg.CreatedBy,
 	)
 	var i File
 	err := row.Scan(
@@ -45,23 +47,42 @@ func (q *Queries) FileCreate(ctx context.Context, arg FileCreateParams) (File, e
 		&i.OrganisationID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
 	)
 	return i, err
 }
 
 const fileCreateFolder = `-- name: FileCreateFolder :one
-INSERT INTO files (name, mime_type, file_size, is_folder, organisation_id)
-VALUES ($1, 'directory', 0,  true, $2)
-RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+INSERT INTO files (name, mime_type, file_size, is_folder, parent_id, organisation_id, owner_id, created_by)
+VALUES ($1, 'directory', 0, TRUE, $2, $3, $4, $4)
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 `
 
 type FileCreateFolderParams struct {
-	Name           string `db:"name" json:"name"`
-	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+	Name           string      `db:"name" json:"name"`
+	ParentID       pgtype.Text `db:"parent_id" json:"parent_id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	CreatedBy      pgtype.Text `db:"created_by" json:"created_by"`
 }
 
 func (q *Queries) FileCreateFolder(ctx context.Context, arg FileCreateFolderParams) (File, error) {
-	row := q.db.QueryRow(ctx, fileCreateFolder, arg.Name, arg.OrganisationID)
+	row := q.db.QueryRow(ctx, fileCreateFolder,
+		arg.Name,
+		arg.ParentID,
+		arg.OrganisationID,
+		arg.CreatedBy,
+	)
 	var i File
 	err := row.Scan(
 		&i.ID,
@@ -74,23 +95,137 @@ func (q *Queries) FileCreateFolder(ctx context.Context, arg FileCreateFolderPara
 		&i.OrganisationID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
 	)
 	return i, err
 }
 
 const fileFindAll = `-- name: FileFindAll :many
-SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 FROM files
 WHERE deleted_at IS NULL
   AND parent_id IS NULL
   AND shared_drive IS FALSE
   AND organisation_id = $1
+  AND owner_id = $2
   AND deleted_at IS NULL
 ORDER BY is_folder DESC, name
 `
 
-func (q *Queries) FileFindAll(ctx context.Context, organisationID string) ([]File, error) {
-	rows, err := q.db.Query(ctx, fileFindAll, organisationID)
+type FileFindAllParams struct {
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	OwnerID        pgtype.Text `db:"owner_id" json:"owner_id"`
+}
+
+func (q *Queries) FileFindAll(ctx context.Context, arg FileFindAllParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindAll, arg.OrganisationID, arg.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.MimeType,
+			&i.FileSize,
+			&i.ParentID,
+			&i.IsFolder,
+			&i.SharedDrive,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindAncestorIDs = `-- name: FileFindAncestorIDs :many
+WITH RECURSIVE ancestors AS (SELECT files.id, files.parent_id
+                             FROM files
+                             WHERE files.id = $1
+                             UNION ALL
+                             SELECT f.id, f.parent_id
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT id
+FROM ancestors
+`
+
+func (q *Queries) FileFindAncestorIDs(ctx context.Context, id string) ([]string, error) {
+	rows, err := q.db.Query(ctx, fileFindAncestorIDs, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindAncestors = `-- name: FileFindAncestors :many
+WITH RECURSIVE ancestors AS (SELECT files.id, files.parent_id, 0 AS depth
+                             FROM files
+                             WHERE files.id = $1
+                               AND files.organisation_id = $2
+                             UNION ALL
+                             SELECT f.id, f.parent_id, a.depth + 1
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT f.id, f.name, f.mime_type, f.file_size, f.parent_id, f.is_folder, f.shared_drive, f.organisation_id, f.created_at, f.deleted_at, f.blob_hash, f.sha256, f.md5, f.scrubbed_at, f.corrupted_at, f.thumbnailed_at, f.has_thumbnail, f.extracted_at, f.updated_at, f.owner_id, f.created_by, f.purged_at
+FROM ancestors a
+         INNER JOIN files f ON f.id = a.id
+ORDER BY a.depth DESC
+`
+
+type FileFindAncestorsParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+// Returns the file and all of its ancestors, the top-level one first.
+func (q *Queries) FileFindAncestors(ctx context.Context, arg FileFindAncestorsParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindAncestors, arg.ID, arg.OrganisationID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +244,18 @@ func (q *Queries) FileFindAll(ctx context.Context, organisationID string) ([]Fil
 			&i.OrganisationID,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -121,7 +268,7 @@ func (q *Queries) FileFindAll(ctx context.Context, organisationID string) ([]Fil
 }
 
 const fileFindByID = `-- name: FileFindByID :one
-SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 FROM files
 WHERE id = $1
   AND organisation_id = $2
@@ -147,17 +294,29 @@ func (q *Queries) FileFindByID(ctx context.Context, arg FileFindByIDParams) (Fil
 		&i.OrganisationID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
 	)
 	return i, err
 }
 
 const fileFindByParentID = `-- name: FileFindByParentID :many
-SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 FROM files
 WHERE parent_id = $1
   AND organisation_id = $2
   AND deleted_at IS NULL
-ORDER BY is_folder, name
+ORDER BY is_folder DESC, name
 `
 
 type FileFindByParentIDParams struct {
@@ -185,6 +344,134 @@ func (q *Queries) FileFindByParentID(ctx context.Context, arg FileFindByParentID
 			&i.OrganisationID,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindChild = `-- name: FileFindChild :one
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE parent_id IS NOT DISTINCT FROM $1
+  AND name = $2
+  AND shared_drive = $3
+  AND organisation_id = $4
+  AND ($5::text IS NULL OR owner_id = $5)
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT 1
+`
+
+type FileFindChildParams struct {
+	ParentID       pgtype.Text `db:"parent_id" json:"parent_id"`
+	Name           string      `db:"name" json:"name"`
+	SharedDrive    bool        `db:"shared_drive" json:"shared_drive"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	OwnerID        pgtype.Text `db:"owner_id" json:"owner_id"`
+}
+
+func (q *Queries) FileFindChild(ctx context.Context, arg FileFindChildParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileFindChild,
+		arg.ParentID,
+		arg.Name,
+		arg.SharedDrive,
+		arg.OrganisationID,
+		arg.OwnerID,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
+const fileFindContentAfter = `-- name: FileFindContentAfter :many
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE is_folder IS FALSE
+  AND shared_drive IS FALSE
+  AND purged_at IS NULL
+  AND id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type FileFindContentAfterParams struct {
+	After    string `db:"after" json:"after"`
+	MaxCount int32  `db:"max_count" json:"max_count"`
+}
+
+func (q *Queries) FileFindContentAfter(ctx context.Context, arg FileFindContentAfterParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindContentAfter, arg.After, arg.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.MimeType,
+			&i.FileSize,
+			&i.ParentID,
+			&i.IsFolder,
+			&i.SharedDrive,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -196,13 +483,40 @@ func (q *Queries) FileFindByParentID(ctx context.Context, arg FileFindByParentID
 	return items, nil
 }
 
+const fileFindExistingIDs = `-- name: FileFindExistingIDs :many
+SELECT id
+FROM files
+WHERE id = ANY ($1::text[])
+  AND purged_at IS NULL
+`
+
+func (q *Queries) FileFindExistingIDs(ctx context.Context, ids []string) ([]string, error) {
+	rows, err := q.db.Query(ctx, fileFindExistingIDs, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const fileFindSharedDrives = `-- name: FileFindSharedDrives :many
-SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 FROM files
 WHERE shared_drive IS TRUE
   AND organisation_id = $1
   AND deleted_at IS NULL
-ORDER BY is_folder, name
+ORDER BY is_folder DESC, name
 `
 
 func (q *Queries) FileFindSharedDrives(ctx context.Context, organisationID string) ([]File, error) {
@@ -225,6 +539,18 @@ func (q *Queries) FileFindSharedDrives(ctx context.Context, organisationID strin
 			&i.OrganisationID,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -237,9 +563,11 @@ func (q *Queries) FileFindSharedDrives(ctx context.Context, organisationID strin
 }
 
 const fileFindTrashed = `-- name: FileFindTrashed :many
-SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 FROM files
-WHERE deleted_at IS NOT NULL AND organisation_id = $1
+WHERE deleted_at IS NOT NULL
+  AND purged_at IS NULL
+  AND organisation_id = $1
 `
 
 func (q *Queries) FileFindTrashed(ctx context.Context, organisationID string) ([]File, error) {
@@ -262,6 +590,343 @@ func (q *Queries) FileFindTrashed(ctx context.Context, organisationID string) ([
 			&i.OrganisationID,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindTrashedByID = `-- name: FileFindTrashedByID :one
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NOT NULL
+  AND purged_at IS NULL
+`
+
+type FileFindTrashedByIDParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+// Finds a file that was moved to the trash itself, not through a folder.
+func (q *Queries) FileFindTrashedByID(ctx context.Context, arg FileFindTrashedByIDParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileFindTrashedByID, arg.ID, arg.OrganisationID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
+const fileFindUnextracted = `-- name: FileFindUnextracted :many
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE extracted_at IS NULL
+  AND is_folder IS FALSE
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT $1
+`
+
+func (q *Queries) FileFindUnextracted(ctx context.Context, maxCount int32) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindUnextracted, maxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.MimeType,
+			&i.FileSize,
+			&i.ParentID,
+			&i.IsFolder,
+			&i.SharedDrive,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindUnscrubbed = `-- name: FileFindUnscrubbed :many
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE is_folder IS FALSE
+  AND shared_drive IS FALSE
+  AND deleted_at IS NULL
+  AND (scrubbed_at IS NULL OR scrubbed_at < $1)
+ORDER BY scrubbed_at NULLS FIRST
+LIMIT $2
+`
+
+type FileFindUnscrubbedParams struct {
+	ScrubbedBefore pgtype.Timestamptz `db:"scrubbed_before" json:"scrubbed_before"`
+	MaxCount       int32              `db:"max_count" json:"max_count"`
+}
+
+func (q *Queries) FileFindUnscrubbed(ctx context.Context, arg FileFindUnscrubbedParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindUnscrubbed, arg.ScrubbedBefore, arg.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.MimeType,
+			&i.FileSize,
+			&i.ParentID,
+			&i.IsFolder,
+			&i.SharedDrive,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileFindUnthumbnailed = `-- name: FileFindUnthumbnailed :many
+SELECT id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+FROM files
+WHERE thumbnailed_at IS NULL
+  AND is_folder IS FALSE
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT $1
+`
+
+func (q *Queries) FileFindUnthumbnailed(ctx context.Context, maxCount int32) ([]File, error) {
+	rows, err := q.db.Query(ctx, fileFindUnthumbnailed, maxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.MimeType,
+			&i.FileSize,
+			&i.ParentID,
+			&i.IsFolder,
+			&i.SharedDrive,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.BlobHash,
+			&i.Sha256,
+			&i.Md5,
+			&i.ScrubbedAt,
+			&i.CorruptedAt,
+			&i.ThumbnailedAt,
+			&i.HasThumbnail,
+			&i.ExtractedAt,
+			&i.UpdatedAt,
+			&i.OwnerID,
+			&i.CreatedBy,
+			&i.PurgedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const fileMove = `-- name: FileMove :one
+UPDATE files
+SET parent_id  = $1,
+    name       = $2,
+    updated_at = NOW()
+WHERE id = $3
+  AND organisation_id = $4
+  AND deleted_at IS NULL
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+`
+
+type FileMoveParams struct {
+	ParentID       pgtype.Text `db:"parent_id" json:"parent_id"`
+	Name           string      `db:"name" json:"name"`
+	ID             string      `db:"id" json:"id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) FileMove(ctx context.Context, arg FileMoveParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileMove,
+		arg.ParentID,
+		arg.Name,
+		arg.ID,
+		arg.OrganisationID,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
+const filePurge = `-- name: FilePurge :many
+WITH RECURSIVE purged AS ((SELECT id
+                           FROM files
+                           WHERE deleted_at < $1
+                             AND purged_at IS NULL
+                           ORDER BY deleted_at
+                           LIMIT $2)
+                          UNION
+                          SELECT f.id
+                          FROM files f
+                                   INNER JOIN purged p ON f.parent_id = p.id
+                          WHERE f.purged_at IS NULL),
+     old AS (SELECT id, blob_hash
+             FROM files
+             WHERE id IN (SELECT id FROM purged)
+                 FOR UPDATE)
+UPDATE files
+SET purged_at  = NOW(),
+    deleted_at = COALESCE(files.deleted_at, NOW()),
+    blob_hash  = NULL
+FROM old
+WHERE files.id = old.id
+RETURNING files.id, files.is_folder, old.blob_hash
+`
+
+type FilePurgeParams struct {
+	Before   pgtype.Timestamptz `db:"before" json:"before"`
+	MaxCount int32              `db:"max_count" json:"max_count"`
+}
+
+type FilePurgeRow struct {
+	ID       string      `db:"id" json:"id"`
+	IsFolder bool        `db:"is_folder" json:"is_folder"`
+	BlobHash pgtype.Text `db:"blob_hash" json:"blob_hash"`
+}
+
+// Purges the files in the trash since before, and the files in them. Their
+// old blobs are returned to be released.
+func (q *Queries) FilePurge(ctx context.Context, arg FilePurgeParams) ([]FilePurgeRow, error) {
+	rows, err := q.db.Query(ctx, filePurge, arg.Before, arg.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FilePurgeRow
+	for rows.Next() {
+		var i FilePurgeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.IsFolder,
+			&i.BlobHash,
 		); err != nil {
 			return nil, err
 		}
@@ -273,6 +938,50 @@ func (q *Queries) FileFindTrashed(ctx context.Context, organisationID string) ([
 	return items, nil
 }
 
+const fileRestore = `-- name: FileRestore :one
+UPDATE files
+SET deleted_at = NULL
+WHERE id = $1
+  AND organisation_id = $2
+  AND purged_at IS NULL
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+`
+
+type FileRestoreParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) FileRestore(ctx context.Context, arg FileRestoreParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileRestore, arg.ID, arg.OrganisationID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
 const fileSoftDelete = `-- name: FileSoftDelete :exec
 UPDATE files
 SET deleted_at = NOW()
@@ -284,11 +993,160 @@ func (q *Queries) FileSoftDelete(ctx context.Context, id string) error {
 	return err
 }
 
+const fileSumSize = `-- name: FileSumSize :one
+SELECT COALESCE(SUM(file_size), 0)::bigint AS total
+FROM files
+WHERE organisation_id = $1
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) FileSumSize(ctx context.Context, organisationID string) (int64, error) {
+	row := q.db.QueryRow(ctx, fileSumSize, organisationID)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
+
+const fileTransfer = `-- name: FileTransfer :one
+UPDATE files
+SET owner_id = $1
+WHERE id = $2
+  AND organisation_id = $3
+  AND deleted_at IS NULL
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+`
+
+type FileTransferParams struct {
+	OwnerID        pgtype.Text `db:"owner_id" json:"owner_id"`
+	ID             string      `db:"id" json:"id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) FileTransfer(ctx context.Context, arg FileTransferParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileTransfer, arg.OwnerID, arg.ID, arg.OrganisationID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
+const fileUpdateContent = `-- name: FileUpdateContent :one
+UPDATE files
+SET file_size      = $1,
+    mime_type      = $2,
+    blob_hash      = $3,
+    sha256         = $4,
+    md5            = $5,
+    scrubbed_at    = NOW(),
+    corrupted_at   = NULL,
+    thumbnailed_at = NULL,
+    has_thumbnail  = FALSE,
+    extracted_at   = NULL,
+    updated_at     = NOW()
+WHERE id = $6
+  AND organisation_id = $7
+  AND deleted_at IS NULL
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
+`
+
+type FileUpdateContentParams struct {
+	FileSize       int64       `db:"file_size" json:"file_size"`
+	MimeType       string      `db:"mime_type" json:"mime_type"`
+	BlobHash       pgtype.Text `db:"blob_hash" json:"blob_hash"`
+	Sha256         pgtype.Text `db:"sha256" json:"sha256"`
+	Md5            pgtype.Text `db:"md5" json:"md5"`
+	ID             string      `db:"id" json:"id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) FileUpdateContent(ctx context.Context, arg FileUpdateContentParams) (File, error) {
+	row := q.db.QueryRow(ctx, fileUpdateContent,
+		arg.FileSize,
+		arg.MimeType,
+		arg.BlobHash,
+		arg.Sha256,
+		arg.Md5,
+		arg.ID,
+		arg.OrganisationID,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.MimeType,
+		&i.FileSize,
+		&i.ParentID,
+		&i.IsFolder,
+		&i.SharedDrive,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
+	)
+	return i, err
+}
+
+const fileUpdateExtracted = `-- name: FileUpdateExtracted :execrows
+UPDATE files
+SET extracted_at = NOW()
+WHERE id = $1
+  AND sha256 IS NOT DISTINCT FROM $2
+`
+
+type FileUpdateExtractedParams struct {
+	ID     string      `db:"id" json:"id"`
+	Sha256 pgtype.Text `db:"sha256" json:"sha256"`
+}
+
+func (q *Queries) FileUpdateExtracted(ctx context.Context, arg FileUpdateExtractedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, fileUpdateExtracted, arg.ID, arg.Sha256)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const fileUpdateName = `-- name: FileUpdateName :one
 UPDATE files
-SET name = $1
-WHERE id = $2 AND organisation_id = $3 AND deleted_at IS NULL
-RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at
+SET name       = $1,
+    updated_at = NOW()
+WHERE id = $2
+  AND organisation_id = $3
+  AND deleted_at IS NULL
+RETURNING id, name, mime_type, file_size, parent_id, is_folder, shared_drive, organisation_id, created_at, deleted_at, blob_hash, sha256, md5, scrubbed_at, corrupted_at, thumbnailed_at, has_thumbnail, extracted_at, updated_at, owner_id, created_by, purged_at
 `
 
 type FileUpdateNameParams struct {
@@ -311,6 +1169,63 @@ func (q *Queries) FileUpdateName(ctx context.Context, arg FileUpdateNameParams)
 		&i.OrganisationID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.BlobHash,
+		&i.Sha256,
+		&i.Md5,
+		&i.ScrubbedAt,
+		&i.CorruptedAt,
+		&i.ThumbnailedAt,
+		&i.HasThumbnail,
+		&i.ExtractedAt,
+		&i.UpdatedAt,
+		&i.OwnerID,
+		&i.CreatedBy,
+		&i.PurgedAt,
 	)
 	return i, err
 }
+
+const fileUpdateScrubbed = `-- name: FileUpdateScrubbed :exec
+UPDATE files
+SET scrubbed_at  = NOW(),
+    corrupted_at = CASE WHEN $1::boolean THEN COALESCE(corrupted_at, NOW()) END,
+    sha256       = COALESCE(sha256, $2),
+    md5          = COALESCE(md5, $3)
+WHERE id = $4
+`
+
+type FileUpdateScrubbedParams struct {
+	Corrupted bool        `db:"corrupted" json:"corrupted"`
+	Sha256    pgtype.Text `db:"sha256" json:"sha256"`
+	Md5       pgtype.Text `db:"md5" json:"md5"`
+	ID        string      `db:"id" json:"id"`
+}
+
+func (q *Queries) FileUpdateScrubbed(ctx context.Context, arg FileUpdateScrubbedParams) error {
+	_, err := q.db.Exec(ctx, fileUpdateScrubbed,
+		arg.Corrupted,
+		arg.Sha256,
+		arg.Md5,
+		arg.ID,
+	)
+	return err
+}
+
+const fileUpdateThumbnailed = `-- name: FileUpdateThumbnailed :exec
+UPDATE files
+SET thumbnailed_at = NOW(),
+    has_thumbnail  = $1
+WHERE id = $2
+  AND sha256 IS NOT DISTINCT FROM $3
+`
+
+type FileUpdateThumbnailedParams struct {
+	HasThumbnail bool        `db:"has_thumbnail" json:"has_thumbnail"`
+	ID           string      `db:"id" json:"id"`
+	Sha256       pgtype.Text `db:"sha256" json:"sha256"`
+}
+
+func (q *Queries) FileUpdateThumbnailed(ctx context.Context, arg FileUpdateThumbnailedParams) error {
+	_, err := q.db.Exec(ctx, fileUpdateThumbnailed, arg.HasThumbnail, arg.ID, arg.Sha256)
+	return err
+}
@@ -12,6 +12,240 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditAction string
+
+const (
+	AuditActionUpload           AuditAction = "upload"
+	AuditActionDownload         AuditAction = "download"
+	AuditActionPreview          AuditAction = "preview"
+	AuditActionRename           AuditAction = "rename"
+	AuditActionMove             AuditAction = "move"
+	AuditActionDelete           AuditAction = "delete"
+	AuditActionShare            AuditAction = "share"
+	AuditActionTransfer         AuditAction = "transfer"
+	AuditActionLogin            AuditAction = "login"
+	AuditActionRoleChange       AuditAction = "role_change"
+	AuditActionRestore          AuditAction = "restore"
+	AuditActionCredentialCreate AuditAction = "credential_create"
+	AuditActionUserCreate       AuditAction = "user_create"
+	AuditActionUserUpdate       AuditAction = "user_update"
+	AuditActionUserDeactivate   AuditAction = "user_deactivate"
+	AuditActionUserReactivate   AuditAction = "user_reactivate"
+	AuditActionCredentialRevoke AuditAction = "credential_revoke"
+)
+
+func (e *AuditAction) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AuditAction(s)
+	case string:
+		*e = AuditAction(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AuditAction: %T", src)
+	}
+	return nil
+}
+
+type NullAuditAction struct {
+	AuditAction AuditAction `json:"audit_action"`
+	Valid       bool        `json:"valid"` // Valid is true if AuditAction is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAuditAction) Scan(value interface{}) error {
+	if value == nil {
+		ns.AuditAction, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AuditAction.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAuditAction) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AuditAction), nil
+}
+
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusFailed  EmailStatus = "failed"
+)
+
+func (e *EmailStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = EmailStatus(s)
+	case string:
+		*e = EmailStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for EmailStatus: %T", src)
+	}
+	return nil
+}
+
+type NullEmailStatus struct {
+	EmailStatus EmailStatus `json:"email_status"`
+	Valid       bool        `json:"valid"` // Valid is true if EmailStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullEmailStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.EmailStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.EmailStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullEmailStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.EmailStatus), nil
+}
+
+type FileAccessKind string
+
+const (
+	FileAccessKindOpen     FileAccessKind = "open"
+	FileAccessKindDownload FileAccessKind = "download"
+	FileAccessKindEdit     FileAccessKind = "edit"
+)
+
+func (e *FileAccessKind) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = FileAccessKind(s)
+	case string:
+		*e = FileAccessKind(s)
+	default:
+		return fmt.Errorf("unsupported scan type for FileAccessKind: %T", src)
+	}
+	return nil
+}
+
+type NullFileAccessKind struct {
+	FileAccessKind FileAccessKind `json:"file_access_kind"`
+	Valid          bool           `json:"valid"` // Valid is true if FileAccessKind is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullFileAccessKind) Scan(value interface{}) error {
+	if value == nil {
+		ns.FileAccessKind, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.FileAccessKind.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullFileAccessKind) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.FileAccessKind), nil
+}
+
+type FileActivityAction string
+
+const (
+	FileActivityActionCreate   FileActivityAction = "create"
+	FileActivityActionVersion  FileActivityAction = "version"
+	FileActivityActionRename   FileActivityAction = "rename"
+	FileActivityActionMove     FileActivityAction = "move"
+	FileActivityActionDelete   FileActivityAction = "delete"
+	FileActivityActionTransfer FileActivityAction = "transfer"
+	FileActivityActionRestore  FileActivityAction = "restore"
+)
+
+func (e *FileActivityAction) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = FileActivityAction(s)
+	case string:
+		*e = FileActivityAction(s)
+	default:
+		return fmt.Errorf("unsupported scan type for FileActivityAction: %T", src)
+	}
+	return nil
+}
+
+type NullFileActivityAction struct {
+	FileActivityAction FileActivityAction `json:"file_activity_action"`
+	Valid              bool               `json:"valid"` // Valid is true if FileActivityAction is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullFileActivityAction) Scan(value interface{}) error {
+	if value == nil {
+		ns.FileActivityAction, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.FileActivityAction.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullFileActivityAction) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.FileActivityAction), nil
+}
+
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusDead      JobStatus = "dead"
+)
+
+func (e *JobStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = JobStatus(s)
+	case string:
+		*e = JobStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for JobStatus: %T", src)
+	}
+	return nil
+}
+
+type NullJobStatus struct {
+	JobStatus JobStatus `json:"job_status"`
+	Valid     bool      `json:"valid"` // Valid is true if JobStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullJobStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.JobStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.JobStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullJobStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.JobStatus), nil
+}
+
 type PermissionRole string
 
 const (
@@ -141,6 +375,121 @@ func (ns NullUserRole) Value() (driver.Value, error) {
 	return string(ns.UserRole), nil
 }
 
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+func (e *WebhookDeliveryStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = WebhookDeliveryStatus(s)
+	case string:
+		*e = WebhookDeliveryStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for WebhookDeliveryStatus: %T", src)
+	}
+	return nil
+}
+
+type NullWebhookDeliveryStatus struct {
+	WebhookDeliveryStatus WebhookDeliveryStatus `json:"webhook_delivery_status"`
+	Valid                 bool                  `json:"valid"` // Valid is true if WebhookDeliveryStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullWebhookDeliveryStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.WebhookDeliveryStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.WebhookDeliveryStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullWebhookDeliveryStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.WebhookDeliveryStatus), nil
+}
+
+type AccessKey struct {
+	ID              string             `db:"id" json:"id"`
+	UserID          string             `db:"user_id" json:"user_id"`
+	Name            string             `db:"name" json:"name"`
+	AccessKeyID     string             `db:"access_key_id" json:"access_key_id"`
+	SecretAccessKey string             `db:"secret_access_key" json:"secret_access_key"`
+	LastUsedAt      pgtype.Timestamptz `db:"last_used_at" json:"last_used_at"`
+	CreatedAt       time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt       pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
+type ApiToken struct {
+	ID         string             `db:"id" json:"id"`
+	UserID     string             `db:"user_id" json:"user_id"`
+	Name       string             `db:"name" json:"name"`
+	TokenHash  string             `db:"token_hash" json:"token_hash"`
+	LastUsedAt pgtype.Timestamptz `db:"last_used_at" json:"last_used_at"`
+	CreatedAt  time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt  pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
+type AuditEvent struct {
+	ID             string      `db:"id" json:"id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	UserID         pgtype.Text `db:"user_id" json:"user_id"`
+	Action         AuditAction `db:"action" json:"action"`
+	FileID         pgtype.Text `db:"file_id" json:"file_id"`
+	TargetUserID   pgtype.Text `db:"target_user_id" json:"target_user_id"`
+	TargetName     string      `db:"target_name" json:"target_name"`
+	Details        []byte      `db:"details" json:"details"`
+	IpAddress      pgtype.Text `db:"ip_address" json:"ip_address"`
+	UserAgent      string      `db:"user_agent" json:"user_agent"`
+	CreatedAt      time.Time   `db:"created_at" json:"created_at"`
+}
+
+type Blob struct {
+	Hash      string    `db:"hash" json:"hash"`
+	Size      int64     `db:"size" json:"size"`
+	RefCount  int64     `db:"ref_count" json:"ref_count"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ChangeSequence struct {
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+	Seq            int64  `db:"seq" json:"seq"`
+	PrunedSeq      int64  `db:"pruned_seq" json:"pruned_seq"`
+}
+
+type DataKey struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	KekID          string             `db:"kek_id" json:"kek_id"`
+	WrappedKey     []byte             `db:"wrapped_key" json:"wrapped_key"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	RotatedAt      pgtype.Timestamptz `db:"rotated_at" json:"rotated_at"`
+}
+
+type Email struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	Template       string             `db:"template" json:"template"`
+	ToAddress      string             `db:"to_address" json:"to_address"`
+	Subject        string             `db:"subject" json:"subject"`
+	Body           string             `db:"body" json:"body"`
+	Status         EmailStatus        `db:"status" json:"status"`
+	Attempts       int32              `db:"attempts" json:"attempts"`
+	Error          string             `db:"error" json:"error"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	SentAt         pgtype.Timestamptz `db:"sent_at" json:"sent_at"`
+}
+
 type File struct {
 	ID             string             `db:"id" json:"id"`
 	Name           string             `db:"name" json:"name"`
@@ -152,6 +501,36 @@ type File struct {
 	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
 	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
 	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+	BlobHash       pgtype.Text        `db:"blob_hash" json:"blob_hash"`
+	Sha256         pgtype.Text        `db:"sha256" json:"sha256"`
+	Md5            pgtype.Text        `db:"md5" json:"md5"`
+	ScrubbedAt     pgtype.Timestamptz `db:"scrubbed_at" json:"scrubbed_at"`
+	CorruptedAt    pgtype.Timestamptz `db:"corrupted_at" json:"corrupted_at"`
+	ThumbnailedAt  pgtype.Timestamptz `db:"thumbnailed_at" json:"thumbnailed_at"`
+	HasThumbnail   bool               `db:"has_thumbnail" json:"has_thumbnail"`
+	ExtractedAt    pgtype.Timestamptz `db:"extracted_at" json:"extracted_at"`
+	UpdatedAt      time.Time          `db:"updated_at" json:"updated_at"`
+	OwnerID        pgtype.Text        `db:"owner_id" json:"owner_id"`
+	CreatedBy      pgtype.Text        `db:"created_by" json:"created_by"`
+	PurgedAt       pgtype.Timestamptz `db:"purged_at" json:"purged_at"`
+}
+
+type FileAccess struct {
+	UserID     string         `db:"user_id" json:"user_id"`
+	FileID     string         `db:"file_id" json:"file_id"`
+	Kind       FileAccessKind `db:"kind" json:"kind"`
+	AccessedAt time.Time      `db:"accessed_at" json:"accessed_at"`
+}
+
+type FileActivity struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	FileID         string             `db:"file_id" json:"file_id"`
+	UserID         pgtype.Text        `db:"user_id" json:"user_id"`
+	Action         FileActivityAction `db:"action" json:"action"`
+	Details        []byte             `db:"details" json:"details"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	Seq            int64              `db:"seq" json:"seq"`
 }
 
 type FilePermission struct {
@@ -163,6 +542,66 @@ type FilePermission struct {
 	PermissionRole PermissionRole     `db:"permission_role" json:"permission_role"`
 	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
 	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+	GroupID        pgtype.Text        `db:"group_id" json:"group_id"`
+}
+
+type FileStar struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	FileID    string    `db:"file_id" json:"file_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type FileText struct {
+	FileID       string      `db:"file_id" json:"file_id"`
+	Content      string      `db:"content" json:"content"`
+	SearchVector interface{} `db:"search_vector" json:"search_vector"`
+	CreatedAt    time.Time   `db:"created_at" json:"created_at"`
+}
+
+type Group struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	Name           string             `db:"name" json:"name"`
+	ExternalID     pgtype.Text        `db:"external_id" json:"external_id"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
+type GroupMember struct {
+	GroupID   string    `db:"group_id" json:"group_id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type Job struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID pgtype.Text        `db:"organisation_id" json:"organisation_id"`
+	Kind           string             `db:"kind" json:"kind"`
+	Payload        []byte             `db:"payload" json:"payload"`
+	Status         JobStatus          `db:"status" json:"status"`
+	Attempts       int32              `db:"attempts" json:"attempts"`
+	MaxAttempts    int32              `db:"max_attempts" json:"max_attempts"`
+	RunAt          time.Time          `db:"run_at" json:"run_at"`
+	UniqueKey      pgtype.Text        `db:"unique_key" json:"unique_key"`
+	Error          string             `db:"error" json:"error"`
+	LockedAt       pgtype.Timestamptz `db:"locked_at" json:"locked_at"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	FinishedAt     pgtype.Timestamptz `db:"finished_at" json:"finished_at"`
+}
+
+type MultipartUpload struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	BucketID  string    `db:"bucket_id" json:"bucket_id"`
+	Key       string    `db:"key" json:"key"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type MultipartPart struct {
+	UploadID       string `db:"upload_id" json:"upload_id"`
+	Number         int32  `db:"number" json:"number"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+	Size           int64  `db:"size" json:"size"`
 }
 
 type Organisation struct {
@@ -174,6 +613,16 @@ type Organisation struct {
 	DeletedAt            pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
 }
 
+type ScimToken struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	Name           string             `db:"name" json:"name"`
+	TokenHash      string             `db:"token_hash" json:"token_hash"`
+	LastUsedAt     pgtype.Timestamptz `db:"last_used_at" json:"last_used_at"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
 type Session struct {
 	ID        string             `db:"id" json:"id"`
 	UserID    string             `db:"user_id" json:"user_id"`
@@ -182,6 +631,17 @@ type Session struct {
 	DeletedAt pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
 }
 
+type SshKey struct {
+	ID          string             `db:"id" json:"id"`
+	UserID      string             `db:"user_id" json:"user_id"`
+	Name        string             `db:"name" json:"name"`
+	PublicKey   string             `db:"public_key" json:"public_key"`
+	Fingerprint string             `db:"fingerprint" json:"fingerprint"`
+	LastUsedAt  pgtype.Timestamptz `db:"last_used_at" json:"last_used_at"`
+	CreatedAt   time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt   pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
 type User struct {
 	ID             string             `db:"id" json:"id"`
 	Role           UserRole           `db:"role" json:"role"`
@@ -195,4 +655,34 @@ type User struct {
 	AvatarFileID   pgtype.Text        `db:"avatar_file_id" json:"avatar_file_id"`
 	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
 	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+	ExternalID     pgtype.Text        `db:"external_id" json:"external_id"`
+}
+
+type Webhook struct {
+	ID             string             `db:"id" json:"id"`
+	OrganisationID string             `db:"organisation_id" json:"organisation_id"`
+	Url            string             `db:"url" json:"url"`
+	Secret         string             `db:"secret" json:"secret"`
+	EventTypes     []string           `db:"event_types" json:"event_types"`
+	FailureCount   int32              `db:"failure_count" json:"failure_count"`
+	DisabledAt     pgtype.Timestamptz `db:"disabled_at" json:"disabled_at"`
+	CreatedAt      time.Time          `db:"created_at" json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `db:"deleted_at" json:"deleted_at"`
+}
+
+type WebhookDelivery struct {
+	ID             string                `db:"id" json:"id"`
+	OrganisationID string                `db:"organisation_id" json:"organisation_id"`
+	WebhookID      string                `db:"webhook_id" json:"webhook_id"`
+	EventID        string                `db:"event_id" json:"event_id"`
+	EventType      string                `db:"event_type" json:"event_type"`
+	Payload        []byte                `db:"payload" json:"payload"`
+	Status         WebhookDeliveryStatus `db:"status" json:"status"`
+	Attempts       int32                 `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time             `db:"next_attempt_at" json:"next_attempt_at"`
+	ResponseStatus pgtype.Int4           `db:"response_status" json:"response_status"`
+	ResponseBody   string                `db:"response_body" json:"response_body"`
+	Error          string                `db:"error" json:"error"`
+	CreatedAt      time.Time             `db:"created_at" json:"created_at"`
+	DeliveredAt    pgtype.Timestamptz    `db:"delivered_at" json:"delivered_at"`
 }
@@ -12,7 +12,9 @@ import (
 )
 
 const createOrganisation = `-- name: CreateOrganisation :one
-INSERT INTO organisations (name) VALUES ($1) RETURNING id, name, stripe_customer_id, stripe_subscription_id, created_at, deleted_at
+INSERT INTO organisations (name)
+VALUES ($1)
+RETURNING id, name, stripe_customer_id, stripe_subscription_id, created_at, deleted_at
 `
 
 func (q *Queries) CreateOrganisation(ctx context.Context, name string) (Organisation, error) {
@@ -30,7 +32,9 @@ func (q *Queries) CreateOrganisation(ctx context.Context, name string) (Organisa
 }
 
 const createSession = `-- name: CreateSession :one
-INSERT INTO sessions (user_id, token ) VALUES ($1, $2) RETURNING id, user_id, token, created_at, deleted_at
+INSERT INTO sessions (user_id, token)
+VALUES ($1, $2)
+RETURNING id, user_id, token, created_at, deleted_at
 `
 
 type CreateSessionParams struct {
@@ -52,7 +56,9 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (email, first_name, last_name, organisation_id, role) VALUES ($1, $2, $3, $4, $5) RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+INSERT INTO users (email, first_name, last_name, organisation_id, role)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 `
 
 type CreateUserParams struct {
@@ -85,12 +91,14 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const gLOBAL_UserFindBySessionToken = `-- name: GLOBAL_UserFindBySessionToken :one
-SELECT users.id, users.role, users.organisation_id, users.first_name, users.last_name, users.email, users.password, users.recovery_token, users.recovery_sent_at, users.avatar_file_id, users.created_at, users.deleted_at
+SELECT
+    users.id, users.role, users.organisation_id, users.first_name, users.last_name, users.email, users.password, users.recovery_token, users.recovery_sent_at, users.avatar_file_id, users.created_at, users.deleted_at, users.external_id
 FROM users
          INNER JOIN public.sessions s ON users.id = s.user_id
 WHERE s.token = $1
@@ -114,6 +122,7 @@ func (q *Queries) GLOBAL_UserFindBySessionToken(ctx context.Context, token strin
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
@@ -139,6 +148,18 @@ func (q *Queries) OrganisationFindByName(ctx context.Context, name string) (Orga
 	return i, err
 }
 
+const removeAllSessions = `-- name: RemoveAllSessions :exec
+UPDATE sessions
+SET deleted_at = NOW()
+WHERE user_id = $1
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) RemoveAllSessions(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, removeAllSessions, userID)
+	return err
+}
+
 const removeSession = `-- name: RemoveSession :one
 UPDATE sessions
 SET deleted_at = NOW()
@@ -168,10 +189,11 @@ func (q *Queries) RemoveSession(ctx context.Context, arg RemoveSessionParams) (S
 
 const resetUserConfirmationToken = `-- name: ResetUserConfirmationToken :one
 UPDATE users
-SET recovery_token = NULL, recovery_sent_at = NULL
+SET recovery_token   = NULL,
+    recovery_sent_at = NULL
 WHERE id = $1
   AND deleted_at IS NULL
-RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 `
 
 func (q *Queries) ResetUserConfirmationToken(ctx context.Context, id string) (User, error) {
@@ -190,16 +212,18 @@ func (q *Queries) ResetUserConfirmationToken(ctx context.Context, id string) (Us
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const updateUserConfirmationToken = `-- name: UpdateUserConfirmationToken :one
 UPDATE users
-SET recovery_token = $1, recovery_sent_at = $2
+SET recovery_token   = $1,
+    recovery_sent_at = $2
 WHERE id = $3
   AND deleted_at IS NULL
-RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 `
 
 type UpdateUserConfirmationTokenParams struct {
@@ -224,12 +248,31 @@ func (q *Queries) UpdateUserConfirmationToken(ctx context.Context, arg UpdateUse
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
+const userArchive = `-- name: UserArchive :exec
+UPDATE users
+SET deleted_at = NOW()
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL
+`
+
+type UserArchiveParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) UserArchive(ctx context.Context, arg UserArchiveParams) error {
+	_, err := q.db.Exec(ctx, userArchive, arg.ID, arg.OrganisationID)
+	return err
+}
+
 const userFind = `-- name: UserFind :one
-SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 FROM users
 WHERE id = $1
   AND organisation_id = $2
@@ -257,12 +300,13 @@ func (q *Queries) UserFind(ctx context.Context, arg UserFindParams) (User, error
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const userFindByEmail = `-- name: UserFindByEmail :one
-SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 FROM users
 WHERE email = $1
   AND deleted_at IS NULL
@@ -284,12 +328,13 @@ func (q *Queries) UserFindByEmail(ctx context.Context, email string) (User, erro
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const userFindByID = `-- name: UserFindByID :one
-SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 FROM users
 WHERE id = $1
   AND deleted_at IS NULL
@@ -311,12 +356,13 @@ func (q *Queries) UserFindByID(ctx context.Context, id string) (User, error) {
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const userFindByToken = `-- name: UserFindByToken :one
-SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at
+SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
 FROM users
 WHERE recovery_token = $1
   AND deleted_at IS NULL
@@ -338,6 +384,184 @@ func (q *Queries) UserFindByToken(ctx context.Context, recoveryToken pgtype.Text
 		&i.AvatarFileID,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const userFindIncludingArchived = `-- name: UserFindIncludingArchived :one
+SELECT id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
+FROM users
+WHERE id = $1
+  AND organisation_id = $2
+`
+
+type UserFindIncludingArchivedParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) UserFindIncludingArchived(ctx context.Context, arg UserFindIncludingArchivedParams) (User, error) {
+	row := q.db.QueryRow(ctx, userFindIncludingArchived, arg.ID, arg.OrganisationID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.OrganisationID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.RecoveryToken,
+		&i.RecoverySentAt,
+		&i.AvatarFileID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const userProvision = `-- name: UserProvision :one
+INSERT INTO users (email, first_name, last_name, organisation_id, role, external_id)
+VALUES ($1, $2, $3, $4, 'user', $5)
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
+`
+
+type UserProvisionParams struct {
+	Email          string      `db:"email" json:"email"`
+	FirstName      string      `db:"first_name" json:"first_name"`
+	LastName       string      `db:"last_name" json:"last_name"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+	ExternalID     pgtype.Text `db:"external_id" json:"external_id"`
+}
+
+func (q *Queries) UserProvision(ctx context.Context, arg UserProvisionParams) (User, error) {
+	row := q.db.QueryRow(ctx, userProvision,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.OrganisationID,
+		arg.ExternalID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.OrganisationID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.RecoveryToken,
+		&i.RecoverySentAt,
+		&i.AvatarFileID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const userRestore = `-- name: UserRestore :exec
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NOT NULL
+`
+
+type UserRestoreParams struct {
+	ID             string `db:"id" json:"id"`
+	OrganisationID string `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) UserRestore(ctx context.Context, arg UserRestoreParams) error {
+	_, err := q.db.Exec(ctx, userRestore, arg.ID, arg.OrganisationID)
+	return err
+}
+
+const userUpdateProfile = `-- name: UserUpdateProfile :one
+UPDATE users
+SET email       = $1,
+    first_name  = $2,
+    last_name   = $3,
+    external_id = $4
+WHERE id = $5
+  AND organisation_id = $6
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
+`
+
+type UserUpdateProfileParams struct {
+	Email          string      `db:"email" json:"email"`
+	FirstName      string      `db:"first_name" json:"first_name"`
+	LastName       string      `db:"last_name" json:"last_name"`
+	ExternalID     pgtype.Text `db:"external_id" json:"external_id"`
+	ID             string      `db:"id" json:"id"`
+	OrganisationID string      `db:"organisation_id" json:"organisation_id"`
+}
+
+func (q *Queries) UserUpdateProfile(ctx context.Context, arg UserUpdateProfileParams) (User, error) {
+	row := q.db.QueryRow(ctx, userUpdateProfile,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.ExternalID,
+		arg.ID,
+		arg.OrganisationID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.OrganisationID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.RecoveryToken,
+		&i.RecoverySentAt,
+		&i.AvatarFileID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const userUpdateRole = `-- name: UserUpdateRole :one
+UPDATE users
+SET role = $1
+WHERE id = $2
+  AND organisation_id = $3
+  AND role <> 'owner'
+RETURNING id, role, organisation_id, first_name, last_name, email, password, recovery_token, recovery_sent_at, avatar_file_id, created_at, deleted_at, external_id
+`
+
+type UserUpdateRoleParams struct {
+	Role           UserRole `db:"role" json:"role"`
+	ID             string   `db:"id" json:"id"`
+	OrganisationID string   `db:"organisation_id" json:"organisation_id"`
+}
+
+// Owners keep their role, they aren't managed by identity providers.
+func (q *Queries) UserUpdateRole(ctx context.Context, arg UserUpdateRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, userUpdateRole, arg.Role, arg.ID, arg.OrganisationID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Role,
+		&i.OrganisationID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.RecoveryToken,
+		&i.RecoverySentAt,
+		&i.AvatarFileID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.ExternalID,
 	)
 	return i, err
 }
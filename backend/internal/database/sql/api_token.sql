@@ -0,0 +1,31 @@
+-- name: ApiTokenCreate :one
+INSERT INTO api_tokens (name, token_hash, user_id)
+VALUES (@name, @token_hash, @user_id)
+RETURNING *;
+
+-- name: ApiTokenFindAll :many
+SELECT *
+FROM api_tokens
+WHERE user_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: ApiTokenRevoke :exec
+UPDATE api_tokens
+SET deleted_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND deleted_at IS NULL;
+
+-- name: GLOBAL_UserFindByApiToken :one
+SELECT users.*
+FROM users
+         INNER JOIN api_tokens t ON users.id = t.user_id
+WHERE t.token_hash = $1
+  AND users.deleted_at IS NULL
+  AND t.deleted_at IS NULL;
+
+-- name: ApiTokenTouch :exec
+UPDATE api_tokens
+SET last_used_at = NOW()
+WHERE token_hash = $1;
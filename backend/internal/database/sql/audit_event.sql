@@ -0,0 +1,9 @@
+-- name: AuditEventCreate :exec
+INSERT INTO audit_events (organisation_id, user_id, action, file_id, target_user_id, target_name, details, ip_address,
+                          user_agent)
+VALUES (@organisation_id, @user_id, @action, @file_id, @target_user_id, @target_name, @details, @ip_address, @user_agent);
+
+-- name: AuditEventDeleteBefore :execrows
+DELETE
+FROM audit_events
+WHERE created_at < @before;
@@ -0,0 +1,30 @@
+-- name: BlobRetain :exec
+INSERT INTO blobs (hash, size, ref_count)
+VALUES (@hash, @size, 1)
+ON CONFLICT (hash) DO UPDATE
+    SET ref_count  = blobs.ref_count + 1,
+        updated_at = NOW();
+
+-- name: BlobRelease :exec
+UPDATE blobs
+SET ref_count  = ref_count - 1,
+    updated_at = NOW()
+WHERE hash = $1;
+
+-- name: BlobFindUnreferenced :many
+SELECT *
+FROM blobs
+WHERE ref_count <= 0
+ORDER BY updated_at
+LIMIT $1 FOR UPDATE SKIP LOCKED;
+
+-- name: BlobDelete :exec
+DELETE
+FROM blobs
+WHERE hash = $1
+  AND ref_count <= 0;
+
+-- name: BlobFindExistingHashes :many
+SELECT hash
+FROM blobs
+WHERE hash = ANY (@hashes::text[]);
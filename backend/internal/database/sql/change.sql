@@ -0,0 +1,29 @@
+-- name: ChangeSequenceNext :one
+INSERT INTO change_sequences (organisation_id, seq)
+VALUES (@organisation_id, 1)
+ON CONFLICT (organisation_id) DO UPDATE SET seq = change_sequences.seq + 1
+RETURNING seq;
+
+-- name: ChangeSequenceFind :one
+SELECT *
+FROM change_sequences
+WHERE organisation_id = @organisation_id;
+
+-- name: ChangePrune :one
+-- Deletes the changes made before the given time and remembers the highest
+-- deleted number per organisation. It returns the number of deleted changes.
+WITH deleted AS (
+    DELETE FROM file_activities
+        WHERE created_at < @before
+        RETURNING organisation_id, seq),
+     pruned AS (
+         UPDATE change_sequences c
+             SET pruned_seq = GREATEST(c.pruned_seq, d.seq)
+             FROM (SELECT organisation_id, MAX(seq) AS seq FROM deleted GROUP BY organisation_id) d
+             WHERE c.organisation_id = d.organisation_id)
+SELECT COUNT(*)
+FROM deleted;
+
+-- name: ChangeNotify :exec
+-- Wakes the event streams of the organisation once the transaction commits.
+SELECT pg_notify('file_changes', @organisation_id::text);
@@ -0,0 +1,23 @@
+-- name: DataKeyCreate :exec
+INSERT INTO data_keys (id, organisation_id, kek_id, wrapped_key)
+VALUES (@id, @organisation_id, @kek_id, @wrapped_key);
+
+-- name: DataKeyFind :one
+SELECT *
+FROM data_keys
+WHERE id = $1;
+
+-- name: DataKeyFindAfter :many
+SELECT *
+FROM data_keys
+WHERE id > @after
+ORDER BY id
+LIMIT @max_count;
+
+-- name: DataKeyRewrap :execrows
+UPDATE data_keys
+SET kek_id      = @kek_id,
+    wrapped_key = @wrapped_key,
+    rotated_at  = NOW()
+WHERE id = @id
+  AND kek_id = @previous_kek_id;
@@ -0,0 +1,25 @@
+-- name: EmailCreate :one
+INSERT INTO emails (organisation_id, template, to_address, subject, body)
+VALUES (@organisation_id, @template, @to_address, @subject, @body)
+RETURNING *;
+
+-- name: EmailFindByID :one
+SELECT *
+FROM emails
+WHERE id = $1
+  AND organisation_id = $2;
+
+-- name: EmailFindPending :one
+SELECT *
+FROM emails
+WHERE id = $1
+  AND status = 'pending';
+
+-- name: EmailFinish :exec
+-- Records an attempt. The email is retried if it is still pending.
+UPDATE emails
+SET status   = @status,
+    attempts = attempts + 1,
+    error    = @error,
+    sent_at  = CASE WHEN @status = 'sent' THEN NOW() END
+WHERE id = @id;
@@ -5,6 +5,7 @@ WHERE deleted_at IS NULL
   AND parent_id IS NULL
   AND shared_drive IS FALSE
   AND organisation_id = $1
+  AND owner_id = $2
   AND deleted_at IS NULL
 ORDER BY is_folder DESC, name;
 
@@ -14,7 +15,7 @@ FROM files
 WHERE parent_id = $1
   AND organisation_id = $2
   AND deleted_at IS NULL
-ORDER BY is_folder, name;
+ORDER BY is_folder DESC, name;
 
 -- name: FileFindSharedDrives :many
 SELECT *
@@ -22,22 +23,23 @@ FROM files
 WHERE shared_drive IS TRUE
   AND organisation_id = $1
   AND deleted_at IS NULL
-ORDER BY is_folder, name;
+ORDER BY is_folder DESC, name;
 
 -- name: FileCreate :one
-INSERT INTO files (name, mime_type, file_size, parent_id, organisation_id)
-VALUES (@name, @mime_type, @file_size, @parent_id, @organisation_id)
+INSERT INTO files (name, mime_type, file_size, parent_id, organisation_id, owner_id, created_by)
+VALUES (@name, @mime_type, @file_size, @parent_id, @organisation_id, @created_by, @created_by)
 RETURNING *;
 
 -- name: FileCreateFolder :one
-INSERT INTO files (name, mime_type, file_size, is_folder, organisation_id)
-VALUES (@name, 'directory', 0, TRUE, @organisation_id)
+INSERT INTO files (name, mime_type, file_size, is_folder, parent_id, organisation_id, owner_id, created_by)
+VALUES (@name, 'directory', 0, TRUE, @parent_id, @organisation_id, @created_by, @created_by)
 RETURNING *;
 
 -- name: FileFindTrashed :many
 SELECT *
 FROM files
 WHERE deleted_at IS NOT NULL
+  AND purged_at IS NULL
   AND organisation_id = $1;
 
 -- name: FileSoftDelete :exec
@@ -45,6 +47,23 @@ UPDATE files
 SET deleted_at = NOW()
 WHERE id = $1;
 
+-- name: FileFindTrashedByID :one
+-- Finds a file that was moved to the trash itself, not through a folder.
+SELECT *
+FROM files
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NOT NULL
+  AND purged_at IS NULL;
+
+-- name: FileRestore :one
+UPDATE files
+SET deleted_at = NULL
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND purged_at IS NULL
+RETURNING *;
+
 -- name: FileFindByID :one
 SELECT *
 FROM files
@@ -54,8 +73,180 @@ WHERE id = $1
 
 -- name: FileUpdateName :one
 UPDATE files
-SET name = $1
+SET name       = $1,
+    updated_at = NOW()
 WHERE id = $2
   AND organisation_id = $3
   AND deleted_at IS NULL
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: FileFindChild :one
+SELECT *
+FROM files
+WHERE parent_id IS NOT DISTINCT FROM @parent_id
+  AND name = @name
+  AND shared_drive = @shared_drive
+  AND organisation_id = @organisation_id
+  AND (sqlc.narg('owner_id')::text IS NULL OR owner_id = sqlc.narg('owner_id'))
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT 1;
+
+-- name: FileUpdateContent :one
+UPDATE files
+SET file_size      = @file_size,
+    mime_type      = @mime_type,
+    blob_hash      = @blob_hash,
+    sha256         = @sha256,
+    md5            = @md5,
+    scrubbed_at    = NOW(),
+    corrupted_at   = NULL,
+    thumbnailed_at = NULL,
+    has_thumbnail  = FALSE,
+    extracted_at   = NULL,
+    updated_at     = NOW()
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: FileMove :one
+UPDATE files
+SET parent_id  = @parent_id,
+    name       = @name,
+    updated_at = NOW()
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: FileFindAncestorIDs :many
+WITH RECURSIVE ancestors AS (SELECT files.id, files.parent_id
+                             FROM files
+                             WHERE files.id = $1
+                             UNION ALL
+                             SELECT f.id, f.parent_id
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT id
+FROM ancestors;
+
+-- name: FileSumSize :one
+SELECT COALESCE(SUM(file_size), 0)::bigint AS total
+FROM files
+WHERE organisation_id = $1
+  AND deleted_at IS NULL;
+
+-- name: FileFindUnscrubbed :many
+SELECT *
+FROM files
+WHERE is_folder IS FALSE
+  AND shared_drive IS FALSE
+  AND deleted_at IS NULL
+  AND (scrubbed_at IS NULL OR scrubbed_at < @scrubbed_before)
+ORDER BY scrubbed_at NULLS FIRST
+LIMIT @max_count;
+
+-- name: FileUpdateScrubbed :exec
+UPDATE files
+SET scrubbed_at  = NOW(),
+    corrupted_at = CASE WHEN @corrupted::boolean THEN COALESCE(corrupted_at, NOW()) END,
+    sha256       = COALESCE(sha256, @sha256),
+    md5          = COALESCE(md5, @md5)
+WHERE id = @id;
+
+-- name: FileFindExistingIDs :many
+SELECT id
+FROM files
+WHERE id = ANY (@ids::text[])
+  AND purged_at IS NULL;
+
+-- name: FileFindContentAfter :many
+SELECT *
+FROM files
+WHERE is_folder IS FALSE
+  AND shared_drive IS FALSE
+  AND purged_at IS NULL
+  AND id > @after
+ORDER BY id
+LIMIT @max_count;
+
+-- name: FileFindUnthumbnailed :many
+SELECT *
+FROM files
+WHERE thumbnailed_at IS NULL
+  AND is_folder IS FALSE
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT @max_count;
+
+-- name: FileUpdateThumbnailed :exec
+UPDATE files
+SET thumbnailed_at = NOW(),
+    has_thumbnail  = @has_thumbnail
+WHERE id = @id
+  AND sha256 IS NOT DISTINCT FROM @sha256;
+
+-- name: FileFindUnextracted :many
+SELECT *
+FROM files
+WHERE extracted_at IS NULL
+  AND is_folder IS FALSE
+  AND deleted_at IS NULL
+ORDER BY created_at
+LIMIT @max_count;
+
+-- name: FileUpdateExtracted :execrows
+UPDATE files
+SET extracted_at = NOW()
+WHERE id = @id
+  AND sha256 IS NOT DISTINCT FROM @sha256;
+
+-- name: FileFindAncestors :many
+-- Returns the file and all of its ancestors, the top-level one first.
+WITH RECURSIVE ancestors AS (SELECT files.id, files.parent_id, 0 AS depth
+                             FROM files
+                             WHERE files.id = @id
+                               AND files.organisation_id = @organisation_id
+                             UNION ALL
+                             SELECT f.id, f.parent_id, a.depth + 1
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT f.*
+FROM ancestors a
+         INNER JOIN files f ON f.id = a.id
+ORDER BY a.depth DESC;
+
+-- name: FileTransfer :one
+UPDATE files
+SET owner_id = @owner_id
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: FilePurge :many
+-- Purges the files in the trash since before, and the files in them. Their
+-- old blobs are returned to be released.
+WITH RECURSIVE purged AS ((SELECT id
+                           FROM files
+                           WHERE deleted_at < @before
+                             AND purged_at IS NULL
+                           ORDER BY deleted_at
+                           LIMIT @max_count)
+                          UNION
+                          SELECT f.id
+                          FROM files f
+                                   INNER JOIN purged p ON f.parent_id = p.id
+                          WHERE f.purged_at IS NULL),
+     old AS (SELECT id, blob_hash
+             FROM files
+             WHERE id IN (SELECT id FROM purged)
+                 FOR UPDATE)
+UPDATE files
+SET purged_at  = NOW(),
+    deleted_at = COALESCE(files.deleted_at, NOW()),
+    blob_hash  = NULL
+FROM old
+WHERE files.id = old.id
+RETURNING files.id, files.is_folder, old.blob_hash;
@@ -0,0 +1,5 @@
+-- name: FileAccessRecord :exec
+INSERT INTO file_accesses (user_id, file_id, kind)
+VALUES (@user_id, @file_id, @kind)
+ON CONFLICT (user_id, file_id) DO UPDATE SET kind        = excluded.kind,
+                                             accessed_at = NOW();
@@ -0,0 +1,3 @@
+-- name: FileActivityCreate :exec
+INSERT INTO file_activities (organisation_id, file_id, user_id, action, details, seq)
+VALUES (@organisation_id, @file_id, @user_id, @action, @details, @seq);
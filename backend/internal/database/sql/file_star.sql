@@ -0,0 +1,10 @@
+-- name: FileStarCreate :exec
+INSERT INTO file_stars (user_id, file_id)
+VALUES (@user_id, @file_id)
+ON CONFLICT DO NOTHING;
+
+-- name: FileStarDelete :exec
+DELETE
+FROM file_stars
+WHERE user_id = @user_id
+  AND file_id = @file_id;
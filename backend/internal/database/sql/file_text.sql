@@ -0,0 +1,10 @@
+-- name: FileTextUpsert :exec
+INSERT INTO file_texts (file_id, content)
+VALUES (@file_id, @content)
+ON CONFLICT (file_id) DO UPDATE SET content    = excluded.content,
+                                    created_at = NOW();
+
+-- name: FileTextDelete :exec
+DELETE
+FROM file_texts
+WHERE file_id = @file_id;
@@ -0,0 +1,53 @@
+-- name: GroupCreate :one
+INSERT INTO groups (name, external_id, organisation_id)
+VALUES (@name, @external_id, @organisation_id)
+RETURNING *;
+
+-- name: GroupFindByID :one
+SELECT *
+FROM groups
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL;
+
+-- name: GroupUpdate :one
+UPDATE groups
+SET name        = @name,
+    external_id = @external_id
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GroupSoftDelete :exec
+UPDATE groups
+SET deleted_at = NOW()
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL;
+
+-- name: GroupMemberAdd :exec
+INSERT INTO group_members (group_id, user_id)
+SELECT @group_id, id
+FROM users
+WHERE id = @user_id
+  AND organisation_id = @organisation_id
+ON CONFLICT DO NOTHING;
+
+-- name: GroupMemberRemove :exec
+DELETE
+FROM group_members
+WHERE group_id = $1
+  AND user_id = $2;
+
+-- name: GroupMemberRemoveAll :exec
+DELETE
+FROM group_members
+WHERE group_id = $1;
+
+-- name: GroupMemberFindAll :many
+SELECT users.*
+FROM users
+         INNER JOIN group_members gm ON users.id = gm.user_id
+WHERE gm.group_id = $1
+ORDER BY users.email;
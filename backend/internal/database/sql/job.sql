@@ -0,0 +1,90 @@
+-- name: JobCreate :exec
+-- Jobs with the unique key of an existing job are ignored.
+INSERT INTO jobs (organisation_id, kind, payload, max_attempts, run_at, unique_key)
+VALUES (@organisation_id, @kind, @payload, @max_attempts, @run_at, @unique_key)
+ON CONFLICT (unique_key) DO NOTHING;
+
+-- name: JobClaim :many
+-- Starts the due jobs of a kind. Jobs taken by other workers are skipped.
+UPDATE jobs
+SET status    = 'running',
+    attempts  = attempts + 1,
+    locked_at = NOW()
+WHERE id IN (SELECT id
+             FROM jobs
+             WHERE kind = @kind
+               AND status = 'pending'
+               AND run_at <= NOW()
+             ORDER BY run_at
+             LIMIT @batch_size FOR UPDATE SKIP LOCKED)
+RETURNING *;
+
+-- name: JobSucceed :exec
+-- Records the result of an attempt, unless the job was rescued in between.
+-- locked_at tells the attempts apart.
+UPDATE jobs
+SET status      = 'succeeded',
+    error       = '',
+    locked_at   = NULL,
+    finished_at = NOW()
+WHERE id = @id
+  AND status = 'running'
+  AND locked_at = @locked_at;
+
+-- name: JobRetry :exec
+UPDATE jobs
+SET status    = 'pending',
+    run_at    = @run_at,
+    error     = @error,
+    locked_at = NULL
+WHERE id = @id
+  AND status = 'running'
+  AND locked_at = @locked_at;
+
+-- name: JobBury :exec
+UPDATE jobs
+SET status      = 'dead',
+    error       = @error,
+    locked_at   = NULL,
+    finished_at = NOW()
+WHERE id = @id
+  AND status = 'running'
+  AND locked_at = @locked_at;
+
+-- name: JobRescue :execrows
+-- Returns the running jobs of a kind started before the given time to the
+-- queue, their worker is gone.
+UPDATE jobs
+SET status      = CASE WHEN attempts >= max_attempts THEN 'dead'::job_status ELSE 'pending'::job_status END,
+    error       = 'worker stopped',
+    locked_at   = NULL,
+    finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END
+WHERE kind = @kind
+  AND status = 'running'
+  AND locked_at < @before;
+
+-- name: JobDeleteFinished :execrows
+DELETE
+FROM jobs
+WHERE (status = 'succeeded' AND finished_at < @succeeded_before)
+   OR (status = 'dead' AND finished_at < @dead_before);
+
+-- name: JobFindByID :one
+-- Finds a job of an organisation, or of the whole system if
+-- organisation_id is NULL.
+SELECT *
+FROM jobs
+WHERE id = $1
+  AND organisation_id IS NOT DISTINCT FROM $2;
+
+-- name: JobRequeue :one
+-- Runs a dead or pending job right away, with all its attempts.
+UPDATE jobs
+SET status      = 'pending',
+    attempts    = 0,
+    run_at      = NOW(),
+    finished_at = NULL
+WHERE id = @id
+  AND organisation_id IS NOT DISTINCT FROM @organisation_id
+  AND status IN ('pending', 'dead')
+RETURNING *;
@@ -0,0 +1,82 @@
+-- name: FilePermissionFindEffective :one
+-- Aggregates the permissions granted on the file and all of its ancestors.
+-- grants counts every permission on the chain, level is the highest role
+-- (1 = viewer, 2 = manager) granted to the user directly, through one of
+-- their groups or to the whole organisation. personal is true if the chain
+-- starts in a personal root, owned if the user owns a file on the chain.
+WITH RECURSIVE ancestors AS (SELECT files.id, files.parent_id, files.shared_drive, files.owner_id
+                             FROM files
+                             WHERE files.id = @file_id
+                             UNION ALL
+                             SELECT f.id, f.parent_id, f.shared_drive, f.owner_id
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT COUNT(p.file_id) AS grants,
+       COALESCE(MAX(CASE p.permission_role WHEN 'manager' THEN 2 ELSE 1 END)
+                FILTER (WHERE p.permission_type IN ('domain', 'anyone')
+                    OR (p.permission_type = 'user' AND p.user_id = @user_id::text)
+                    OR (p.permission_type = 'group' AND p.group_id IN (SELECT gm.group_id
+                                                                        FROM group_members gm
+                                                                                 INNER JOIN groups g ON g.id = gm.group_id
+                                                                        WHERE gm.user_id = @user_id
+                                                                          AND g.deleted_at IS NULL))),
+                0)::int AS level,
+       BOOL_OR(a.parent_id IS NULL AND a.shared_drive IS FALSE)::boolean AS personal,
+       BOOL_OR(a.owner_id IS NOT DISTINCT FROM @user_id::text)::boolean AS owned
+FROM ancestors a
+         LEFT JOIN file_permissions p ON p.file_id = a.id AND p.deleted_at IS NULL;
+
+-- name: FilePermissionFindByParentID :many
+-- Same aggregation as FilePermissionFindEffective, but only for the
+-- permissions set directly on the children of a folder.
+SELECT p.file_id,
+       COUNT(*) AS grants,
+       COALESCE(MAX(CASE p.permission_role WHEN 'manager' THEN 2 ELSE 1 END)
+                FILTER (WHERE p.permission_type IN ('domain', 'anyone')
+                    OR (p.permission_type = 'user' AND p.user_id = @user_id::text)
+                    OR (p.permission_type = 'group' AND p.group_id IN (SELECT gm.group_id
+                                                                        FROM group_members gm
+                                                                                 INNER JOIN groups g ON g.id = gm.group_id
+                                                                        WHERE gm.user_id = @user_id
+                                                                          AND g.deleted_at IS NULL))),
+                0)::int AS level
+FROM file_permissions p
+         INNER JOIN files f ON f.id = p.file_id
+WHERE f.parent_id IS NOT DISTINCT FROM @parent_id
+  AND f.organisation_id = @organisation_id
+  AND f.deleted_at IS NULL
+  AND p.deleted_at IS NULL
+GROUP BY p.file_id;
+
+-- name: FilePermissionFindEffectiveByIDs :many
+-- Same aggregation as FilePermissionFindEffective for several files at once.
+-- trashed is true if the file or one of its ancestors is in the trash.
+WITH RECURSIVE ancestors AS (SELECT files.id AS file_id,
+                                    files.id,
+                                    files.parent_id,
+                                    files.shared_drive,
+                                    files.owner_id,
+                                    files.deleted_at
+                             FROM files
+                             WHERE files.id = ANY (@file_ids::text[])
+                             UNION ALL
+                             SELECT a.file_id, f.id, f.parent_id, f.shared_drive, f.owner_id, f.deleted_at
+                             FROM files f
+                                      INNER JOIN ancestors a ON f.id = a.parent_id)
+SELECT a.file_id,
+       COUNT(p.file_id) AS grants,
+       COALESCE(MAX(CASE p.permission_role WHEN 'manager' THEN 2 ELSE 1 END)
+                FILTER (WHERE p.permission_type IN ('domain', 'anyone')
+                    OR (p.permission_type = 'user' AND p.user_id = @user_id::text)
+                    OR (p.permission_type = 'group' AND p.group_id IN (SELECT gm.group_id
+                                                                        FROM group_members gm
+                                                                                 INNER JOIN groups g ON g.id = gm.group_id
+                                                                        WHERE gm.user_id = @user_id
+                                                                          AND g.deleted_at IS NULL))),
+                0)::int AS level,
+       BOOL_OR(a.parent_id IS NULL AND a.shared_drive IS FALSE)::boolean AS personal,
+       BOOL_OR(a.owner_id IS NOT DISTINCT FROM @user_id::text)::boolean AS owned,
+       BOOL_OR(a.deleted_at IS NOT NULL)::boolean AS trashed
+FROM ancestors a
+         LEFT JOIN file_permissions p ON p.file_id = a.id AND p.deleted_at IS NULL
+GROUP BY a.file_id;
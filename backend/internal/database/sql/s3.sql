@@ -0,0 +1,77 @@
+-- name: AccessKeyCreate :one
+INSERT INTO access_keys (name, access_key_id, secret_access_key, user_id)
+VALUES (@name, @access_key_id, @secret_access_key, @user_id)
+RETURNING *;
+
+-- name: AccessKeyFindAll :many
+SELECT *
+FROM access_keys
+WHERE user_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: AccessKeyRevoke :exec
+UPDATE access_keys
+SET deleted_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND deleted_at IS NULL;
+
+-- name: GLOBAL_AccessKeyFindByAccessKeyID :one
+SELECT access_keys.*
+FROM access_keys
+         INNER JOIN users u ON u.id = access_keys.user_id
+WHERE access_keys.access_key_id = $1
+  AND access_keys.deleted_at IS NULL
+  AND u.deleted_at IS NULL;
+
+-- name: AccessKeyTouch :exec
+UPDATE access_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: MultipartUploadCreate :one
+INSERT INTO multipart_uploads (user_id, bucket_id, key)
+VALUES (@user_id, @bucket_id, @key)
+RETURNING *;
+
+-- name: MultipartUploadFind :one
+SELECT *
+FROM multipart_uploads
+WHERE id = $1
+  AND user_id = $2;
+
+-- name: MultipartUploadDelete :exec
+DELETE
+FROM multipart_uploads
+WHERE id = $1;
+
+-- name: MultipartUploadFindStale :many
+-- Uploads started before before, which are abandoned most likely.
+SELECT *
+FROM multipart_uploads
+WHERE created_at < @before
+ORDER BY created_at
+LIMIT @max_count;
+
+-- name: MultipartPartSave :exec
+INSERT INTO multipart_parts (upload_id, number, organisation_id, size)
+VALUES (@upload_id, @number, @organisation_id, @size)
+ON CONFLICT (upload_id, number) DO UPDATE SET size = excluded.size;
+
+-- name: MultipartPartFindSize :one
+SELECT size
+FROM multipart_parts
+WHERE upload_id = $1
+  AND number = $2;
+
+-- name: MultipartPartSumSize :one
+-- Bytes of the parts of all uploads of the organisation in progress.
+SELECT COALESCE(SUM(size), 0)::bigint AS total
+FROM multipart_parts
+WHERE organisation_id = $1;
+
+-- name: MultipartUploadSumSize :one
+SELECT COALESCE(SUM(size), 0)::bigint AS total
+FROM multipart_parts
+WHERE upload_id = $1;
@@ -0,0 +1,30 @@
+-- name: ScimTokenCreate :one
+INSERT INTO scim_tokens (name, token_hash, organisation_id)
+VALUES (@name, @token_hash, @organisation_id)
+RETURNING *;
+
+-- name: ScimTokenFindAll :many
+SELECT *
+FROM scim_tokens
+WHERE organisation_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: ScimTokenRevoke :one
+UPDATE scim_tokens
+SET deleted_at = NOW()
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GLOBAL_ScimTokenFindByHash :one
+SELECT *
+FROM scim_tokens
+WHERE token_hash = $1
+  AND deleted_at IS NULL;
+
+-- name: ScimTokenTouch :exec
+UPDATE scim_tokens
+SET last_used_at = NOW()
+WHERE id = $1;
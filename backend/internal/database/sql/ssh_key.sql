@@ -0,0 +1,31 @@
+-- name: SshKeyCreate :one
+INSERT INTO ssh_keys (name, public_key, fingerprint, user_id)
+VALUES (@name, @public_key, @fingerprint, @user_id)
+RETURNING *;
+
+-- name: SshKeyFindAll :many
+SELECT *
+FROM ssh_keys
+WHERE user_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: SshKeyRevoke :exec
+UPDATE ssh_keys
+SET deleted_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND deleted_at IS NULL;
+
+-- name: GLOBAL_SshKeyFindByFingerprint :one
+SELECT ssh_keys.*
+FROM ssh_keys
+         INNER JOIN users u ON u.id = ssh_keys.user_id
+WHERE ssh_keys.fingerprint = $1
+  AND ssh_keys.deleted_at IS NULL
+  AND u.deleted_at IS NULL;
+
+-- name: SshKeyTouch :exec
+UPDATE ssh_keys
+SET last_used_at = NOW()
+WHERE id = $1;
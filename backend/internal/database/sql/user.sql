@@ -76,3 +76,54 @@ WHERE token = $1
   AND user_id = $2
   AND deleted_at IS NULL
 RETURNING *;
+
+
+-- name: UserFindIncludingArchived :one
+SELECT *
+FROM users
+WHERE id = $1
+  AND organisation_id = $2;
+
+-- name: UserProvision :one
+INSERT INTO users (email, first_name, last_name, organisation_id, role, external_id)
+VALUES (@email, @first_name, @last_name, @organisation_id, 'user', @external_id)
+RETURNING *;
+
+-- name: UserUpdateProfile :one
+UPDATE users
+SET email       = @email,
+    first_name  = @first_name,
+    last_name   = @last_name,
+    external_id = @external_id
+WHERE id = @id
+  AND organisation_id = @organisation_id
+RETURNING *;
+
+-- name: UserUpdateRole :one
+-- Owners keep their role, they aren't managed by identity providers.
+UPDATE users
+SET role = @role
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND role <> 'owner'
+RETURNING *;
+
+-- name: UserArchive :exec
+UPDATE users
+SET deleted_at = NOW()
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL;
+
+-- name: UserRestore :exec
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NOT NULL;
+
+-- name: RemoveAllSessions :exec
+UPDATE sessions
+SET deleted_at = NOW()
+WHERE user_id = $1
+  AND deleted_at IS NULL;
@@ -0,0 +1,106 @@
+-- name: WebhookCreate :one
+INSERT INTO webhooks (organisation_id, url, secret, event_types)
+VALUES (@organisation_id, @url, @secret, @event_types)
+RETURNING *;
+
+-- name: WebhookFindAll :many
+SELECT *
+FROM webhooks
+WHERE organisation_id = $1
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: WebhookFindByID :one
+SELECT *
+FROM webhooks
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL;
+
+-- name: WebhookUpdate :one
+-- Enabling a webhook starts counting failures again.
+UPDATE webhooks
+SET url           = @url,
+    event_types   = @event_types,
+    failure_count = CASE WHEN @enabled::boolean THEN 0 ELSE failure_count END,
+    disabled_at   = CASE WHEN @enabled::boolean THEN NULL ELSE COALESCE(disabled_at, NOW()) END
+WHERE id = @id
+  AND organisation_id = @organisation_id
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: WebhookDelete :exec
+UPDATE webhooks
+SET deleted_at = NOW()
+WHERE id = $1
+  AND organisation_id = $2
+  AND deleted_at IS NULL;
+
+-- name: WebhookRecordSuccess :exec
+UPDATE webhooks
+SET failure_count = 0
+WHERE id = $1;
+
+-- name: WebhookRecordFailure :one
+-- Disables the webhook once it failed disable_after times in a row.
+UPDATE webhooks
+SET failure_count = failure_count + 1,
+    disabled_at   = CASE
+                        WHEN failure_count + 1 >= @disable_after::int THEN COALESCE(disabled_at, NOW())
+                        ELSE disabled_at END
+WHERE id = @id
+RETURNING *;
+
+-- name: WebhookDeliveryEnqueue :exec
+-- Queues the event for all enabled webhooks of the organisation subscribed to
+-- its type.
+INSERT INTO webhook_deliveries (organisation_id, webhook_id, event_id, event_type, payload)
+SELECT organisation_id, id, @event_id, @event_type, @payload
+FROM webhooks
+WHERE organisation_id = @organisation_id
+  AND @event_type::text = ANY (event_types)
+  AND disabled_at IS NULL
+  AND deleted_at IS NULL;
+
+-- name: WebhookDeliveryClaim :many
+-- Leases due deliveries to one sender, other senders skip them until the
+-- lease ends.
+UPDATE webhook_deliveries
+SET next_attempt_at = NOW() + @lease::interval
+WHERE id IN (SELECT id
+             FROM webhook_deliveries
+             WHERE status = 'pending'
+               AND next_attempt_at <= NOW()
+             ORDER BY next_attempt_at
+             LIMIT @batch_size FOR UPDATE SKIP LOCKED)
+RETURNING *;
+
+-- name: WebhookDeliveryFinish :exec
+-- Records an attempt. The delivery is retried at next_attempt_at if it is
+-- still pending.
+UPDATE webhook_deliveries
+SET status          = @status,
+    attempts        = attempts + 1,
+    next_attempt_at = @next_attempt_at,
+    response_status = @response_status,
+    response_body   = @response_body,
+    error           = @error,
+    delivered_at    = CASE WHEN @status = 'succeeded' THEN NOW() END
+WHERE id = @id;
+
+-- name: WebhookDeliveryFailPending :exec
+UPDATE webhook_deliveries
+SET status = 'failed',
+    error  = @error
+WHERE webhook_id = @webhook_id
+  AND status = 'pending';
+
+-- name: WebhookDeliveryReplay :one
+-- Queues the event of a delivery again.
+INSERT INTO webhook_deliveries (organisation_id, webhook_id, event_id, event_type, payload)
+SELECT organisation_id, webhook_id, event_id, event_type, payload
+FROM webhook_deliveries
+WHERE id = @id
+  AND webhook_id = @webhook_id
+  AND organisation_id = @organisation_id
+RETURNING *;
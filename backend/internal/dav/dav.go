@@ -0,0 +1,102 @@
+// Package dav serves the virtual file tree over WebDAV so that drives can be
+// mounted in Finder, Windows Explorer or Linux file managers.
+package dav
+
+import (
+	"errors"
+	"example/internal/audit"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/webdav"
+)
+
+// Prefix is the path the WebDAV server is mounted at.
+const Prefix = "/dav"
+
+type Server struct {
+	DB    *database.DB
+	Drive *drive.Service
+	Audit *audit.Log
+
+	mu    sync.Mutex
+	locks map[string]webdav.LockSystem
+}
+
+func NewServer(db *database.DB, drive *drive.Service, log *audit.Log) *Server {
+	return &Server{DB: db, Drive: drive, Audit: log, locks: make(map[string]webdav.LockSystem)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Dokedu Drive"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fs := newFileSystem(s.Drive, s.Audit, user)
+	if r.Method == http.MethodPut {
+		// The handler closes the file even if the body couldn't be read
+		// completely, the upload has to tell
+		fs.body = &requestBody{ReadCloser: r.Body, size: r.ContentLength}
+		r.Body = fs.body
+	}
+
+	handler := webdav.Handler{
+		Prefix:     Prefix,
+		FileSystem: fs,
+		LockSystem: s.lockSystem(user.OrganisationID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+				slog.Error("error handling webdav request", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// authenticate accepts an API token either as bearer token or as app
+// password together with the user's email address.
+func (s *Server) authenticate(r *http.Request) (*db.User, bool) {
+	ctx := r.Context()
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		return middleware.GetUserByAPIToken(ctx, s.DB, token)
+	}
+
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserByAPIToken(ctx, s.DB, password)
+	if !ok || !strings.EqualFold(user.Email, email) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// lockSystem returns the locks of an organisation. Paths are only unique
+// within an organisation, so every organisation gets its own namespace.
+func (s *Server) lockSystem(organisationID string) webdav.LockSystem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ls, ok := s.locks[organisationID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		s.locks[organisationID] = ls
+	}
+	return ls
+}
@@ -0,0 +1,505 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"example/internal/storage"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// fileSystem implements webdav.FileSystem on top of the virtual tree. It is
+// created per request and caches resolved nodes, since the webdav handler
+// stats every entry of a directory listing again.
+type fileSystem struct {
+	drive *drive.Service
+	audit *audit.Log
+	user  *db.User
+	nodes map[string]drive.Node
+	// body is the body of a PUT request, which is uploaded.
+	body *requestBody
+}
+
+// requestBody records whether the body of a request was read completely.
+type requestBody struct {
+	io.ReadCloser
+	// size is the Content-Length, -1 if unknown.
+	size int64
+	read int64
+	err  error
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// incomplete returns why the body wasn't read completely, nil if it was.
+func (b *requestBody) incomplete() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.size >= 0 && b.read != b.size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func newFileSystem(service *drive.Service, log *audit.Log, user *db.User) *fileSystem {
+	return &fileSystem{drive: service, audit: log, user: user, nodes: make(map[string]drive.Node)}
+}
+
+func (fs *fileSystem) resolve(ctx context.Context, name string) (drive.Node, error) {
+	name = path.Clean("/" + name)
+	if node, ok := fs.nodes[name]; ok {
+		return node, nil
+	}
+
+	if name == "/" {
+		node := fs.drive.Root(fs.user)
+		fs.nodes[name] = node
+		return node, nil
+	}
+
+	parent, err := fs.resolve(ctx, path.Dir(name))
+	if err != nil {
+		return drive.Node{}, err
+	}
+
+	node, err := fs.drive.Child(ctx, fs.user, parent, path.Base(name))
+	if err != nil {
+		return drive.Node{}, err
+	}
+
+	fs.nodes[name] = node
+	return node, nil
+}
+
+// forget drops the cached nodes of name and its descendants.
+func (fs *fileSystem) forget(name string) {
+	name = path.Clean("/" + name)
+	for p := range fs.nodes {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(fs.nodes, p)
+		}
+	}
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	parent, err := fs.resolve(ctx, path.Dir(path.Clean("/"+name)))
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	_, err = fs.drive.Mkdir(ctx, fs.user, parent, path.Base(name))
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	return nil
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return fs.create(ctx, name, flag)
+	}
+
+	node, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	if node.IsDir() {
+		return &dirFile{fs: fs, ctx: ctx, name: path.Clean("/" + name), node: node}, nil
+	}
+
+	return &objectFile{fs: fs, ctx: ctx, node: node}, nil
+}
+
+// create returns a file whose contents are streamed to the storage while the
+// client uploads them. Copies of other files of the drive reference their
+// contents instead, see uploadFile.ReadFrom.
+func (fs *fileSystem) create(ctx context.Context, name string, flag int) (webdav.File, error) {
+	node, err := fs.resolve(ctx, name)
+	switch {
+	case errors.Is(err, drive.ErrNotFound) && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, err)
+	case errors.Is(err, drive.ErrNotFound):
+	case err != nil:
+		return nil, pathError("open", name, err)
+	case node.IsDir():
+		return nil, pathError("open", name, drive.ErrExists)
+	case node.Role < drive.RoleManager:
+		return nil, pathError("open", name, drive.ErrForbidden)
+	}
+
+	parent, err := fs.resolve(ctx, path.Dir(path.Clean("/"+name)))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if parent.Role < drive.RoleManager {
+		return nil, pathError("open", name, drive.ErrForbidden)
+	}
+
+	return &uploadFile{fs: fs, ctx: ctx, name: path.Clean("/" + name), parent: parent, body: fs.body}, nil
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	node, err := fs.resolve(ctx, name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+
+	err = fs.drive.Trash(ctx, fs.user, node)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+
+	fs.audit.Record(ctx, fs.user, audit.FileEvent(audit.ActionDelete, node.File))
+	fs.forget(name)
+	return nil
+}
+
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	node, err := fs.resolve(ctx, oldName)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+
+	parent, err := fs.resolve(ctx, path.Dir(path.Clean("/"+newName)))
+	if err != nil {
+		return pathError("rename", newName, err)
+	}
+
+	file, err := fs.drive.Move(ctx, fs.user, node, parent, path.Base(newName))
+	if err != nil {
+		return pathError("rename", newName, err)
+	}
+
+	fs.audit.Record(ctx, fs.user, audit.MoveEvent(node.File, file))
+	fs.forget(oldName)
+	fs.forget(newName)
+	return nil
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+
+	return fileInfo{node: node}, nil
+}
+
+// pathError translates drive errors into the os errors the webdav handler
+// understands.
+func pathError(op string, name string, err error) error {
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+		err = os.ErrNotExist
+	case errors.Is(err, drive.ErrForbidden), errors.Is(err, drive.ErrQuotaExceeded):
+		err = os.ErrPermission
+	case errors.Is(err, drive.ErrExists):
+		err = os.ErrExist
+	case errors.Is(err, drive.ErrInvalid):
+		err = os.ErrInvalid
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// fileInfo implements os.FileInfo and webdav.ContentTyper for a node.
+type fileInfo struct {
+	node drive.Node
+}
+
+func (fi fileInfo) Name() string {
+	return fi.node.Name
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.node.File.FileSize
+}
+
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.node.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	return fi.node.File.UpdatedAt
+}
+
+func (fi fileInfo) IsDir() bool {
+	return fi.node.IsDir()
+}
+
+func (fi fileInfo) Sys() any {
+	return nil
+}
+
+func (fi fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.node.Kind != drive.KindFile || fi.node.File.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.node.File.MimeType, nil
+}
+
+// dirFile is an opened collection.
+type dirFile struct {
+	fs      *fileSystem
+	ctx     context.Context
+	name    string
+	node    drive.Node
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (f *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.listed {
+		children, err := f.fs.drive.List(f.ctx, f.fs.user, f.node)
+		if err != nil {
+			return nil, pathError("readdir", f.name, err)
+		}
+
+		for _, child := range children {
+			f.fs.nodes[path.Join(f.name, child.Name)] = child
+			f.entries = append(f.entries, fileInfo{node: child})
+		}
+		f.listed = true
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *dirFile) Stat() (os.FileInfo, error) {
+	return fileInfo{node: f.node}, nil
+}
+
+func (f *dirFile) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *dirFile) Close() error {
+	return nil
+}
+
+// objectFile is an opened file. The object is only opened once the contents
+// are read, PROPFIND only needs Stat. The download is recorded with the first
+// bytes read, HEAD and conditional requests don't read any.
+type objectFile struct {
+	fs         *fileSystem
+	ctx        context.Context
+	node       drive.Node
+	object     storage.Object
+	downloaded bool
+}
+
+func (f *objectFile) open() error {
+	if f.object != nil {
+		return nil
+	}
+
+	object, err := f.fs.drive.Open(f.ctx, f.node)
+	if err != nil {
+		return err
+	}
+
+	f.object = object
+	return nil
+}
+
+func (f *objectFile) Read(p []byte) (int, error) {
+	err := f.open()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.object.Read(p)
+	if n > 0 && !f.downloaded {
+		f.downloaded = true
+		f.fs.audit.Record(f.ctx, f.fs.user, audit.FileEvent(audit.ActionDownload, f.node.File))
+	}
+	return n, err
+}
+
+// Seek allows http.ServeContent to serve range requests.
+func (f *objectFile) Seek(offset int64, whence int) (int64, error) {
+	err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	return f.object.Seek(offset, whence)
+}
+
+func (f *objectFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *objectFile) Stat() (os.FileInfo, error) {
+	return fileInfo{node: f.node}, nil
+}
+
+func (f *objectFile) Write(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *objectFile) Close() error {
+	if f.object == nil {
+		return nil
+	}
+	return f.object.Close()
+}
+
+// uploadFile streams the written contents into the storage through a pipe.
+// The upload starts with the first write.
+type uploadFile struct {
+	fs     *fileSystem
+	ctx    context.Context
+	name   string
+	parent drive.Node
+	pw     *io.PipeWriter
+	done   chan error
+	size   int64
+	// copied is set if the file was copied by ReadFrom.
+	copied bool
+	// body is the request body the contents are copied from, nil if they
+	// aren't copied from a request.
+	body *requestBody
+}
+
+func (f *uploadFile) start() {
+	pr, pw := io.Pipe()
+	f.pw = pw
+	f.done = make(chan error, 1)
+
+	go func() {
+		file, err := f.fs.drive.Put(f.ctx, f.fs.user, f.parent, path.Base(f.name), pr, -1)
+		if err == nil {
+			f.fs.audit.Record(f.ctx, f.fs.user, audit.FileEvent(audit.ActionUpload, file))
+		}
+		// Unblock the writer if the upload failed early
+		pr.CloseWithError(err)
+		f.done <- err
+	}()
+}
+
+func (f *uploadFile) Write(p []byte) (int, error) {
+	if f.copied {
+		return 0, os.ErrInvalid
+	}
+	if f.pw == nil {
+		f.start()
+	}
+
+	n, err := f.pw.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// ReadFrom is called by io.Copy. The webdav handler copies files by opening
+// the source and copying it into the destination, files of the drive are
+// copied by Drive.Copy instead, which doesn't store their contents again.
+func (f *uploadFile) ReadFrom(r io.Reader) (int64, error) {
+	src, ok := r.(*objectFile)
+	if !ok || f.pw != nil || f.copied {
+		// Without ReadFrom, so that io.Copy doesn't call it again
+		return io.Copy(struct{ io.Writer }{f}, r)
+	}
+
+	file, err := f.fs.drive.Copy(f.ctx, f.fs.user, src.node, f.parent, path.Base(f.name))
+	if err != nil {
+		return 0, pathError("copy", f.name, err)
+	}
+
+	f.fs.audit.Record(f.ctx, f.fs.user, audit.FileEvent(audit.ActionUpload, file))
+	f.copied = true
+	f.size = file.FileSize
+	return file.FileSize, nil
+}
+
+// Close finishes the upload, or aborts it if the request body wasn't read
+// completely, so that the file keeps its contents.
+func (f *uploadFile) Close() error {
+	if f.copied {
+		f.fs.forget(f.name)
+		return nil
+	}
+	if f.pw == nil {
+		// Empty files are uploaded too
+		f.start()
+	}
+
+	if f.body != nil {
+		err := f.body.incomplete()
+		if err != nil {
+			f.pw.CloseWithError(err)
+			<-f.done
+			f.fs.forget(f.name)
+			return pathError("write", f.name, err)
+		}
+	}
+
+	err := f.pw.Close()
+	if err != nil {
+		return err
+	}
+
+	err = <-f.done
+	f.fs.forget(f.name)
+	if err != nil {
+		return pathError("write", f.name, err)
+	}
+	return nil
+}
+
+func (f *uploadFile) Stat() (os.FileInfo, error) {
+	name := path.Base(f.name)
+	return fileInfo{node: drive.Node{Kind: drive.KindFile, Name: name, File: db.File{Name: name, FileSize: f.size}}}, nil
+}
+
+func (f *uploadFile) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *uploadFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *uploadFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
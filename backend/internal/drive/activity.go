@@ -0,0 +1,277 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/webhook"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Actions shown in the activity feed of a file.
+const (
+	ActivityCreate   = db.FileActivityActionCreate
+	ActivityVersion  = db.FileActivityActionVersion
+	ActivityRename   = db.FileActivityActionRename
+	ActivityMove     = db.FileActivityActionMove
+	ActivityDelete   = db.FileActivityActionDelete
+	ActivityTransfer = db.FileActivityActionTransfer
+	ActivityRestore  = db.FileActivityActionRestore
+)
+
+const (
+	DefaultActivityLimit = 50
+	MaxActivityLimit     = 200
+	// activityBatchSize is the number of events fetched at once, before the
+	// ones of files the user may not see are dropped.
+	activityBatchSize = 200
+	// activityGroupWindow is the longest gap between events of the same user
+	// and action that are shown as one entry, e.g. saving a document every
+	// few seconds.
+	activityGroupWindow = 10 * time.Minute
+)
+
+// recordActivity adds an event to the activity feed of the file, which is
+// also the next change of the changes feed, queues webhooks and notifies the
+// event streams. It is called with the transaction of the change.
+func (s *Service) recordActivity(ctx context.Context, q *db.Queries, user *db.User, file db.File, action db.FileActivityAction, details map[string]string) error {
+	// Locks the sequence of the organisation until the change is committed,
+	// so later changes can't be committed before earlier ones
+	seq, err := q.ChangeSequenceNext(ctx, file.OrganisationID)
+	if err != nil {
+		return err
+	}
+
+	data := []byte("{}")
+	if details != nil {
+		data, err = json.Marshal(details)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = q.FileActivityCreate(ctx, db.FileActivityCreateParams{
+		OrganisationID: file.OrganisationID,
+		FileID:         file.ID,
+		UserID:         pgtype.Text{String: user.ID, Valid: true},
+		Action:         action,
+		Details:        data,
+		Seq:            seq,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ActivityCreate:
+		err = webhook.Enqueue(ctx, q, file.OrganisationID, webhook.EventFileCreated, webhook.NewFileData(file, user))
+	case ActivityDelete:
+		err = webhook.Enqueue(ctx, q, file.OrganisationID, webhook.EventFileDeleted, webhook.NewFileData(file, user))
+	}
+	if err != nil {
+		return err
+	}
+
+	return q.ChangeNotify(ctx, file.OrganisationID)
+}
+
+// ActivityOptions are the scope and position of a page of an activity feed.
+type ActivityOptions struct {
+	// Descendants includes the events of all files in a folder.
+	Descendants bool
+	Limit       int
+	// Cursor is ActivityPage.NextCursor of the previous page.
+	Cursor string
+}
+
+// ActivityFile is a file an activity is about, with the name it has now.
+type ActivityFile struct {
+	ID   string
+	Name string
+}
+
+// Activity is one entry of an activity feed. Rapid events of the same user
+// and action are grouped into one entry.
+type Activity struct {
+	Action db.FileActivityAction
+	// UserID and UserName are who made the change. They are empty if the
+	// user doesn't exist anymore.
+	UserID   string
+	UserName string
+	// Files are the files of the events, the latest first, without
+	// duplicates.
+	Files []ActivityFile
+	// Count is the number of events in the group.
+	Count int
+	// Details are those of the latest event. For events of a single file
+	// the "from" details are those of the first one, so that several renames
+	// show the first and the last name.
+	Details map[string]string
+	// StartedAt is the time of the first event, EndedAt of the latest one.
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+type ActivityPage struct {
+	Activities []Activity
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+type activityRow struct {
+	db.FileActivity
+	UserName string `db:"user_name"`
+	FileName string `db:"file_name"`
+}
+
+func (row activityRow) details() map[string]string {
+	details := map[string]string{}
+	_ = json.Unmarshal(row.Details, &details)
+	return details
+}
+
+// add merges an older event into the group if it belongs to it.
+func (a *Activity) add(row activityRow) bool {
+	if row.Action != a.Action || row.UserID.String != a.UserID || a.StartedAt.Sub(row.CreatedAt) > activityGroupWindow {
+		return false
+	}
+
+	single := len(a.Files) == 1 && a.Files[0].ID == row.FileID
+	if single {
+		for key, value := range row.details() {
+			if strings.HasPrefix(key, "from") {
+				a.Details[key] = value
+			}
+		}
+	}
+
+	found := false
+	for _, file := range a.Files {
+		found = found || file.ID == row.FileID
+	}
+	if !found {
+		a.Files = append(a.Files, ActivityFile{ID: row.FileID, Name: row.FileName})
+	}
+
+	a.Count++
+	a.StartedAt = row.CreatedAt
+	return true
+}
+
+// Activity returns a page of the activity feed of a file or folder, the latest
+// first. Events of files in the folder the user may not see are left out.
+func (s *Service) Activity(ctx context.Context, user *db.User, node Node, opts ActivityOptions) (ActivityPage, error) {
+	if node.Kind != KindFile || (opts.Descendants && !node.IsDir()) {
+		return ActivityPage{}, ErrInvalid
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultActivityLimit
+	}
+	limit = min(limit, MaxActivityLimit)
+
+	query := s.DB.NewQueryBuilder().
+		Select("a.*", "COALESCE(u.first_name || ' ' || u.last_name, '') AS user_name", "f.name AS file_name").
+		From("file_activities a").
+		Join("files f ON f.id = a.file_id").
+		LeftJoin("users u ON u.id = a.user_id").
+		Where(squirrel.Eq{"a.organisation_id": user.OrganisationID}).
+		OrderBy("a.created_at DESC", "a.id DESC")
+
+	if opts.Descendants {
+		query = query.Where("a.file_id IN (WITH RECURSIVE descendants AS (SELECT id FROM files WHERE id = ?"+
+			" UNION ALL SELECT c.id FROM files c INNER JOIN descendants d ON c.parent_id = d.id)"+
+			" SELECT id FROM descendants)", node.File.ID)
+	} else {
+		query = query.Where(squirrel.Eq{"a.file_id": node.File.ID})
+	}
+
+	after := viewCursor{}
+	if opts.Cursor != "" {
+		var err error
+		after, err = parseViewCursor(opts.Cursor)
+		if err != nil {
+			return ActivityPage{}, err
+		}
+	}
+
+	page := ActivityPage{Activities: make([]Activity, 0, limit)}
+	for scanned := 0; scanned < maxPageScan; {
+		q := query
+		if after.ID != "" {
+			q = q.Where("(a.created_at, a.id) < (?, ?)", after.ListedAt, after.ID)
+		}
+
+		rows, err := database.ScanSelectMany[activityRow](s.DB, ctx, q.Limit(activityBatchSize))
+		if err != nil {
+			return ActivityPage{}, err
+		}
+
+		visible, err := s.activityFilter(ctx, user, node, rows)
+		if err != nil {
+			return ActivityPage{}, err
+		}
+
+		for _, row := range rows {
+			n := len(page.Activities)
+			switch {
+			case !visible[row.FileID]:
+			case n > 0 && page.Activities[n-1].add(row):
+			case n == limit:
+				page.NextCursor = after.String()
+				return page, nil
+			default:
+				page.Activities = append(page.Activities, Activity{
+					Action:    row.Action,
+					UserID:    row.UserID.String,
+					UserName:  row.UserName,
+					Files:     []ActivityFile{{ID: row.FileID, Name: row.FileName}},
+					Count:     1,
+					Details:   row.details(),
+					StartedAt: row.CreatedAt,
+					EndedAt:   row.CreatedAt,
+				})
+			}
+			after = viewCursor{ListedAt: row.CreatedAt, ID: row.ID}
+		}
+
+		if len(rows) < activityBatchSize {
+			return page, nil
+		}
+		scanned += len(rows)
+	}
+
+	page.NextCursor = after.String()
+	return page, nil
+}
+
+// activityFilter returns the IDs of the files of the events the user may see.
+func (s *Service) activityFilter(ctx context.Context, user *db.User, node Node, rows []activityRow) (map[string]bool, error) {
+	visible := map[string]bool{node.File.ID: true}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if _, ok := visible[row.FileID]; !ok {
+			visible[row.FileID] = false
+			ids = append(ids, row.FileID)
+		}
+	}
+	if len(ids) == 0 {
+		return visible, nil
+	}
+
+	accesses, _, err := s.accessByID(ctx, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		visible[id] = accesses[id].role(user) != RoleNone
+	}
+	return visible, nil
+}
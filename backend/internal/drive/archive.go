@@ -0,0 +1,198 @@
+package drive
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// defaultArchiveLimit is the maximum total size of the files in one archive
+// unless ARCHIVE_MAX_SIZE is set.
+const defaultArchiveLimit = 10 << 30
+
+// Archive is a ZIP archive of files and folders. It is planned up front, so
+// that the size limit can be checked before anything is sent, and written
+// on the fly from the storage.
+type Archive struct {
+	service *Service
+	entries []archiveEntry
+	// Size is the total size of the files in the archive.
+	Size int64
+}
+
+type archiveEntry struct {
+	path string
+	node Node
+}
+
+// Archive collects nodes and the contents of folders into an archive. Entries
+// the user can't see are left out. Entries with the same name get a number
+// appended, as the nodes may come from different folders.
+func (s *Service) Archive(ctx context.Context, user *db.User, nodes []Node) (*Archive, error) {
+	a := &Archive{service: s}
+	used := make(map[string]bool)
+
+	for _, node := range nodes {
+		err := a.add(ctx, user, "", node, used)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (a *Archive) add(ctx context.Context, user *db.User, dir string, node Node, used map[string]bool) error {
+	if node.Kind != KindFile || node.Role < RoleViewer {
+		return nil
+	}
+
+	p := uniquePath(dir, archiveName(node.Name), node.IsDir(), used)
+	a.entries = append(a.entries, archiveEntry{path: p, node: node})
+
+	if !node.IsDir() {
+		a.Size += node.File.FileSize
+		if a.Size > a.service.ArchiveLimit {
+			return ErrTooLarge
+		}
+		return nil
+	}
+
+	children, err := a.service.List(ctx, user, node)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		err = a.add(ctx, user, p, child, used)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveName replaces characters that would change the structure of the
+// archive.
+func archiveName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// uniquePath joins dir and name, appending " (1)", " (2)", ... before the
+// extension if the path is taken. Paths are compared case insensitively, as
+// most file systems the archive is extracted to do so.
+func uniquePath(dir string, name string, isDir bool, used map[string]bool) string {
+	ext := ""
+	if !isDir {
+		ext = path.Ext(name)
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	p := path.Join(dir, name)
+	for i := 1; used[strings.ToLower(p)]; i++ {
+		p = path.Join(dir, base+" ("+strconv.Itoa(i)+")"+ext)
+	}
+
+	used[strings.ToLower(p)] = true
+	return p
+}
+
+// Write streams the archive to w. Files whose contents can't be read are
+// skipped. An error after the first byte leaves a truncated archive, which
+// clients detect by the missing central directory.
+func (a *Archive) Write(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range a.entries {
+		file := entry.node.File
+
+		if entry.node.IsDir() {
+			_, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     entry.path + "/",
+				Method:   zip.Store,
+				Modified: file.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := a.writeFile(ctx, zw, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Switches to ZIP64 records if there are too many entries or the
+	// archive is larger than 4 GiB
+	return zw.Close()
+}
+
+func (a *Archive) writeFile(ctx context.Context, zw *zip.Writer, entry archiveEntry) error {
+	file := entry.node.File
+
+	object, err := a.service.Storage.Open(ctx, ObjectName(file))
+	if errors.Is(err, storage.ErrNotExist) {
+		slog.Warn("skipping file in archive", "id", file.ID, "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// Stat fetches the object, so missing contents are noticed before the
+	// entry is started
+	info, err := object.Stat()
+	if err != nil {
+		slog.Warn("skipping file in archive", "id", file.ID, "err", err)
+		return nil
+	}
+
+	method := zip.Deflate
+	if !compressible(file.MimeType) {
+		method = zip.Store
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.path,
+		Method:   method,
+		Modified: info.LastModified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, object)
+	return err
+}
+
+// compressible reports whether deflating files of the mime type is worth it.
+// Media and archives are compressed already.
+func compressible(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml",
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"):
+		return false
+	}
+
+	switch mimeType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/x-bzip2", "application/x-xz", "application/zstd",
+		"application/pdf":
+		return false
+	}
+	return true
+}
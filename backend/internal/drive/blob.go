@@ -0,0 +1,220 @@
+package drive
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// blobPrefix is where content addressed objects are stored, named by the
+	// SHA-256 of their contents.
+	blobPrefix = "blobs/"
+	// uploadPrefix holds uploads of content addressed storage until their
+	// hash is known.
+	uploadPrefix = "uploads/"
+
+	// collectBatchSize is the number of blobs deleted per transaction.
+	collectBatchSize = 100
+	// staleUploadAge is the age after which uploads are considered left
+	// behind by a crash.
+	staleUploadAge = 24 * time.Hour
+)
+
+// object is the result of writing the contents of a file.
+type object struct {
+	// key is the name the contents were written to.
+	key  string
+	size int64
+	// sums are the checksums of the contents, nil if they weren't computed
+	// while writing.
+	sums *checksums
+}
+
+func blobName(hash string) string {
+	return blobPrefix + hash
+}
+
+// ObjectName returns the name of the object holding the contents of a file.
+func ObjectName(file db.File) string {
+	if file.BlobHash.Valid {
+		return blobName(file.BlobHash.String)
+	}
+	return file.ID
+}
+
+// blobHash returns the name of the blob holding contents. Encrypted blobs are
+// only shared within an organisation, so their hash includes it.
+func (s *Service) blobHash(organisationID string, sums checksums) string {
+	if !s.Encrypted {
+		return sums.sha256
+	}
+
+	hash := sha256.Sum256([]byte(organisationID + "/" + sums.sha256))
+	return hex.EncodeToString(hash[:])
+}
+
+// uploadName returns where new contents of a file are written to. Without
+// content addressed storage that is the final object.
+func (s *Service) uploadName(id string) (string, error) {
+	if !s.ContentAddressed {
+		return id, nil
+	}
+
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", err
+	}
+	return uploadPrefix + id + "/" + hex.EncodeToString(suffix), nil
+}
+
+// commitContent records new contents of a file. Uploads of content addressed
+// storage are moved to their blob, which is referenced instead of the old
+// one. qtx has to be a transaction, the row lock on the blob keeps the
+// garbage collector from deleting it in between.
+func (s *Service) commitContent(ctx context.Context, qtx *db.Queries, file db.File, mimeType string, obj object) (db.File, error) {
+	if obj.sums == nil {
+		sums, err := s.checksumObject(ctx, obj.key)
+		if err != nil {
+			return db.File{}, err
+		}
+		obj.sums = &sums
+	}
+
+	var blobHash pgtype.Text
+	if obj.key != file.ID {
+		hash := s.blobHash(file.OrganisationID, *obj.sums)
+		err := qtx.BlobRetain(ctx, db.BlobRetainParams{Hash: hash, Size: obj.size})
+		if err != nil {
+			return db.File{}, err
+		}
+
+		err = s.storeBlob(ctx, hash, obj)
+		if err != nil {
+			return db.File{}, err
+		}
+
+		blobHash = pgtype.Text{String: hash, Valid: true}
+	}
+
+	// Retained first, so a blob replaced by itself never drops to zero
+	if file.BlobHash.Valid {
+		err := qtx.BlobRelease(ctx, file.BlobHash.String)
+		if err != nil {
+			return db.File{}, err
+		}
+	}
+
+	return qtx.FileUpdateContent(ctx, db.FileUpdateContentParams{
+		FileSize:       obj.size,
+		MimeType:       mimeType,
+		BlobHash:       blobHash,
+		Sha256:         pgtype.Text{String: obj.sums.sha256, Valid: true},
+		Md5:            pgtype.Text{String: obj.sums.md5, Valid: true},
+		ID:             file.ID,
+		OrganisationID: file.OrganisationID,
+	})
+}
+
+// storeBlob copies an upload to its blob, unless the blob exists already.
+func (s *Service) storeBlob(ctx context.Context, hash string, obj object) error {
+	_, err := s.Storage.Stat(ctx, blobName(hash))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+
+	_, err = s.Storage.Copy(ctx, blobName(hash), obj.key)
+	return err
+}
+
+// removeUpload deletes an upload of content addressed storage once its
+// contents are committed or the write failed.
+func (s *Service) removeUpload(ctx context.Context, id string, key string) {
+	if key == id {
+		return
+	}
+
+	err := s.Storage.Delete(context.WithoutCancel(ctx), key)
+	if err != nil {
+		slog.Error("error removing upload", "key", key, "err", err)
+	}
+}
+
+// removeObject deletes an object of a file other than a blob, after the file
+// was purged or its copy failed.
+func (s *Service) removeObject(ctx context.Context, id string) {
+	err := s.Storage.Delete(context.WithoutCancel(ctx), id)
+	if err != nil && !errors.Is(err, storage.ErrNotExist) {
+		slog.Error("error removing object", "id", id, "err", err)
+	}
+}
+
+// CollectGarbage deletes blobs no file references anymore and uploads left
+// behind by crashes. It returns the number of deleted blobs.
+func (s *Service) CollectGarbage(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		n, err := s.collectBlobs(ctx)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if n < collectBatchSize {
+			break
+		}
+	}
+
+	return deleted, s.collectUploads(ctx)
+}
+
+func (s *Service) collectBlobs(ctx context.Context) (int, error) {
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	// The rows stay locked until the objects are gone, so a concurrent
+	// upload of the same contents waits and then creates the blob again
+	blobs, err := qtx.BlobFindUnreferenced(ctx, collectBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, blob := range blobs {
+		err = s.Storage.Delete(ctx, blobName(blob.Hash))
+		if err != nil {
+			return 0, err
+		}
+
+		err = qtx.BlobDelete(ctx, blob.Hash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(blobs), tx.Commit(ctx)
+}
+
+func (s *Service) collectUploads(ctx context.Context) error {
+	return s.Storage.List(ctx, uploadPrefix, func(info storage.ObjectInfo) error {
+		if time.Since(info.LastModified) < staleUploadAge {
+			return nil
+		}
+		return s.Storage.Delete(ctx, info.Key)
+	})
+}
@@ -0,0 +1,234 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// defaultChangeRetention is how long changes are kept unless
+	// CHANGES_RETENTION_DAYS is set.
+	defaultChangeRetention = 180 * 24 * time.Hour
+
+	DefaultChangesLimit = 500
+	MaxChangesLimit     = 1000
+)
+
+// ErrCursorExpired is returned if the changes after a cursor were pruned
+// already. The client has to list all files again.
+var ErrCursorExpired = errors.New("cursor expired")
+
+// Change is a change of a file. The changes of an organisation are numbered
+// in the order they were committed.
+type Change struct {
+	Seq    int64
+	Action db.FileActivityAction
+	// File is the file as it is now, which may be different from right after
+	// the change. DeletedAt is set if it is in the trash.
+	File db.File
+	// Removed is true if the change took the file away from the user, e.g.
+	// it was moved into a folder the user may not see. Only File.ID is set
+	// then.
+	Removed   bool
+	ChangedAt time.Time
+}
+
+type ChangesPage struct {
+	Changes []Change
+	// Cursor is the sequence number of the last change checked, passed to
+	// Changes for the next page.
+	Cursor int64
+	// HasMore is true if there may be more changes after Cursor.
+	HasMore bool
+}
+
+type changeRow struct {
+	Seq       int64                 `db:"seq"`
+	Action    db.FileActivityAction `db:"action"`
+	Details   []byte                `db:"activity_details"`
+	ChangedAt time.Time             `db:"changed_at"`
+	db.File
+}
+
+func (r changeRow) details() map[string]string {
+	var details map[string]string
+	_ = json.Unmarshal(r.Details, &details)
+	return details
+}
+
+// LatestCursor returns the cursor of the latest change of the organisation,
+// from which a client that just listed all files continues.
+func (s *Service) LatestCursor(ctx context.Context, user *db.User) (int64, error) {
+	seq, err := s.DB.ChangeSequenceFind(ctx, user.OrganisationID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return seq.Seq, err
+}
+
+// Changes returns the changes after cursor of the files the user may see, in
+// order. Moves and transfers that took a file away from the user are
+// returned as removed. Other changes of access, like revoked permissions or
+// group memberships, aren't changes of the file, clients list all files again
+// to catch up with them.
+func (s *Service) Changes(ctx context.Context, user *db.User, cursor int64, limit int) (ChangesPage, error) {
+	if limit <= 0 {
+		limit = DefaultChangesLimit
+	}
+	limit = min(limit, MaxChangesLimit)
+
+	seq, err := s.DB.ChangeSequenceFind(ctx, user.OrganisationID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return ChangesPage{}, err
+	}
+	if cursor < seq.PrunedSeq {
+		return ChangesPage{}, ErrCursorExpired
+	}
+	if cursor < 0 || cursor > seq.Seq {
+		return ChangesPage{}, ErrInvalid
+	}
+
+	query := s.DB.NewQueryBuilder().
+		Select("a.seq", "a.action", "a.details AS activity_details", "a.created_at AS changed_at", "f.*").
+		From("file_activities a").
+		Join("files f ON f.id = a.file_id").
+		Where(squirrel.Eq{"a.organisation_id": user.OrganisationID}).
+		OrderBy("a.seq")
+
+	page := ChangesPage{Changes: make([]Change, 0, limit), Cursor: cursor}
+	for scanned := 0; scanned < maxPageScan; {
+		rows, err := database.ScanSelectMany[changeRow](s.DB, ctx, query.Where(squirrel.Gt{"a.seq": page.Cursor}).Limit(uint64(limit)))
+		if err != nil {
+			return ChangesPage{}, err
+		}
+
+		visible, err := s.changesFilter(ctx, user, rows)
+		if err != nil {
+			return ChangesPage{}, err
+		}
+
+		removed, err := s.changesRemoved(ctx, user, rows, visible)
+		if err != nil {
+			return ChangesPage{}, err
+		}
+
+		for _, row := range rows {
+			switch {
+			case visible[row.File.ID]:
+				page.Changes = append(page.Changes, Change{
+					Seq:       row.Seq,
+					Action:    row.Action,
+					File:      row.File,
+					ChangedAt: row.ChangedAt,
+				})
+			case removed[row.Seq]:
+				page.Changes = append(page.Changes, Change{
+					Seq:       row.Seq,
+					Action:    row.Action,
+					File:      db.File{ID: row.File.ID},
+					Removed:   true,
+					ChangedAt: row.ChangedAt,
+				})
+			}
+			page.Cursor = row.Seq
+
+			if len(page.Changes) == limit {
+				page.HasMore = true
+				return page, nil
+			}
+		}
+
+		if len(rows) < limit {
+			return page, nil
+		}
+		scanned += len(rows)
+	}
+
+	page.HasMore = true
+	return page, nil
+}
+
+// changesFilter returns the IDs of the changed files the user may see,
+// including the ones in the trash.
+func (s *Service) changesFilter(ctx context.Context, user *db.User, rows []changeRow) (map[string]bool, error) {
+	visible := make(map[string]bool, len(rows))
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if _, ok := visible[row.File.ID]; !ok {
+			visible[row.File.ID] = false
+			ids = append(ids, row.File.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return visible, nil
+	}
+
+	accesses, _, err := s.accessByID(ctx, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		visible[id] = accesses[id].role(user) != RoleNone
+	}
+	return visible, nil
+}
+
+// changesRemoved returns the sequence numbers of the changes that took a
+// file the user can't see away from them. The user could see a moved file
+// before if they may see the folder it was moved from, and a transferred file
+// if they owned it. Moves recorded without the folder are skipped.
+func (s *Service) changesRemoved(ctx context.Context, user *db.User, rows []changeRow, visible map[string]bool) (map[int64]bool, error) {
+	removed := make(map[int64]bool)
+
+	moves := make(map[int64]string)
+	var parentIDs []string
+	for _, row := range rows {
+		if visible[row.File.ID] {
+			continue
+		}
+
+		switch row.Action {
+		case ActivityTransfer:
+			removed[row.Seq] = row.details()["from"] == user.ID
+		case ActivityMove:
+			parentID := row.details()["from_parent_id"]
+			if parentID != "" {
+				moves[row.Seq] = parentID
+				parentIDs = append(parentIDs, parentID)
+			}
+		}
+	}
+	if len(parentIDs) == 0 {
+		return removed, nil
+	}
+
+	accesses, _, err := s.accessByID(ctx, user, parentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for seq, parentID := range moves {
+		access, ok := accesses[parentID]
+		removed[seq] = ok && access.role(user) != RoleNone
+	}
+	return removed, nil
+}
+
+// PruneChanges deletes the changes, and with them the activity, older than
+// the retention period and returns how many there were. Cursors before them
+// expire.
+func (s *Service) PruneChanges(ctx context.Context) (int64, error) {
+	if s.ChangeRetention == 0 {
+		return 0, nil
+	}
+
+	return s.DB.ChangePrune(ctx, pgtype.Timestamptz{Time: time.Now().Add(-s.ChangeRetention), Valid: true})
+}
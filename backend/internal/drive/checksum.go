@@ -0,0 +1,204 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// checksums are the hex encoded checksums of contents.
+type checksums struct {
+	sha256 string
+	md5    string
+}
+
+// Digest holds checksums a client sent along with the contents. Unset
+// checksums aren't verified.
+type Digest struct {
+	SHA256 []byte
+	MD5    []byte
+}
+
+func (d Digest) empty() bool {
+	return d.SHA256 == nil && d.MD5 == nil
+}
+
+// ParseContentDigest parses a Content-Digest header (RFC 9530), e.g.
+// "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:". Algorithms other
+// than sha-256 and md5 are ignored.
+func ParseContentDigest(header string) (Digest, error) {
+	var d Digest
+
+	for _, member := range strings.Split(header, ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			return Digest{}, fmt.Errorf("%w: malformed digest", ErrInvalid)
+		}
+
+		// Byte sequences are base64 enclosed in colons
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return Digest{}, fmt.Errorf("%w: malformed digest", ErrInvalid)
+		}
+		sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return Digest{}, fmt.Errorf("%w: malformed digest", ErrInvalid)
+		}
+
+		switch strings.ToLower(algorithm) {
+		case "sha-256":
+			if len(sum) != sha256.Size {
+				return Digest{}, fmt.Errorf("%w: malformed digest", ErrInvalid)
+			}
+			d.SHA256 = sum
+		case "md5":
+			if len(sum) != md5.Size {
+				return Digest{}, fmt.Errorf("%w: malformed digest", ErrInvalid)
+			}
+			d.MD5 = sum
+		}
+	}
+
+	return d, nil
+}
+
+// checksumReader computes the checksums of everything read through it. If a
+// digest is set, the last read fails with ErrChecksumMismatch if the
+// contents don't match, before the reader of the upload sees io.EOF.
+type checksumReader struct {
+	r      io.Reader
+	sha256 hash.Hash
+	md5    hash.Hash
+	n      int64
+	// size is the expected size or -1 if the contents are read up to io.EOF.
+	size     int64
+	digest   Digest
+	mismatch bool
+}
+
+func newChecksumReader(r io.Reader, size int64, digest Digest) *checksumReader {
+	return &checksumReader{r: r, sha256: sha256.New(), md5: md5.New(), size: size, digest: digest}
+}
+
+// Verify wraps r so that the upload it is passed to fails with
+// ErrChecksumMismatch if the contents don't match digest. size may be -1 if
+// it is unknown.
+func Verify(r io.Reader, size int64, digest Digest) io.Reader {
+	return newChecksumReader(r, size, digest)
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.sha256.Write(p[:n])
+	c.md5.Write(p[:n])
+	c.n += int64(n)
+
+	// Uploads of known size stop reading at the last byte, without waiting
+	// for io.EOF
+	done := errors.Is(err, io.EOF) || (c.size >= 0 && c.n >= c.size)
+	if done && !c.digest.empty() && !c.matches() {
+		c.mismatch = true
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+func (c *checksumReader) matches() bool {
+	if c.digest.SHA256 != nil && !bytes.Equal(c.digest.SHA256, c.sha256.Sum(nil)) {
+		return false
+	}
+	if c.digest.MD5 != nil && !bytes.Equal(c.digest.MD5, c.md5.Sum(nil)) {
+		return false
+	}
+	return true
+}
+
+func (c *checksumReader) sums() checksums {
+	return checksums{
+		sha256: hex.EncodeToString(c.sha256.Sum(nil)),
+		md5:    hex.EncodeToString(c.md5.Sum(nil)),
+	}
+}
+
+// checksumObject reads an object to compute the checksums of its contents.
+func (s *Service) checksumObject(ctx context.Context, key string) (checksums, error) {
+	reader, err := s.Storage.Open(ctx, key)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer reader.Close()
+
+	c := newChecksumReader(reader, -1, Digest{})
+	_, err = io.Copy(io.Discard, c)
+	if err != nil {
+		return checksums{}, err
+	}
+	return c.sums(), nil
+}
+
+// ScrubResult summarises a run of Scrub.
+type ScrubResult struct {
+	Checked int
+	// Corrupted are the files whose contents don't match their checksums
+	// or are missing.
+	Corrupted []db.File
+}
+
+// Scrub re-reads the contents of up to limit files that weren't verified
+// since before and flags those whose checksums don't match anymore. Files
+// uploaded before checksums were recorded get them from their current
+// contents.
+func (s *Service) Scrub(ctx context.Context, before time.Time, limit int32) (ScrubResult, error) {
+	files, err := s.DB.FileFindUnscrubbed(ctx, db.FileFindUnscrubbedParams{
+		ScrubbedBefore: pgtype.Timestamptz{Time: before, Valid: true},
+		MaxCount:       limit,
+	})
+	if err != nil {
+		return ScrubResult{}, err
+	}
+
+	var result ScrubResult
+	for _, file := range files {
+		sums, err := s.checksumObject(ctx, ObjectName(file))
+		missing := errors.Is(err, storage.ErrNotExist)
+		if err != nil && !missing {
+			return result, err
+		}
+
+		corrupted := missing ||
+			(file.Sha256.Valid && file.Sha256.String != sums.sha256) ||
+			(file.Md5.Valid && file.Md5.String != sums.md5)
+
+		params := db.FileUpdateScrubbedParams{Corrupted: corrupted, ID: file.ID}
+		if !missing {
+			params.Sha256 = pgtype.Text{String: sums.sha256, Valid: true}
+			params.Md5 = pgtype.Text{String: sums.md5, Valid: true}
+		}
+
+		err = s.DB.FileUpdateScrubbed(ctx, params)
+		if err != nil {
+			return result, err
+		}
+
+		result.Checked++
+		if corrupted {
+			slog.Warn("file contents are corrupted", "id", file.ID, "organisation_id", file.OrganisationID, "missing", missing)
+			result.Corrupted = append(result.Corrupted, file)
+		}
+	}
+
+	return result, nil
+}
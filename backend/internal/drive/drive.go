@@ -0,0 +1,1115 @@
+// Package drive implements the virtual file tree shared by the protocol
+// front ends (REST, WebDAV, ...). It resolves paths, enforces
+// file_permissions and streams file contents to and from the object storage.
+package drive
+
+import (
+	"context"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrExists    = errors.New("already exists")
+	ErrInvalid   = errors.New("invalid operation")
+	// ErrQuotaExceeded is returned if a write would exceed the storage quota
+	// of the organisation.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrTooLarge is returned if an archive would exceed ArchiveLimit.
+	ErrTooLarge = errors.New("too large")
+	// ErrChecksumMismatch is returned if uploaded contents don't match the
+	// digest sent by the client.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+const (
+	// MyFilesName is the name of the personal root in the virtual tree.
+	MyFilesName = "My Files"
+	// SharedDrivesName is the name of the collection holding all shared
+	// drives in the virtual tree.
+	SharedDrivesName = "Shared Drives"
+
+	// defaultQuota is the total size of files an organisation may store
+	// unless ORGANISATION_QUOTA is set.
+	defaultQuota = 1 << 40
+
+	// defaultTrashRetention is how long files stay in the trash unless
+	// TRASH_RETENTION_DAYS is set.
+	defaultTrashRetention = 30 * 24 * time.Hour
+	// purgeBatchSize is the number of trashed files, with the files in them,
+	// purged per transaction.
+	purgeBatchSize = 100
+
+	// defaultUploadRetention is how long multipart uploads may take before
+	// they are aborted, unless MULTIPART_RETENTION_DAYS is set.
+	defaultUploadRetention = 7 * 24 * time.Hour
+	// abortBatchSize is the number of stale multipart uploads fetched at
+	// once.
+	abortBatchSize = 100
+)
+
+type Service struct {
+	DB      *database.DB
+	Storage storage.Storage
+	// Quota is the maximum total size of files per organisation in bytes.
+	Quota int64
+	// ArchiveLimit is the maximum total size of the files in an archive.
+	ArchiveLimit int64
+	// ContentAddressed stores new contents as blobs named by their SHA-256,
+	// so that identical files are only stored once.
+	ContentAddressed bool
+	// Encrypted scopes blobs to their organisation, as the data key of a
+	// blob is wrapped with the key of the organisation that uploaded it.
+	Encrypted bool
+	// ChangeRetention is how long changes and activity are kept. They are
+	// kept forever if it is 0.
+	ChangeRetention time.Duration
+	// TrashRetention is how long files stay in the trash before they are
+	// purged. They are kept forever if it is 0.
+	TrashRetention time.Duration
+	// UploadRetention is how long multipart uploads may take before their
+	// parts are deleted. They are kept forever if it is 0.
+	UploadRetention time.Duration
+}
+
+func New(db *database.DB, store storage.Storage) *Service {
+	quota, err := strconv.ParseInt(os.Getenv("ORGANISATION_QUOTA"), 10, 64)
+	if err != nil {
+		quota = defaultQuota
+	}
+
+	archiveLimit, err := strconv.ParseInt(os.Getenv("ARCHIVE_MAX_SIZE"), 10, 64)
+	if err != nil {
+		archiveLimit = defaultArchiveLimit
+	}
+
+	_, encrypted := store.(*storage.Encrypted)
+
+	changeRetention := defaultChangeRetention
+	days, err := strconv.Atoi(os.Getenv("CHANGES_RETENTION_DAYS"))
+	if err == nil && days >= 0 {
+		changeRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	trashRetention := defaultTrashRetention
+	days, err = strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err == nil && days >= 0 {
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	uploadRetention := defaultUploadRetention
+	days, err = strconv.Atoi(os.Getenv("MULTIPART_RETENTION_DAYS"))
+	if err == nil && days >= 0 {
+		uploadRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &Service{
+		DB:           db,
+		Storage:      store,
+		Quota:        quota,
+		ArchiveLimit: archiveLimit,
+		// Files written before keep their objects, both layouts are read
+		ContentAddressed: os.Getenv("CONTENT_ADDRESSED_STORAGE") == "true",
+		Encrypted:        encrypted,
+		ChangeRetention:  changeRetention,
+		TrashRetention:   trashRetention,
+		UploadRetention:  uploadRetention,
+	}
+}
+
+type Kind int
+
+const (
+	// KindRoot is the top of the virtual tree, containing "My Files" and
+	// "Shared Drives".
+	KindRoot Kind = iota
+	// KindMyFiles is the personal root, i.e. all files of the user without a
+	// parent that are not a shared drive.
+	KindMyFiles
+	// KindSharedDrives lists the shared drives of the organisation.
+	KindSharedDrives
+	// KindFile is a row of the files table, either a file or a folder.
+	KindFile
+)
+
+// Node is an entry of the virtual tree.
+type Node struct {
+	Kind Kind
+	Name string
+	// File is only set for KindFile.
+	File   db.File
+	Role   Role
+	access access
+}
+
+func (n Node) IsDir() bool {
+	return n.Kind != KindFile || n.File.IsFolder || n.File.SharedDrive
+}
+
+// parentID returns the value of files.parent_id for children of the node.
+func (n Node) parentID() pgtype.Text {
+	if n.Kind != KindFile {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: n.File.ID, Valid: true}
+}
+
+// ownerID returns the owner all children of the node have, which is only the
+// case for the personal root.
+func (n Node) ownerID(user *db.User) pgtype.Text {
+	if n.Kind != KindMyFiles {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: user.ID, Valid: true}
+}
+
+func (s *Service) Root(user *db.User) Node {
+	return Node{Kind: KindRoot, Name: "/", Role: RoleViewer}
+}
+
+// MyFiles returns the personal root. Everyone can create files in it.
+func (s *Service) MyFiles(user *db.User) Node {
+	return Node{Kind: KindMyFiles, Name: MyFilesName, Role: RoleManager}
+}
+
+func (s *Service) SharedDrives(user *db.User) Node {
+	return Node{Kind: KindSharedDrives, Name: SharedDrivesName, Role: RoleViewer}
+}
+
+// Find returns the node for a file by its ID.
+func (s *Service) Find(ctx context.Context, user *db.User, id string) (Node, error) {
+	file, err := s.DB.FileFindByID(ctx, db.FileFindByIDParams{
+		ID:             id,
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Node{}, ErrNotFound
+	}
+	if err != nil {
+		return Node{}, err
+	}
+
+	return s.fileNode(ctx, user, file)
+}
+
+func (s *Service) fileNode(ctx context.Context, user *db.User, file db.File) (Node, error) {
+	a, err := s.access(ctx, user, file.ID)
+	if err != nil {
+		return Node{}, err
+	}
+
+	role := a.role(user)
+	if role == RoleNone {
+		return Node{}, ErrNotFound
+	}
+
+	return Node{Kind: KindFile, Name: file.Name, File: file, Role: role, access: a}, nil
+}
+
+// Resolve walks a slash separated path from the root of the virtual tree.
+func (s *Service) Resolve(ctx context.Context, user *db.User, p string) (Node, error) {
+	node := s.Root(user)
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		var err error
+		node, err = s.Child(ctx, user, node, name)
+		if err != nil {
+			return Node{}, err
+		}
+	}
+	return node, nil
+}
+
+// Breadcrumbs returns the path to the node, starting with "My Files" or
+// "Shared Drives" and ending with the node itself. If the user can't see an
+// ancestor, the path starts below it.
+func (s *Service) Breadcrumbs(ctx context.Context, user *db.User, node Node) ([]Node, error) {
+	if node.Kind != KindFile {
+		return []Node{node}, nil
+	}
+
+	files, err := s.DB.FileFindAncestors(ctx, db.FileFindAncestorsParams{
+		ID:             node.File.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNotFound
+	}
+
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+
+	accesses, _, err := s.accessByID(ctx, user, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files in the personal root of someone else start at the first visible
+	// ancestor
+	var nodes []Node
+	switch {
+	case files[0].SharedDrive:
+		nodes = append(nodes, s.SharedDrives(user))
+	case owns(user, files[0]):
+		nodes = append(nodes, s.MyFiles(user))
+	}
+
+	for _, file := range files {
+		a := accesses[file.ID]
+		role := a.role(user)
+		if role == RoleNone {
+			nodes = nodes[:0]
+			continue
+		}
+
+		nodes = append(nodes, Node{Kind: KindFile, Name: file.Name, File: file, Role: role, access: a})
+	}
+
+	return nodes, nil
+}
+
+// Child returns the child of parent with the given name.
+func (s *Service) Child(ctx context.Context, user *db.User, parent Node, name string) (Node, error) {
+	switch {
+	case parent.Kind == KindRoot && name == MyFilesName:
+		return s.MyFiles(user), nil
+	case parent.Kind == KindRoot && name == SharedDrivesName:
+		return s.SharedDrives(user), nil
+	case parent.Kind == KindRoot, !parent.IsDir():
+		return Node{}, ErrNotFound
+	}
+
+	file, err := s.DB.FileFindChild(ctx, db.FileFindChildParams{
+		ParentID:       parent.parentID(),
+		Name:           name,
+		SharedDrive:    parent.Kind == KindSharedDrives,
+		OrganisationID: user.OrganisationID,
+		OwnerID:        parent.ownerID(user),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Node{}, ErrNotFound
+	}
+	if err != nil {
+		return Node{}, err
+	}
+
+	return s.fileNode(ctx, user, file)
+}
+
+// List returns the children of the node the user may see.
+func (s *Service) List(ctx context.Context, user *db.User, node Node) ([]Node, error) {
+	var files []db.File
+	var err error
+
+	switch node.Kind {
+	case KindRoot:
+		return []Node{s.MyFiles(user), s.SharedDrives(user)}, nil
+	case KindMyFiles:
+		files, err = s.DB.FileFindAll(ctx, db.FileFindAllParams{
+			OrganisationID: user.OrganisationID,
+			OwnerID:        pgtype.Text{String: user.ID, Valid: true},
+		})
+	case KindSharedDrives:
+		files, err = s.DB.FileFindSharedDrives(ctx, user.OrganisationID)
+	default:
+		if !node.IsDir() {
+			return nil, ErrInvalid
+		}
+		files, err = s.DB.FileFindByParentID(ctx, db.FileFindByParentIDParams{
+			ParentID:       node.parentID(),
+			OrganisationID: user.OrganisationID,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.filter(ctx, user, node, files)
+}
+
+// Open returns a reader for the contents of a file.
+func (s *Service) Open(ctx context.Context, node Node) (storage.Object, error) {
+	if node.IsDir() {
+		return nil, ErrInvalid
+	}
+	if node.Role < RoleViewer {
+		return nil, ErrForbidden
+	}
+
+	return s.Storage.Open(ctx, ObjectName(node.File))
+}
+
+// Stat returns the metadata of the object holding the contents of a file.
+func (s *Service) Stat(ctx context.Context, node Node) (storage.ObjectInfo, error) {
+	if node.IsDir() {
+		return storage.ObjectInfo{}, ErrInvalid
+	}
+	if node.Role < RoleViewer {
+		return storage.ObjectInfo{}, ErrForbidden
+	}
+
+	return s.Storage.Stat(ctx, ObjectName(node.File))
+}
+
+// Mkdir creates a folder in parent.
+func (s *Service) Mkdir(ctx context.Context, user *db.User, parent Node, name string) (db.File, error) {
+	err := s.checkCreate(ctx, user, parent, name)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	folder, err := qtx.FileCreateFolder(ctx, db.FileCreateFolderParams{
+		Name:           name,
+		ParentID:       parent.parentID(),
+		OrganisationID: user.OrganisationID,
+		CreatedBy:      pgtype.Text{String: user.ID, Valid: true},
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, folder, ActivityCreate, nil)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	return folder, tx.Commit(ctx)
+}
+
+// Create stores a new file in parent. The row is only committed once the
+// contents are stored, so a failed upload leaves nothing behind. size may be
+// -1 if it is unknown.
+func (s *Service) Create(ctx context.Context, user *db.User, parent Node, name string, mimeType string, r io.Reader, size int64) (db.File, error) {
+	if mimeType == "" {
+		mimeType = DetectMimeType(name)
+	}
+
+	return s.create(ctx, user, parent, name, mimeType, size, func(key string, replaced int64) (object, error) {
+		return s.put(ctx, user, key, mimeType, r, size, replaced)
+	})
+}
+
+// Put creates the file or replaces the contents of an existing file with the
+// same name in parent.
+func (s *Service) Put(ctx context.Context, user *db.User, parent Node, name string, r io.Reader, size int64) (db.File, error) {
+	return s.store(ctx, user, parent, name, size, func(key string, mimeType string, replaced int64) (object, error) {
+		return s.put(ctx, user, key, mimeType, r, size, replaced)
+	})
+}
+
+// Copy creates a copy of a file in parent. Contents stored as blob are only
+// referenced once more, other contents are copied in the storage.
+func (s *Service) Copy(ctx context.Context, user *db.User, node Node, parent Node, name string) (db.File, error) {
+	return s.copy(ctx, user, node, parent, name, nil)
+}
+
+// CopyOver moves existing, a file in parent, to the trash and puts a copy of
+// node in its place. Both happen in one transaction, so existing stays if the
+// copy fails.
+func (s *Service) CopyOver(ctx context.Context, user *db.User, node Node, parent Node, existing Node) (db.File, error) {
+	return s.copy(ctx, user, node, parent, existing.File.Name, &existing)
+}
+
+func (s *Service) copy(ctx context.Context, user *db.User, node Node, parent Node, name string, existing *Node) (db.File, error) {
+	if node.Kind != KindFile || node.IsDir() {
+		return db.File{}, ErrInvalid
+	}
+	if node.Role < RoleViewer {
+		return db.File{}, ErrForbidden
+	}
+
+	var err error
+	if existing == nil {
+		err = s.checkCreate(ctx, user, parent, name)
+	} else if !writable(parent) || existing.Kind != KindFile || existing.IsDir() || existing.Role < RoleManager {
+		err = ErrForbidden
+	}
+	if err != nil {
+		return db.File{}, err
+	}
+
+	src := node.File
+	_, err = s.reserve(ctx, user.OrganisationID, src.FileSize, 0)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	if existing != nil {
+		err = qtx.FileSoftDelete(ctx, existing.File.ID)
+		if err != nil {
+			return db.File{}, err
+		}
+
+		err = s.recordActivity(ctx, qtx, user, existing.File, ActivityDelete, nil)
+		if err != nil {
+			return db.File{}, err
+		}
+	}
+
+	file, err := qtx.FileCreate(ctx, db.FileCreateParams{
+		Name:           name,
+		MimeType:       src.MimeType,
+		FileSize:       src.FileSize,
+		ParentID:       parent.parentID(),
+		OrganisationID: user.OrganisationID,
+		CreatedBy:      pgtype.Text{String: user.ID, Valid: true},
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	if src.BlobHash.Valid {
+		err = qtx.BlobRetain(ctx, db.BlobRetainParams{Hash: src.BlobHash.String, Size: src.FileSize})
+	} else {
+		_, err = s.Storage.Copy(ctx, file.ID, src.ID)
+		defer func() {
+			if err != nil {
+				s.removeObject(ctx, file.ID)
+			}
+		}()
+	}
+	if err != nil {
+		return db.File{}, err
+	}
+
+	file, err = qtx.FileUpdateContent(ctx, db.FileUpdateContentParams{
+		FileSize:       src.FileSize,
+		MimeType:       src.MimeType,
+		BlobHash:       src.BlobHash,
+		Sha256:         src.Sha256,
+		Md5:            src.Md5,
+		ID:             file.ID,
+		OrganisationID: file.OrganisationID,
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, ActivityCreate, nil)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	s.RecordAccess(ctx, user, file, AccessEdit)
+	return file, nil
+}
+
+// writeFunc uploads the contents of a file to the object key. replaced is the
+// size of the contents it overwrites, which is freed in the quota.
+type writeFunc func(key string, replaced int64) (object, error)
+
+func (s *Service) create(ctx context.Context, user *db.User, parent Node, name string, mimeType string, size int64, write writeFunc) (db.File, error) {
+	if !writable(parent) {
+		return db.File{}, ErrForbidden
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	file, err := qtx.FileCreate(ctx, db.FileCreateParams{
+		Name:           name,
+		MimeType:       mimeType,
+		FileSize:       max(size, 0),
+		ParentID:       parent.parentID(),
+		OrganisationID: user.OrganisationID,
+		CreatedBy:      pgtype.Text{String: user.ID, Valid: true},
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	key, err := s.uploadName(file.ID)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer s.removeUpload(ctx, file.ID, key)
+
+	obj, err := write(key, 0)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	file, err = s.commitContent(ctx, qtx, file, mimeType, obj)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, ActivityCreate, nil)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	s.RecordAccess(ctx, user, file, AccessEdit)
+	return file, nil
+}
+
+// store creates the file or replaces the contents of an existing file with
+// the same name in parent.
+func (s *Service) store(ctx context.Context, user *db.User, parent Node, name string, size int64, write func(key string, mimeType string, replaced int64) (object, error)) (db.File, error) {
+	existing, err := s.Child(ctx, user, parent, name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		mimeType := DetectMimeType(name)
+		return s.create(ctx, user, parent, name, mimeType, size, func(key string, replaced int64) (object, error) {
+			return write(key, mimeType, replaced)
+		})
+	case err != nil:
+		return db.File{}, err
+	case existing.IsDir():
+		return db.File{}, ErrExists
+	case existing.Role < RoleManager:
+		return db.File{}, ErrForbidden
+	}
+
+	file := existing.File
+
+	key, err := s.uploadName(file.ID)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer s.removeUpload(ctx, file.ID, key)
+
+	obj, err := write(key, file.MimeType, file.FileSize)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	updated, err := s.commitContent(ctx, qtx, file, file.MimeType, obj)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, updated, ActivityVersion, nil)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	// The contents written before content addressed storage was enabled
+	// aren't needed anymore
+	if updated.BlobHash.Valid && !file.BlobHash.Valid {
+		err = s.Storage.Delete(ctx, file.ID)
+		if err != nil {
+			slog.Error("error removing replaced object", "id", file.ID, "err", err)
+		}
+	}
+
+	s.RecordAccess(ctx, user, updated, AccessEdit)
+	return updated, nil
+}
+
+// put uploads r to the object key. The checksums are computed on the way;
+// if r was returned by Verify, they are checked too.
+func (s *Service) put(ctx context.Context, user *db.User, key string, mimeType string, r io.Reader, size int64, replaced int64) (object, error) {
+	cr, ok := r.(*checksumReader)
+	if !ok {
+		cr = newChecksumReader(r, size, Digest{})
+	}
+
+	qr, err := s.limit(ctx, user.OrganisationID, cr, size, replaced)
+	if err != nil {
+		return object{}, err
+	}
+
+	info, err := s.Storage.Put(ctx, key, qr, size, storage.PutOptions{ContentType: mimeType, OrganisationID: user.OrganisationID})
+	switch {
+	case qr.exceeded:
+		return object{}, ErrQuotaExceeded
+	case cr.mismatch:
+		return object{}, ErrChecksumMismatch
+	case err != nil:
+		return object{}, err
+	}
+
+	sums := cr.sums()
+	return object{key: key, size: info.Size, sums: &sums}, nil
+}
+
+// Trash moves the file or folder to the trash.
+func (s *Service) Trash(ctx context.Context, user *db.User, node Node) error {
+	if node.Kind != KindFile {
+		return ErrForbidden
+	}
+	if node.Role < RoleManager {
+		return ErrForbidden
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	err = qtx.FileSoftDelete(ctx, node.File.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, node.File, ActivityDelete, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Restore moves a file or folder out of the trash, back into the folder it
+// was in. The folder must not be in the trash itself.
+func (s *Service) Restore(ctx context.Context, user *db.User, id string) (db.File, error) {
+	file, err := s.DB.FileFindTrashedByID(ctx, db.FileFindTrashedByIDParams{
+		ID:             id,
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.File{}, ErrNotFound
+	}
+	if err != nil {
+		return db.File{}, err
+	}
+
+	node, err := s.fileNode(ctx, user, file)
+	if err != nil {
+		return db.File{}, err
+	}
+	if node.Role < RoleManager {
+		return db.File{}, ErrForbidden
+	}
+
+	if file.ParentID.Valid {
+		_, trashed, err := s.accessByID(ctx, user, []string{file.ParentID.String})
+		if err != nil {
+			return db.File{}, err
+		}
+		if trashed[file.ParentID.String] {
+			return db.File{}, ErrInvalid
+		}
+	}
+
+	err = s.checkName(ctx, user, file, file.Name)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	file, err = qtx.FileRestore(ctx, db.FileRestoreParams{
+		ID:             file.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, ActivityRestore, nil)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	return file, tx.Commit(ctx)
+}
+
+// PurgeTrash purges the files that were in the trash for longer than the
+// retention period, with the files in them, and returns how many there were.
+// Blobs of purged files are released, other contents and thumbnails are
+// deleted. Purged files can't be restored.
+func (s *Service) PurgeTrash(ctx context.Context) (int, error) {
+	if s.TrashRetention == 0 {
+		return 0, nil
+	}
+
+	purged := 0
+	for {
+		n, err := s.purgeTrash(ctx)
+		purged += n
+		if err != nil || n == 0 {
+			return purged, err
+		}
+	}
+}
+
+func (s *Service) purgeTrash(ctx context.Context) (int, error) {
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	files, err := qtx.FilePurge(ctx, db.FilePurgeParams{
+		Before:   pgtype.Timestamptz{Time: time.Now().Add(-s.TrashRetention), Valid: true},
+		MaxCount: purgeBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		if file.BlobHash.Valid {
+			err = qtx.BlobRelease(ctx, file.BlobHash.String)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		if file.IsFolder {
+			continue
+		}
+		if !file.BlobHash.Valid {
+			s.removeObject(ctx, file.ID)
+		}
+		for _, size := range ThumbnailSizes {
+			s.removeObject(ctx, thumbnailName(file.ID, size.Name))
+		}
+	}
+
+	return len(files), nil
+}
+
+// Rename changes the name of the node, keeping it in its folder. Unlike
+// Move, it also renames shared drives.
+func (s *Service) Rename(ctx context.Context, user *db.User, node Node, name string) (db.File, error) {
+	if node.Kind != KindFile || node.Role < RoleManager {
+		return db.File{}, ErrForbidden
+	}
+	if !validName(name) {
+		return db.File{}, ErrInvalid
+	}
+	if name == node.File.Name {
+		return node.File, nil
+	}
+
+	err := s.checkName(ctx, user, node.File, name)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	file, err := qtx.FileUpdateName(ctx, db.FileUpdateNameParams{
+		ID:             node.File.ID,
+		OrganisationID: user.OrganisationID,
+		Name:           name,
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, ActivityRename, map[string]string{"from": node.File.Name, "to": file.Name})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	return file, tx.Commit(ctx)
+}
+
+// checkName verifies that no other file next to file is called name.
+func (s *Service) checkName(ctx context.Context, user *db.User, file db.File, name string) error {
+	params := db.FileFindChildParams{
+		ParentID:       file.ParentID,
+		Name:           name,
+		SharedDrive:    file.SharedDrive,
+		OrganisationID: user.OrganisationID,
+	}
+	if personal(file) {
+		params.OwnerID = file.OwnerID
+	}
+
+	other, err := s.DB.FileFindChild(ctx, params)
+	switch {
+	case err == nil && other.ID != file.ID:
+		return ErrExists
+	case err == nil, errors.Is(err, pgx.ErrNoRows):
+		return nil
+	default:
+		return err
+	}
+}
+
+// Move renames the node and/or moves it into parent.
+func (s *Service) Move(ctx context.Context, user *db.User, node Node, parent Node, name string) (db.File, error) {
+	if node.Kind != KindFile || node.File.SharedDrive {
+		return db.File{}, ErrForbidden
+	}
+	if node.Role < RoleManager {
+		return db.File{}, ErrForbidden
+	}
+	// Files of someone else would end up in their personal root
+	if parent.Kind == KindMyFiles && !owns(user, node.File) {
+		return db.File{}, ErrForbidden
+	}
+
+	err := s.checkCreate(ctx, user, parent, name)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	// A folder can't be moved into itself or one of its descendants
+	if parent.Kind == KindFile {
+		ancestors, err := s.DB.FileFindAncestorIDs(ctx, parent.File.ID)
+		if err != nil {
+			return db.File{}, err
+		}
+		for _, id := range ancestors {
+			if id == node.File.ID {
+				return db.File{}, ErrInvalid
+			}
+		}
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	file, err := qtx.FileMove(ctx, db.FileMoveParams{
+		ParentID:       parent.parentID(),
+		Name:           name,
+		ID:             node.File.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	action, details := ActivityRename, map[string]string{"from": node.File.Name, "to": file.Name}
+	if node.File.ParentID != file.ParentID {
+		from, err := s.folderName(ctx, qtx, user, node.File.ParentID)
+		if err != nil {
+			return db.File{}, err
+		}
+
+		// from_parent_id tells the changes feed who could see the file before
+		action, details = ActivityMove, map[string]string{"from": from, "to": parent.Name, "from_parent_id": node.File.ParentID.String}
+		if node.File.Name != file.Name {
+			details["from_name"] = node.File.Name
+			details["to_name"] = file.Name
+		}
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, action, details)
+	if err != nil {
+		return db.File{}, err
+	}
+
+	return file, tx.Commit(ctx)
+}
+
+// folderName returns the name of the folder with the given ID, or of the
+// personal root if there is none.
+func (s *Service) folderName(ctx context.Context, q *db.Queries, user *db.User, id pgtype.Text) (string, error) {
+	if !id.Valid {
+		return MyFilesName, nil
+	}
+
+	folder, err := q.FileFindByID(ctx, db.FileFindByIDParams{
+		ID:             id.String,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return folder.Name, nil
+}
+
+// Transfer makes another user of the organisation the owner of the node.
+// Only the owner and admins may transfer a file. Files at the top of the
+// personal root move to the personal root of the new owner, contents of
+// folders keep their owners.
+func (s *Service) Transfer(ctx context.Context, user *db.User, node Node, ownerID string) (db.File, error) {
+	if node.Kind != KindFile || node.File.SharedDrive {
+		return db.File{}, ErrInvalid
+	}
+	if !owns(user, node.File) && user.Role != db.UserRoleOwner && user.Role != db.UserRoleAdmin {
+		return db.File{}, ErrForbidden
+	}
+
+	owner, err := s.DB.UserFind(ctx, db.UserFindParams{
+		ID:             ownerID,
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.File{}, ErrInvalid
+	}
+	if err != nil {
+		return db.File{}, err
+	}
+
+	if personal(node.File) {
+		_, err = s.DB.FileFindChild(ctx, db.FileFindChildParams{
+			Name:           node.File.Name,
+			OrganisationID: user.OrganisationID,
+			OwnerID:        pgtype.Text{String: owner.ID, Valid: true},
+		})
+		switch {
+		case err == nil:
+			return db.File{}, ErrExists
+		case !errors.Is(err, pgx.ErrNoRows):
+			return db.File{}, err
+		}
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return db.File{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	file, err := qtx.FileTransfer(ctx, db.FileTransferParams{
+		OwnerID:        pgtype.Text{String: owner.ID, Valid: true},
+		ID:             node.File.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.File{}, ErrNotFound
+	}
+	if err != nil {
+		return db.File{}, err
+	}
+
+	err = s.recordActivity(ctx, qtx, user, file, ActivityTransfer, map[string]string{
+		"from":    node.File.OwnerID.String,
+		"to":      owner.ID,
+		"to_name": owner.FirstName + " " + owner.LastName,
+	})
+	if err != nil {
+		return db.File{}, err
+	}
+
+	return file, tx.Commit(ctx)
+}
+
+// writable reports whether the user may add entries to parent. New shared
+// drives can't be created through the file tree.
+func writable(parent Node) bool {
+	if parent.Kind != KindMyFiles && !(parent.Kind == KindFile && parent.IsDir()) {
+		return false
+	}
+	return parent.Role >= RoleManager
+}
+
+// checkCreate verifies that the user may create an entry called name in
+// parent.
+func (s *Service) checkCreate(ctx context.Context, user *db.User, parent Node, name string) error {
+	if !writable(parent) {
+		return ErrForbidden
+	}
+	if !validName(name) {
+		return ErrInvalid
+	}
+
+	_, err := s.Child(ctx, user, parent, name)
+	switch {
+	case err == nil:
+		return ErrExists
+	case errors.Is(err, ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// DetectMimeType guesses the mime type from the file extension.
+func DetectMimeType(name string) string {
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
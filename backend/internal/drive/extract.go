@@ -0,0 +1,358 @@
+package drive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"example/internal/database/db"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// maxExtractEntries limits the number of entries of an extracted archive.
+	maxExtractEntries = 10000
+	// maxCompressionRatio is the highest ratio of uncompressed to compressed
+	// size that is accepted. Real files rarely exceed 20:1, zip bombs reach
+	// millions.
+	maxCompressionRatio = 100
+	// ratioThreshold is the size up to which the ratio isn't checked, tiny
+	// text files can compress extremely well.
+	ratioThreshold = 1 << 20
+)
+
+var (
+	// errUnsafePath is reported for entries that would end up outside the
+	// target folder.
+	errUnsafePath = fmt.Errorf("%w: unsafe path", ErrInvalid)
+	// errUnsupportedEntry is reported for links and special files.
+	errUnsupportedEntry = fmt.Errorf("%w: unsupported entry type", ErrInvalid)
+	// errCompressionRatio is reported for entries that look like a zip bomb.
+	errCompressionRatio = fmt.Errorf("%w: compression ratio too high", ErrInvalid)
+)
+
+// ExtractEntry is the result of extracting a single entry of an archive.
+type ExtractEntry struct {
+	Path string
+	// File is the created file or folder if Err is nil.
+	File db.File
+	Err  error
+}
+
+// extractor creates the entries of an archive below parent.
+type extractor struct {
+	service  *Service
+	user     *db.User
+	parent   Node
+	progress func(ExtractEntry)
+	// folders caches the folders by their path in the archive.
+	folders map[string]Node
+	// total is the uncompressed size written so far.
+	total int64
+}
+
+func (s *Service) extractor(user *db.User, parent Node, progress func(ExtractEntry)) (*extractor, error) {
+	if !writable(parent) {
+		return nil, ErrForbidden
+	}
+
+	return &extractor{
+		service:  s,
+		user:     user,
+		parent:   parent,
+		progress: progress,
+		folders:  map[string]Node{"": parent},
+	}, nil
+}
+
+// ExtractZip recreates the folders and files of a ZIP archive in parent.
+// Limits and the quota are checked against the sizes in the central
+// directory before anything is created. progress is called for every entry;
+// entries that fail are reported and skipped.
+func (s *Service) ExtractZip(ctx context.Context, user *db.User, parent Node, r io.ReaderAt, size int64, progress func(ExtractEntry)) error {
+	e, err := s.extractor(user, parent, progress)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(zr.File) > maxExtractEntries {
+		return ErrTooLarge
+	}
+
+	var total int64
+	for _, f := range zr.File {
+		total += int64(f.UncompressedSize64)
+	}
+	if total < 0 || total > s.ArchiveLimit {
+		return ErrTooLarge
+	}
+
+	_, err = s.reserve(ctx, user.OrganisationID, total, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			e.mkdir(ctx, f.Name)
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			e.report(f.Name, db.File{}, errUnsupportedEntry)
+			continue
+		}
+
+		err = e.extractZipFile(ctx, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) extractZipFile(ctx context.Context, f *zip.File) error {
+	if f.UncompressedSize64 > ratioThreshold && f.UncompressedSize64 > f.CompressedSize64*maxCompressionRatio {
+		e.report(f.Name, db.File{}, errCompressionRatio)
+		return nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		e.report(f.Name, db.File{}, fmt.Errorf("%w: %v", ErrInvalid, err))
+		return nil
+	}
+	defer rc.Close()
+
+	// The reader checks that the contents match the sizes of the header
+	return e.create(ctx, f.Name, rc, int64(f.UncompressedSize64))
+}
+
+// ExtractTarGz recreates the folders and files of a gzip compressed tar
+// archive in parent. As the archive is read as stream, the limits are
+// enforced while extracting; entries created up to then are kept.
+func (s *Service) ExtractTarGz(ctx context.Context, user *db.User, parent Node, r io.Reader, progress func(ExtractEntry)) error {
+	e, err := s.extractor(user, parent, progress)
+	if err != nil {
+		return err
+	}
+
+	compressed := &countingReader{r: r}
+	gr, err := gzip.NewReader(compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer gr.Close()
+
+	// Limits the whole stream, a single entry can't be checked on its own
+	inflated := &inflateLimit{r: gr, compressed: compressed, limit: s.ArchiveLimit}
+	tr := tar.NewReader(inflated)
+
+	for entries := 0; ; entries++ {
+		header, err := tr.Next()
+		if inflated.exceeded {
+			return ErrTooLarge
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if entries >= maxExtractEntries {
+			return ErrTooLarge
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			e.mkdir(ctx, header.Name)
+		case tar.TypeReg:
+			err = e.create(ctx, header.Name, tr, header.Size)
+			if inflated.exceeded {
+				return ErrTooLarge
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			e.report(header.Name, db.File{}, errUnsupportedEntry)
+		}
+	}
+}
+
+// clean returns the path of an entry relative to the target folder. Absolute
+// paths and paths containing ".." are rejected instead of being cleaned, so
+// crafted archives can't write outside the target folder (zip slip).
+func clean(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", errUnsafePath
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			return "", errUnsafePath
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", errUnsafePath
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// ignored reports whether the entry is metadata added by the archiver of the
+// operating system, rather than content.
+func ignored(p string) bool {
+	return p == "__MACOSX" || strings.HasPrefix(p, "__MACOSX/") || path.Base(p) == ".DS_Store"
+}
+
+func (e *extractor) report(name string, file db.File, err error) {
+	e.progress(ExtractEntry{Path: name, File: file, Err: err})
+}
+
+// mkdir creates the folder of a directory entry.
+func (e *extractor) mkdir(ctx context.Context, name string) {
+	p, err := clean(name)
+	if err == nil && ignored(p) {
+		return
+	}
+	if err != nil {
+		e.report(name, db.File{}, err)
+		return
+	}
+
+	node, err := e.folder(ctx, p)
+	e.report(p, node.File, err)
+}
+
+// folder returns the folder for a path in the archive, creating it and its
+// parents if needed. Existing folders are reused.
+func (e *extractor) folder(ctx context.Context, p string) (Node, error) {
+	if node, ok := e.folders[p]; ok {
+		return node, nil
+	}
+
+	dir, name := path.Split(p)
+	parent, err := e.folder(ctx, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return Node{}, err
+	}
+
+	node, err := e.service.Child(ctx, e.user, parent, name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		node, err = e.service.mkdirNode(ctx, e.user, parent, name)
+		if err != nil {
+			return Node{}, err
+		}
+	case err != nil:
+		return Node{}, err
+	case !node.IsDir():
+		return Node{}, ErrExists
+	case node.Role < RoleManager:
+		return Node{}, ErrForbidden
+	}
+
+	e.folders[p] = node
+	return node, nil
+}
+
+// create stores a file entry. Errors of the entry are reported, only errors
+// that affect the whole archive are returned.
+func (e *extractor) create(ctx context.Context, name string, r io.Reader, size int64) error {
+	p, err := clean(name)
+	if err == nil && ignored(p) {
+		return nil
+	}
+	if err != nil {
+		e.report(name, db.File{}, err)
+		return nil
+	}
+
+	e.total += size
+	if e.total > e.service.ArchiveLimit {
+		return ErrTooLarge
+	}
+
+	dir, base := path.Split(p)
+	parent, err := e.folder(ctx, strings.TrimSuffix(dir, "/"))
+	if err == nil {
+		err = e.service.checkCreate(ctx, e.user, parent, base)
+	}
+	if err != nil {
+		e.report(p, db.File{}, err)
+		return nil
+	}
+
+	mimeType := DetectMimeType(base)
+	file, err := e.service.create(ctx, e.user, parent, base, mimeType, size, func(key string, replaced int64) (object, error) {
+		return e.service.put(ctx, e.user, key, mimeType, r, size, replaced)
+	})
+	switch {
+	case errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrTooLarge), ctx.Err() != nil:
+		return err
+	case err != nil:
+		e.report(p, db.File{}, err)
+		return nil
+	}
+
+	e.report(p, file, nil)
+	return nil
+}
+
+// mkdirNode creates a folder and returns its node. The folder inherits the
+// access of parent, as it has no permissions of its own yet.
+func (s *Service) mkdirNode(ctx context.Context, user *db.User, parent Node, name string) (Node, error) {
+	file, err := s.Mkdir(ctx, user, parent, name)
+	if err != nil {
+		return Node{}, err
+	}
+
+	a := parent.access.child(user, file, 0, 0)
+	return Node{Kind: KindFile, Name: file.Name, File: file, Role: a.role(user), access: a}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// inflateLimit cuts off decompressed data once it exceeds limit or the ratio
+// to the compressed data read so far gets suspicious.
+type inflateLimit struct {
+	r          io.Reader
+	compressed *countingReader
+	n          int64
+	limit      int64
+	exceeded   bool
+}
+
+func (l *inflateLimit) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+
+	if l.n > l.limit || (l.n > ratioThreshold && l.n > l.compressed.n*maxCompressionRatio) {
+		l.exceeded = true
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,171 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// partPrefix is where the parts of multipart uploads are kept until they are
+// combined. File objects are named by their ID, which never contains a slash.
+const partPrefix = "multipart/"
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+func partName(uploadID string, number int) string {
+	return fmt.Sprintf("%s%s/%05d", partPrefix, uploadID, number)
+}
+
+// PutPart stores a part of a multipart upload, or replaces the part with the
+// same number. Parts count against the quota from their upload until the
+// upload is completed or aborted.
+func (s *Service) PutPart(ctx context.Context, user *db.User, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	replaced, err := s.DB.MultipartPartFindSize(ctx, db.MultipartPartFindSizeParams{
+		UploadID: uploadID,
+		Number:   int32(number),
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return Part{}, err
+	}
+
+	qr, err := s.limit(ctx, user.OrganisationID, r, size, replaced)
+	if err != nil {
+		return Part{}, err
+	}
+
+	info, err := s.Storage.Put(ctx, partName(uploadID, number), qr, size, storage.PutOptions{OrganisationID: user.OrganisationID})
+	if qr.exceeded {
+		return Part{}, ErrQuotaExceeded
+	}
+	if err != nil {
+		return Part{}, err
+	}
+
+	err = s.DB.MultipartPartSave(ctx, db.MultipartPartSaveParams{
+		UploadID:       uploadID,
+		Number:         int32(number),
+		OrganisationID: user.OrganisationID,
+		Size:           info.Size,
+	})
+	if err != nil {
+		return Part{}, err
+	}
+
+	return Part{Number: number, ETag: info.ETag, Size: info.Size}, nil
+}
+
+// Parts returns the parts uploaded so far, ordered by their number.
+func (s *Service) Parts(ctx context.Context, uploadID string) ([]Part, error) {
+	var parts []Part
+
+	prefix := partPrefix + uploadID + "/"
+	err := s.Storage.List(ctx, prefix, func(info storage.ObjectInfo) error {
+		number, err := strconv.Atoi(strings.TrimPrefix(info.Key, prefix))
+		if err != nil {
+			return nil
+		}
+
+		parts = append(parts, Part{Number: number, ETag: info.ETag, Size: info.Size})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	return parts, nil
+}
+
+// ComposeParts creates the file name in parent, or replaces its contents, by
+// concatenating the given parts.
+func (s *Service) ComposeParts(ctx context.Context, user *db.User, parent Node, name string, uploadID string, parts []Part) (db.File, error) {
+	if len(parts) == 0 {
+		return db.File{}, ErrInvalid
+	}
+
+	var size int64
+	srcs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		size += part.Size
+		srcs = append(srcs, partName(uploadID, part.Number))
+	}
+
+	return s.store(ctx, user, parent, name, size, func(key string, mimeType string, replaced int64) (object, error) {
+		// The parts of this upload are already counted, the file takes their
+		// place once the upload is deleted
+		pending, err := s.DB.MultipartUploadSumSize(ctx, uploadID)
+		if err != nil {
+			return object{}, err
+		}
+
+		_, err = s.reserve(ctx, user.OrganisationID, size, replaced+pending)
+		if err != nil {
+			return object{}, err
+		}
+
+		info, err := s.Storage.Compose(ctx, key, srcs, storage.PutOptions{ContentType: mimeType, OrganisationID: user.OrganisationID})
+		if err != nil {
+			return object{}, err
+		}
+
+		// The checksums are computed from the composed object. Its size
+		// differs from the listed parts if they are encrypted
+		return object{key: key, size: info.Size}, nil
+	})
+}
+
+// AbortParts deletes all parts of a multipart upload.
+func (s *Service) AbortParts(ctx context.Context, uploadID string) error {
+	return s.Storage.List(ctx, partPrefix+uploadID+"/", func(info storage.ObjectInfo) error {
+		return s.Storage.Delete(ctx, info.Key)
+	})
+}
+
+// AbortStaleUploads aborts the multipart uploads started longer than the
+// retention period ago, which clients gave up on without aborting them, and
+// returns how many there were.
+func (s *Service) AbortStaleUploads(ctx context.Context) (int, error) {
+	if s.UploadRetention == 0 {
+		return 0, nil
+	}
+
+	aborted := 0
+	for {
+		uploads, err := s.DB.MultipartUploadFindStale(ctx, db.MultipartUploadFindStaleParams{
+			Before:   time.Now().Add(-s.UploadRetention),
+			MaxCount: abortBatchSize,
+		})
+		if err != nil || len(uploads) == 0 {
+			return aborted, err
+		}
+
+		for _, upload := range uploads {
+			err = s.AbortParts(ctx, upload.ID)
+			if err != nil {
+				return aborted, err
+			}
+
+			err = s.DB.MultipartUploadDelete(ctx, upload.ID)
+			if err != nil {
+				return aborted, err
+			}
+			aborted++
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package drive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"example/internal/database"
+	"example/internal/database/db"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+	// maxPageScan limits the rows checked per page, so that a folder with
+	// thousands of files the user can't see still returns quickly. The page
+	// is shorter then, but has a cursor.
+	maxPageScan = 5000
+)
+
+// SortKey is what listings are sorted by. Folders always come first.
+type SortKey string
+
+const (
+	SortName     SortKey = "name"
+	SortSize     SortKey = "size"
+	SortCreated  SortKey = "created"
+	SortModified SortKey = "modified"
+)
+
+var sortColumns = map[SortKey]string{
+	SortName:     "name",
+	SortSize:     "file_size",
+	SortCreated:  "created_at",
+	SortModified: "updated_at",
+}
+
+// ListOptions are the order, filters and position of a page of a listing.
+type ListOptions struct {
+	// Sort defaults to SortName.
+	Sort SortKey
+	Desc bool
+	// Types are "folder", "file" or MIME types as for SearchOptions.MimeTypes.
+	Types []string
+	Limit int
+	// Cursor is Page.NextCursor of the previous page.
+	Cursor string
+}
+
+type Page struct {
+	Nodes []Node
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// cursor is the position after the last row of a page. It is sent to
+// clients base64 encoded, they treat it as opaque.
+type cursor struct {
+	Sort   SortKey `json:"s"`
+	Desc   bool    `json:"d,omitempty"`
+	Folder bool    `json:"f,omitempty"`
+	Value  string  `json:"v"`
+	ID     string  `json:"i"`
+}
+
+// fileCursor returns the cursor pointing after file.
+func fileCursor(opts ListOptions, file db.File) cursor {
+	c := cursor{Sort: opts.Sort, Desc: opts.Desc, Folder: file.IsFolder, ID: file.ID}
+	switch opts.Sort {
+	case SortName:
+		c.Value = file.Name
+	case SortSize:
+		c.Value = strconv.FormatInt(file.FileSize, 10)
+	case SortCreated:
+		c.Value = file.CreatedAt.Format(time.RFC3339Nano)
+	case SortModified:
+		c.Value = file.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+func (c cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after returns the condition for rows after the cursor.
+func (c cursor) after() (squirrel.Sqlizer, error) {
+	var value any
+	var err error
+	switch c.Sort {
+	case SortName:
+		value = c.Value
+	case SortSize:
+		value, err = strconv.ParseInt(c.Value, 10, 64)
+	case SortCreated, SortModified:
+		value, err = time.Parse(time.RFC3339Nano, c.Value)
+	}
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+
+	// Folders come first, files follow all folders
+	return squirrel.Or{
+		squirrel.Lt{"is_folder": c.Folder},
+		squirrel.And{
+			squirrel.Eq{"is_folder": c.Folder},
+			squirrel.Expr("("+sortColumns[c.Sort]+", id) "+op+" (?, ?)", value, c.ID),
+		},
+	}, nil
+}
+
+func parseCursor(s string, opts ListOptions) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalid
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return cursor{}, ErrInvalid
+	}
+
+	// A cursor is only valid for the order it was created with
+	if c.Sort != opts.Sort || c.Desc != opts.Desc {
+		return cursor{}, ErrInvalid
+	}
+	return c, nil
+}
+
+// ListPage returns a page of the children of the node the user may see.
+// Children hidden from the user are skipped, so a page can be shorter than
+// the limit even if another one follows.
+func (s *Service) ListPage(ctx context.Context, user *db.User, node Node, opts ListOptions) (Page, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortName
+	}
+	column, ok := sortColumns[opts.Sort]
+	if !ok {
+		return Page{}, ErrInvalid
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := s.DB.NewQueryBuilder().
+		Select("*").
+		From("files").
+		Where(squirrel.Eq{"organisation_id": user.OrganisationID, "deleted_at": nil})
+
+	switch node.Kind {
+	case KindRoot:
+		return Page{Nodes: []Node{s.MyFiles(user), s.SharedDrives(user)}}, nil
+	case KindMyFiles:
+		query = query.Where(squirrel.Eq{"parent_id": nil, "shared_drive": false, "owner_id": user.ID})
+	case KindSharedDrives:
+		query = query.Where(squirrel.Eq{"shared_drive": true})
+	default:
+		if !node.IsDir() {
+			return Page{}, ErrInvalid
+		}
+		query = query.Where(squirrel.Eq{"parent_id": node.File.ID})
+	}
+
+	if len(opts.Types) > 0 {
+		types := squirrel.Or{}
+		for _, t := range opts.Types {
+			switch t {
+			case "folder":
+				types = append(types, squirrel.Eq{"is_folder": true})
+			case "file":
+				types = append(types, squirrel.Eq{"is_folder": false})
+			default:
+				types = append(types, mimeTypeFilter("mime_type", []string{t}))
+			}
+		}
+		query = query.Where(types)
+	}
+
+	direction := " ASC"
+	if opts.Desc {
+		direction = " DESC"
+	}
+	query = query.OrderBy("is_folder DESC", column+direction, "id"+direction)
+
+	var after squirrel.Sqlizer
+	if opts.Cursor != "" {
+		c, err := parseCursor(opts.Cursor, opts)
+		if err != nil {
+			return Page{}, err
+		}
+		after, err = c.after()
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	page := Page{Nodes: make([]Node, 0, limit)}
+	var last db.File
+	for scanned := 0; scanned < maxPageScan; {
+		q := query
+		if after != nil {
+			q = q.Where(after)
+		}
+
+		// One more row than fits tells if there is another page
+		files, err := database.ScanSelectMany[db.File](s.DB, ctx, q.Limit(uint64(limit+1)))
+		if err != nil {
+			return Page{}, err
+		}
+
+		nodes, err := s.filter(ctx, user, node, files)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, n := range nodes {
+			if len(page.Nodes) == limit {
+				page.NextCursor = fileCursor(opts, page.Nodes[limit-1].File).String()
+				return page, nil
+			}
+			page.Nodes = append(page.Nodes, n)
+		}
+
+		if len(files) <= limit {
+			return page, nil
+		}
+
+		last = files[len(files)-1]
+		scanned += len(files)
+		if len(page.Nodes) == limit {
+			break
+		}
+
+		after, err = fileCursor(opts, last).after()
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	page.NextCursor = fileCursor(opts, last).String()
+	return page, nil
+}
@@ -0,0 +1,127 @@
+package drive
+
+import (
+	"context"
+	"example/internal/database/db"
+)
+
+// Role is the effective permission of a user on a file.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleManager
+)
+
+// access is the aggregated file_permissions of a file and its ancestors.
+type access struct {
+	// restricted is true if any permission is set on the chain or if it
+	// starts in a personal root. Other files are accessible to the whole
+	// organisation.
+	restricted bool
+	// level is the highest role granted to the user on the chain.
+	level Role
+	// owned is true if the user owns a file on the chain.
+	owned bool
+}
+
+func (a access) role(user *db.User) Role {
+	switch {
+	case user.Role == db.UserRoleOwner, user.Role == db.UserRoleAdmin:
+		return RoleManager
+	case a.owned, !a.restricted:
+		return RoleManager
+	default:
+		return a.level
+	}
+}
+
+// child combines the access of a parent with the permissions set directly on
+// its child file.
+func (a access) child(user *db.User, file db.File, grants int64, level int32) access {
+	return access{
+		restricted: a.restricted || grants > 0 || personal(file),
+		level:      max(a.level, Role(level)),
+		owned:      a.owned || owns(user, file),
+	}
+}
+
+// personal reports whether the file is at the top of a personal root.
+func personal(file db.File) bool {
+	return !file.ParentID.Valid && !file.SharedDrive
+}
+
+func owns(user *db.User, file db.File) bool {
+	return file.OwnerID.Valid && file.OwnerID.String == user.ID
+}
+
+func (s *Service) access(ctx context.Context, user *db.User, fileID string) (access, error) {
+	row, err := s.DB.FilePermissionFindEffective(ctx, db.FilePermissionFindEffectiveParams{
+		FileID: fileID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return access{}, err
+	}
+
+	return access{restricted: row.Grants > 0 || row.Personal, level: Role(row.Level), owned: row.Owned}, nil
+}
+
+// accessByID returns the access of several files at once, and whether they
+// are in the trash, directly or through an ancestor.
+func (s *Service) accessByID(ctx context.Context, user *db.User, ids []string) (map[string]access, map[string]bool, error) {
+	rows, err := s.DB.FilePermissionFindEffectiveByIDs(ctx, db.FilePermissionFindEffectiveByIDsParams{
+		FileIds: ids,
+		UserID:  user.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accesses := make(map[string]access, len(rows))
+	trashed := make(map[string]bool)
+	for _, row := range rows {
+		accesses[row.FileID] = access{restricted: row.Grants > 0 || row.Personal, level: Role(row.Level), owned: row.Owned}
+		if row.Trashed {
+			trashed[row.FileID] = true
+		}
+	}
+	return accesses, trashed, nil
+}
+
+// filter returns the nodes for files (children of parent) the user may see.
+func (s *Service) filter(ctx context.Context, user *db.User, parent Node, files []db.File) ([]Node, error) {
+	nodes := make([]Node, 0, len(files))
+	if len(files) == 0 {
+		return nodes, nil
+	}
+
+	rows, err := s.DB.FilePermissionFindByParentID(ctx, db.FilePermissionFindByParentIDParams{
+		UserID:         user.ID,
+		ParentID:       parent.parentID(),
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make(map[string]db.FilePermissionFindByParentIDRow, len(rows))
+	for _, row := range rows {
+		grants[row.FileID] = row
+	}
+
+	for _, file := range files {
+		row := grants[file.ID]
+		a := parent.access.child(user, file, row.Grants, row.Level)
+
+		role := a.role(user)
+		if role == RoleNone {
+			continue
+		}
+
+		nodes = append(nodes, Node{Kind: KindFile, Name: file.Name, File: file, Role: role, access: a})
+	}
+
+	return nodes, nil
+}
@@ -0,0 +1,64 @@
+package drive
+
+import (
+	"context"
+	"io"
+)
+
+// available returns how many bytes the organisation may still store. The
+// parts of multipart uploads in progress count as stored.
+func (s *Service) available(ctx context.Context, organisationID string) (int64, error) {
+	used, err := s.DB.FileSumSize(ctx, organisationID)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := s.DB.MultipartPartSumSize(ctx, organisationID)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(s.Quota-used-pending, 0), nil
+}
+
+// reserve checks that size bytes, replacing replaced bytes of existing
+// contents, fit into the quota of the organisation.
+func (s *Service) reserve(ctx context.Context, organisationID string, size int64, replaced int64) (int64, error) {
+	available, err := s.available(ctx, organisationID)
+	if err != nil {
+		return 0, err
+	}
+
+	available += replaced
+	if size > available {
+		return 0, ErrQuotaExceeded
+	}
+	return available, nil
+}
+
+// limit wraps r so that uploads of unknown size (-1) are cut off once they
+// exceed the quota of the organisation.
+func (s *Service) limit(ctx context.Context, organisationID string, r io.Reader, size int64, replaced int64) (*quotaReader, error) {
+	available, err := s.reserve(ctx, organisationID, size, replaced)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quotaReader{r: r, n: available}, nil
+}
+
+type quotaReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n -= int64(n)
+	if q.n < 0 {
+		q.exceeded = true
+		return n, ErrQuotaExceeded
+	}
+	return n, err
+}
@@ -0,0 +1,220 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"strings"
+	"time"
+)
+
+// reconcileBatchSize is the number of objects or rows checked per query.
+const reconcileBatchSize = 1000
+
+// ReconcileOptions configures Reconcile.
+type ReconcileOptions struct {
+	// Fix deletes orphaned objects and trashes files whose contents are
+	// missing. Otherwise the drift is only reported.
+	Fix bool
+	// MinAge skips objects and files changed more recently, as uploads in
+	// progress write the object before the row is committed.
+	MinAge time.Duration
+}
+
+// OrphanedObject is an object in the storage without a live or trashed file
+// (or blob) referencing it.
+type OrphanedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Fixed        bool      `json:"fixed"`
+}
+
+// MissingObject is a file whose contents aren't in the storage.
+type MissingObject struct {
+	FileID         string `json:"file_id"`
+	OrganisationID string `json:"organisation_id"`
+	Name           string `json:"name"`
+	Key            string `json:"key"`
+	Trashed        bool   `json:"trashed"`
+	Fixed          bool   `json:"fixed"`
+}
+
+// ReconcileReport lists the differences between the files table and the
+// storage.
+type ReconcileReport struct {
+	DryRun          bool             `json:"dry_run"`
+	ObjectsChecked  int              `json:"objects_checked"`
+	FilesChecked    int              `json:"files_checked"`
+	OrphanedObjects []OrphanedObject `json:"orphaned_objects"`
+	MissingObjects  []MissingObject  `json:"missing_objects"`
+}
+
+// Reconcile compares the objects in the storage with the files table. Parts of
+// multipart uploads and uploads of content addressed storage are skipped,
+// they are cleaned up by AbortParts and CollectGarbage. Thumbnails are
+// orphaned once their file is gone.
+func (s *Service) Reconcile(ctx context.Context, opts ReconcileOptions) (ReconcileReport, error) {
+	report := ReconcileReport{
+		DryRun:          !opts.Fix,
+		OrphanedObjects: make([]OrphanedObject, 0),
+		MissingObjects:  make([]MissingObject, 0),
+	}
+
+	err := s.reconcileObjects(ctx, opts, &report)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.reconcileFiles(ctx, opts, &report)
+	return report, err
+}
+
+// reconcileObjects pages through the storage and looks up the rows of the
+// objects in batches.
+func (s *Service) reconcileObjects(ctx context.Context, opts ReconcileOptions, report *ReconcileReport) error {
+	cutoff := time.Now().Add(-opts.MinAge)
+	batch := make([]storage.ObjectInfo, 0, reconcileBatchSize)
+
+	err := s.Storage.List(ctx, "", func(info storage.ObjectInfo) error {
+		if strings.HasPrefix(info.Key, partPrefix) || strings.HasPrefix(info.Key, uploadPrefix) {
+			return nil
+		}
+
+		report.ObjectsChecked++
+		if info.LastModified.After(cutoff) {
+			return nil
+		}
+
+		batch = append(batch, info)
+		if len(batch) < reconcileBatchSize {
+			return nil
+		}
+
+		err := s.reconcileBatch(ctx, opts, report, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.reconcileBatch(ctx, opts, report, batch)
+}
+
+func (s *Service) reconcileBatch(ctx context.Context, opts ReconcileOptions, report *ReconcileReport, batch []storage.ObjectInfo) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var ids, hashes []string
+	for _, info := range batch {
+		if hash, ok := strings.CutPrefix(info.Key, blobPrefix); ok {
+			hashes = append(hashes, hash)
+		} else {
+			ids = append(ids, objectFileID(info.Key))
+		}
+	}
+
+	existingFiles := make(map[string]bool, len(ids))
+	existingBlobs := make(map[string]bool, len(hashes))
+
+	files, err := s.DB.FileFindExistingIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range files {
+		existingFiles[id] = true
+	}
+
+	blobs, err := s.DB.BlobFindExistingHashes(ctx, hashes)
+	if err != nil {
+		return err
+	}
+	for _, hash := range blobs {
+		existingBlobs[hash] = true
+	}
+
+	for _, info := range batch {
+		hash, isBlob := strings.CutPrefix(info.Key, blobPrefix)
+		if isBlob && existingBlobs[hash] || !isBlob && existingFiles[objectFileID(info.Key)] {
+			continue
+		}
+
+		orphan := OrphanedObject{Key: info.Key, Size: info.Size, LastModified: info.LastModified}
+		if opts.Fix {
+			err = s.Storage.Delete(ctx, info.Key)
+			if err != nil {
+				return err
+			}
+			orphan.Fixed = true
+		}
+
+		report.OrphanedObjects = append(report.OrphanedObjects, orphan)
+	}
+	return nil
+}
+
+// reconcileFiles pages through the files, including trashed ones, and checks
+// that their objects exist. Blobs are only checked once.
+func (s *Service) reconcileFiles(ctx context.Context, opts ReconcileOptions, report *ReconcileReport) error {
+	cutoff := time.Now().Add(-opts.MinAge)
+	found := make(map[string]bool)
+	after := ""
+
+	for {
+		files, err := s.DB.FileFindContentAfter(ctx, db.FileFindContentAfterParams{
+			After:    after,
+			MaxCount: reconcileBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			report.FilesChecked++
+			if file.CreatedAt.After(cutoff) {
+				continue
+			}
+
+			key := ObjectName(file)
+			exists, ok := found[key]
+			if !ok {
+				_, err = s.Storage.Stat(ctx, key)
+				if err != nil && !errors.Is(err, storage.ErrNotExist) {
+					return err
+				}
+				exists = err == nil
+				if file.BlobHash.Valid {
+					found[key] = exists
+				}
+			}
+			if exists {
+				continue
+			}
+
+			missing := MissingObject{
+				FileID:         file.ID,
+				OrganisationID: file.OrganisationID,
+				Name:           file.Name,
+				Key:            key,
+				Trashed:        file.DeletedAt.Valid,
+			}
+			if opts.Fix && !missing.Trashed {
+				err = s.DB.FileSoftDelete(ctx, file.ID)
+				if err != nil {
+					return err
+				}
+				missing.Fixed = true
+			}
+
+			report.MissingObjects = append(report.MissingObjects, missing)
+		}
+
+		if len(files) < reconcileBatchSize {
+			return nil
+		}
+		after = files[len(files)-1].ID
+	}
+}
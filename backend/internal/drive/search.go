@@ -0,0 +1,191 @@
+package drive
+
+import (
+	"context"
+	"example/internal/database"
+	"example/internal/database/db"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	// searchBatchSize is the number of matches fetched at once, before the
+	// ones the user may not see are dropped.
+	searchBatchSize = 100
+	// maxSearchScan limits the matches checked per call, so that a search
+	// matching thousands of files the user can't see still returns quickly.
+	maxSearchScan = 1000
+
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 200
+)
+
+// searchTSQuery parses a query in the syntax of search engines ("quoted
+// phrases", -excluded words, or) with the configurations the texts are
+// indexed with. It takes the query three times.
+const searchTSQuery = "(websearch_to_tsquery('simple', ?) || websearch_to_tsquery('english', ?) || websearch_to_tsquery('german', ?))"
+
+// SearchOptions are the query and filters of Search.
+type SearchOptions struct {
+	Query string
+	// MimeTypes match exactly, ignoring parameters, or by their prefix if
+	// they end in "/*", e.g. "image/*".
+	MimeTypes     []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Folder limits the results to its descendants.
+	Folder *Node
+	// OwnerID limits the results to the files owned by a user.
+	OwnerID string
+	Limit   int
+	// Offset is the number of matches skipped, i.e. SearchResult.NextOffset
+	// of the previous page.
+	Offset int
+}
+
+type SearchResult struct {
+	Nodes []Node
+	// NextOffset is the Offset of the next page, or 0 if this was the last
+	// one.
+	NextOffset int
+}
+
+type searchRow struct {
+	db.File
+	Rank float32 `db:"rank"`
+}
+
+// Search returns the files the user may see whose name or extracted text
+// match the query, the best matches first. Files in the trash or in a
+// folder in the trash aren't found.
+func (s *Service) Search(ctx context.Context, user *db.User, opts SearchOptions) (SearchResult, error) {
+	q := strings.TrimSpace(opts.Query)
+	if q == "" {
+		return SearchResult{}, ErrInvalid
+	}
+	if opts.Folder != nil && (opts.Folder.Kind != KindFile || !opts.Folder.IsDir()) {
+		return SearchResult{}, ErrInvalid
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	query := s.DB.NewQueryBuilder().
+		Select("f.*").
+		Column(squirrel.Expr("ts_rank(file_name_tsvector(f.name) || COALESCE(t.search_vector, ''::tsvector), "+searchTSQuery+") AS rank", q, q, q)).
+		From("files f").
+		LeftJoin("file_texts t ON t.file_id = f.id").
+		Where(squirrel.Eq{"f.organisation_id": user.OrganisationID, "f.deleted_at": nil}).
+		// Both indexes are only used if the matches are found separately
+		Where("f.id IN (SELECT id FROM files WHERE organisation_id = ? AND deleted_at IS NULL AND file_name_tsvector(name) @@ "+searchTSQuery+
+			" UNION SELECT file_id FROM file_texts WHERE search_vector @@ "+searchTSQuery+")",
+			user.OrganisationID, q, q, q, q, q, q).
+		OrderBy("rank DESC", "f.id")
+
+	if len(opts.MimeTypes) > 0 {
+		query = query.Where(mimeTypeFilter("f.mime_type", opts.MimeTypes))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		query = query.Where(squirrel.GtOrEq{"f.created_at": opts.CreatedAfter})
+	}
+	if !opts.CreatedBefore.IsZero() {
+		query = query.Where(squirrel.Lt{"f.created_at": opts.CreatedBefore})
+	}
+	if opts.OwnerID != "" {
+		query = query.Where(squirrel.Eq{"f.owner_id": opts.OwnerID})
+	}
+	if opts.Folder != nil {
+		query = query.Where("f.id IN (WITH RECURSIVE descendants AS (SELECT id FROM files WHERE parent_id = ?"+
+			" UNION ALL SELECT c.id FROM files c INNER JOIN descendants d ON c.parent_id = d.id)"+
+			" SELECT id FROM descendants)", opts.Folder.File.ID)
+	}
+
+	result := SearchResult{Nodes: make([]Node, 0, limit)}
+	offset := opts.Offset
+	for offset < opts.Offset+maxSearchScan {
+		rows, err := database.ScanSelectMany[searchRow](s.DB, ctx, query.Offset(uint64(offset)).Limit(searchBatchSize))
+		if err != nil {
+			return SearchResult{}, err
+		}
+
+		nodes, consumed, err := s.searchFilter(ctx, user, rows, limit-len(result.Nodes))
+		if err != nil {
+			return SearchResult{}, err
+		}
+		result.Nodes = append(result.Nodes, nodes...)
+		offset += consumed
+
+		if len(result.Nodes) == limit {
+			break
+		}
+		if len(rows) < searchBatchSize {
+			return result, nil
+		}
+	}
+
+	result.NextOffset = offset
+	return result, nil
+}
+
+// searchFilter returns the nodes of up to limit matches the user may see and
+// the number of matches it looked at.
+func (s *Service) searchFilter(ctx context.Context, user *db.User, rows []searchRow, limit int) ([]Node, int, error) {
+	if len(rows) == 0 {
+		return nil, 0, nil
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	accesses, trashed, err := s.accessByID(ctx, user, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodes := make([]Node, 0, min(limit, len(rows)))
+	for i, row := range rows {
+		if len(nodes) == limit {
+			return nodes, i, nil
+		}
+
+		if trashed[row.ID] {
+			continue
+		}
+
+		a := accesses[row.ID]
+		role := a.role(user)
+		if role == RoleNone {
+			continue
+		}
+
+		nodes = append(nodes, Node{Kind: KindFile, Name: row.Name, File: row.File, Role: role, access: a})
+	}
+
+	return nodes, len(rows), nil
+}
+
+// mimeTypeFilter matches the MIME types exactly, ignoring parameters, or by
+// their prefix if they end in "/*".
+func mimeTypeFilter(column string, mimeTypes []string) squirrel.Or {
+	filter := squirrel.Or{}
+	for _, mimeType := range mimeTypes {
+		if prefix, ok := strings.CutSuffix(mimeType, "/*"); ok {
+			filter = append(filter, squirrel.Like{column: escapeLike(prefix) + "/%"})
+		} else {
+			filter = append(filter, squirrel.Eq{column: mimeType}, squirrel.Like{column: escapeLike(mimeType) + ";%"})
+		}
+	}
+	return filter
+}
+
+// escapeLike escapes the wildcards of LIKE.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
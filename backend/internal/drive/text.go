@@ -0,0 +1,380 @@
+package drive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// extractBatchSize is the number of files handled per query.
+	extractBatchSize = 50
+	// maxExtractSource is the size up to which the text of files is
+	// extracted.
+	maxExtractSource = 100 << 20
+	// maxTextSize is the amount of text indexed per file. The tsvector of
+	// much longer documents can exceed the limit of 1 MB of Postgres.
+	maxTextSize = 256 << 10
+	// maxDocumentXMLSize limits the decompressed XML of DOCX and ODT files.
+	maxDocumentXMLSize = 64 << 20
+	// pdfExtractTimeout is the time pdftotext may take per file.
+	pdfExtractTimeout = time.Minute
+)
+
+// errTextLimit stops the extraction once maxTextSize is reached.
+var errTextLimit = errors.New("text limit reached")
+
+type textFormat int
+
+const (
+	formatNone textFormat = iota
+	formatPlain
+	formatPDF
+	formatDOCX
+	formatODT
+)
+
+// pdftotext is the path of the text extractor of poppler-utils. Without it
+// the contents of PDFs aren't indexed.
+var pdftotext = sync.OnceValue(func() string {
+	path, _ := exec.LookPath("pdftotext")
+	return path
+})
+
+// textFormatOf returns how the text of a file is extracted. The extension is
+// checked too, as Markdown and office documents are often uploaded as
+// application/octet-stream.
+func textFormatOf(file db.File) textFormat {
+	mediaType, _, _ := mime.ParseMediaType(file.MimeType)
+	switch mediaType {
+	case "text/plain", "text/markdown":
+		return formatPlain
+	case "application/pdf":
+		return formatPDF
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return formatDOCX
+	case "application/vnd.oasis.opendocument.text":
+		return formatODT
+	}
+
+	switch strings.ToLower(path.Ext(file.Name)) {
+	case ".txt", ".md", ".markdown":
+		return formatPlain
+	case ".pdf":
+		return formatPDF
+	case ".docx":
+		return formatDOCX
+	case ".odt":
+		return formatODT
+	default:
+		return formatNone
+	}
+}
+
+// ExtractTexts indexes the text of all files whose contents changed since.
+// It returns the number of files that got text.
+func (s *Service) ExtractTexts(ctx context.Context) (int, error) {
+	extracted := 0
+	for {
+		files, err := s.DB.FileFindUnextracted(ctx, extractBatchSize)
+		if err != nil {
+			return extracted, err
+		}
+
+		for _, file := range files {
+			text, err := s.text(ctx, file)
+			if err != nil {
+				return extracted, err
+			}
+
+			ok, err := s.storeText(ctx, file, text)
+			if err != nil {
+				return extracted, err
+			}
+			if ok && text != "" {
+				extracted++
+			}
+		}
+
+		if len(files) < extractBatchSize {
+			return extracted, nil
+		}
+	}
+}
+
+// storeText replaces the indexed text of a file. Nothing is stored if the
+// contents changed in the meantime, the file is picked up again then.
+func (s *Service) storeText(ctx context.Context, file db.File, text string) (bool, error) {
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	updated, err := qtx.FileUpdateExtracted(ctx, db.FileUpdateExtractedParams{
+		ID:     file.ID,
+		Sha256: file.Sha256,
+	})
+	if err != nil || updated == 0 {
+		return false, err
+	}
+
+	if text == "" {
+		err = qtx.FileTextDelete(ctx, file.ID)
+	} else {
+		err = qtx.FileTextUpsert(ctx, db.FileTextUpsertParams{
+			FileID:  file.ID,
+			Content: text,
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// text extracts the text of a file. Files that can't be parsed have none,
+// only errors of the storage are returned.
+func (s *Service) text(ctx context.Context, file db.File) (string, error) {
+	format := textFormatOf(file)
+	if format == formatNone || file.FileSize > maxExtractSource {
+		return "", nil
+	}
+	if format == formatPDF && pdftotext() == "" {
+		return "", nil
+	}
+
+	object, err := s.Storage.Open(ctx, ObjectName(file))
+	if errors.Is(err, storage.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	w := &textWriter{}
+	switch format {
+	case formatPlain:
+		_, err = io.Copy(w, object)
+	case formatPDF:
+		err = extractPDF(ctx, w, object)
+	case formatDOCX:
+		err = extractDocument(w, object, file.FileSize, "word/document.xml", docxText)
+	case formatODT:
+		err = extractDocument(w, object, file.FileSize, "content.xml", odtText)
+	}
+	if err != nil && !errors.Is(err, errTextLimit) {
+		slog.Warn("cannot extract text", "id", file.ID, "mime_type", file.MimeType, "err", err)
+		return "", nil
+	}
+
+	return w.String(), nil
+}
+
+// textWriter collects up to maxTextSize bytes of text and fails with
+// errTextLimit afterwards.
+type textWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *textWriter) Write(p []byte) (int, error) {
+	n := maxTextSize - w.buf.Len()
+	if n <= 0 {
+		return 0, errTextLimit
+	}
+	if len(p) > n {
+		w.buf.Write(p[:n])
+		return n, errTextLimit
+	}
+	return w.buf.Write(p)
+}
+
+func (w *textWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// String returns the text as valid UTF-8 without NUL bytes, which Postgres
+// rejects. A character cut off at the limit is dropped too.
+func (w *textWriter) String() string {
+	text := strings.ToValidUTF8(w.buf.String(), "")
+	return strings.TrimSpace(strings.ReplaceAll(text, "\x00", ""))
+}
+
+// extractPDF writes the text of a PDF with pdftotext.
+func extractPDF(ctx context.Context, w io.Writer, r io.Reader) error {
+	input, err := os.CreateTemp("", "text-*.pdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(input.Name())
+
+	_, err = io.Copy(input, r)
+	if err != nil {
+		input.Close()
+		return err
+	}
+	err = input.Close()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdfExtractTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, pdftotext(), "-q", "-enc", "UTF-8", input.Name(), "-")
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	_, copyErr := io.Copy(w, stdout)
+	if copyErr != nil {
+		// Stops pdftotext if the limit is reached
+		cancel()
+	}
+	err = cmd.Wait()
+	if copyErr != nil {
+		return copyErr
+	}
+	if err != nil {
+		return fmt.Errorf("pdftotext: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// extractDocument writes the text of the XML file name in a zip based office
+// document.
+func extractDocument(w *textWriter, r io.ReaderAt, size int64, name string, extract func(*textWriter, *xml.Decoder) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		// Protects against zip bombs
+		lr := io.LimitReader(rc, maxDocumentXMLSize)
+		return extract(w, xml.NewDecoder(bufio.NewReader(lr)))
+	}
+
+	return fmt.Errorf("%s is missing", name)
+}
+
+// docxText writes the runs of text (w:t) of a WordprocessingML document, one
+// paragraph (w:p) per line.
+func docxText(w *textWriter, d *xml.Decoder) error {
+	inText := false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				_, err = w.WriteString("\t")
+			case "br", "cr":
+				_, err = w.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				_, err = w.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				_, err = w.Write(t)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// odtText writes the text of the body of an OpenDocument text, one paragraph
+// (text:p) or heading (text:h) per line.
+func odtText(w *textWriter, d *xml.Decoder) error {
+	inBody := false
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = true
+			case "s":
+				_, err = w.WriteString(" ")
+			case "tab":
+				_, err = w.WriteString("\t")
+			case "line-break":
+				_, err = w.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = false
+			case "p", "h":
+				_, err = w.WriteString("\n")
+			}
+		case xml.CharData:
+			if inBody {
+				_, err = w.Write(t)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
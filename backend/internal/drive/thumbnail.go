@@ -0,0 +1,413 @@
+package drive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"example/internal/database/db"
+	"example/internal/storage"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+const (
+	// thumbnailPrefix holds the thumbnails of files, named by the ID of the
+	// file and the size.
+	thumbnailPrefix = "thumbnails/"
+
+	// thumbnailBatchSize is the number of files handled per query.
+	thumbnailBatchSize = 50
+	// maxThumbnailSource is the size up to which files get thumbnails.
+	maxThumbnailSource = 100 << 20
+	// maxThumbnailPixels is the maximum resolution of decoded images, which
+	// protects against decompression bombs.
+	maxThumbnailPixels = 50_000_000
+	thumbnailQuality   = 80
+	// pdfRenderTimeout is the time pdftoppm may take for the first page.
+	pdfRenderTimeout = 30 * time.Second
+)
+
+// ThumbnailSize is a size thumbnails are created in.
+type ThumbnailSize struct {
+	Name string
+	// Pixels is the length of the longer edge.
+	Pixels int
+}
+
+// ThumbnailSizes are ordered from large to small, so each size is scaled down
+// from the previous one.
+var ThumbnailSizes = []ThumbnailSize{
+	{Name: "large", Pixels: 1024},
+	{Name: "medium", Pixels: 512},
+	{Name: "small", Pixels: 128},
+}
+
+// DefaultThumbnailSize is used if no size is requested.
+const DefaultThumbnailSize = "medium"
+
+func validThumbnailSize(name string) bool {
+	for _, size := range ThumbnailSizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func thumbnailName(id string, size string) string {
+	return thumbnailPrefix + id + "/" + size
+}
+
+// objectFileID returns the ID of the file an object (other than a blob)
+// belongs to.
+func objectFileID(key string) string {
+	if rest, ok := strings.CutPrefix(key, thumbnailPrefix); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		return id
+	}
+	return key
+}
+
+// pdftoppm is the path of the renderer of poppler-utils. Without it PDFs get
+// no thumbnails; HEIC has no decoder in Go and gets none either.
+var pdftoppm = sync.OnceValue(func() string {
+	path, _ := exec.LookPath("pdftoppm")
+	return path
+})
+
+func thumbnailable(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	case "application/pdf":
+		return pdftoppm() != ""
+	default:
+		return false
+	}
+}
+
+// OpenThumbnail returns a thumbnail of a file. It returns ErrNotFound until
+// the thumbnail is created and for files that have none.
+func (s *Service) OpenThumbnail(ctx context.Context, node Node, size string) (storage.Object, error) {
+	if node.IsDir() || !validThumbnailSize(size) {
+		return nil, ErrInvalid
+	}
+	if node.Role < RoleViewer {
+		return nil, ErrForbidden
+	}
+	if !node.File.HasThumbnail {
+		return nil, ErrNotFound
+	}
+
+	object, err := s.Storage.Open(ctx, thumbnailName(node.File.ID, size))
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return object, err
+}
+
+// GenerateThumbnails creates the thumbnails of all files whose contents
+// changed since. It returns the number of files that got thumbnails.
+func (s *Service) GenerateThumbnails(ctx context.Context) (int, error) {
+	created := 0
+	for {
+		files, err := s.DB.FileFindUnthumbnailed(ctx, thumbnailBatchSize)
+		if err != nil {
+			return created, err
+		}
+
+		for _, file := range files {
+			ok, err := s.thumbnail(ctx, file)
+			if err != nil {
+				return created, err
+			}
+			if ok {
+				created++
+			}
+
+			// Skipped if the contents changed in the meantime, the file
+			// is picked up again then
+			err = s.DB.FileUpdateThumbnailed(ctx, db.FileUpdateThumbnailedParams{
+				HasThumbnail: ok,
+				ID:           file.ID,
+				Sha256:       file.Sha256,
+			})
+			if err != nil {
+				return created, err
+			}
+		}
+
+		if len(files) < thumbnailBatchSize {
+			return created, nil
+		}
+	}
+}
+
+// thumbnail stores the thumbnails of a file. Files that can't be decoded get
+// none, only errors of the storage are returned.
+func (s *Service) thumbnail(ctx context.Context, file db.File) (bool, error) {
+	if !thumbnailable(file.MimeType) || file.FileSize > maxThumbnailSource {
+		return false, nil
+	}
+
+	object, err := s.Storage.Open(ctx, ObjectName(file))
+	if errors.Is(err, storage.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+
+	var img image.Image
+	if file.MimeType == "application/pdf" {
+		img, err = renderPDF(ctx, object)
+	} else {
+		img, err = decodeImage(object)
+	}
+	if err != nil {
+		slog.Warn("cannot create thumbnail", "id", file.ID, "mime_type", file.MimeType, "err", err)
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	for _, size := range ThumbnailSizes {
+		img = scaleImage(img, size.Pixels)
+
+		buf.Reset()
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality})
+		if err != nil {
+			return false, err
+		}
+
+		_, err = s.Storage.Put(ctx, thumbnailName(file.ID, size.Name), &buf, int64(buf.Len()), storage.PutOptions{
+			ContentType:    "image/jpeg",
+			OrganisationID: file.OrganisationID,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// decodeImage decodes an image after checking its resolution. JPEGs are
+// rotated according to their EXIF orientation.
+func decodeImage(r io.ReadSeeker) (image.Image, error) {
+	// The orientation is in a segment before the ones DecodeConfig needs
+	var head bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &limitedBuffer{buf: &head, limit: 1 << 17}))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		img = orient(img, exifOrientation(head.Bytes()))
+	}
+	return img, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.buf.Len(); n > 0 {
+		b.buf.Write(p[:min(n, len(p))])
+	}
+	return len(p), nil
+}
+
+// exifOrientation returns the orientation tag of the EXIF data of a JPEG, or 1
+// if there is none.
+func exifOrientation(data []byte) int {
+	// Segments start after the SOI marker
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || i+2+length > len(data) {
+			// The image data starts
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orient transforms an image so that it is displayed upright, orientation
+// being the EXIF value.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation == 1 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = w-1-y, x
+			case 7:
+				dx, dy = w-1-y, h-1-x
+			case 8:
+				dx, dy = y, h-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// scaleImage scales an image down so that its longer edge has at most pixels
+// pixels. Transparent areas become white, as thumbnails are JPEGs.
+func scaleImage(img image.Image, pixels int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > pixels || h > pixels {
+		if w >= h {
+			w, h = pixels, max(1, h*pixels/w)
+		} else {
+			w, h = max(1, w*pixels/h), pixels
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// renderPDF renders the first page of a PDF with pdftoppm.
+func renderPDF(ctx context.Context, r io.Reader) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "thumbnail-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	f, err := os.Create(input)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdfRenderTimeout)
+	defer cancel()
+
+	largest := fmt.Sprint(ThumbnailSizes[0].Pixels)
+	output := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, pdftoppm(), "-png", "-f", "1", "-l", "1", "-singlefile", "-scale-to", largest, input, output)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, bytes.TrimSpace(out))
+	}
+
+	page, err := os.Open(output + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+
+	return png.Decode(bufio.NewReader(page))
+}
@@ -0,0 +1,232 @@
+package drive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"example/internal/database"
+	"example/internal/database/db"
+	"log/slog"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// Access kinds recorded for the recent files.
+const (
+	AccessOpen     = db.FileAccessKindOpen
+	AccessDownload = db.FileAccessKindDownload
+	AccessEdit     = db.FileAccessKindEdit
+)
+
+// RecordAccess remembers that the user accessed a file for Recent. Failures
+// are only logged, they shouldn't fail the access itself.
+func (s *Service) RecordAccess(ctx context.Context, user *db.User, file db.File, kind db.FileAccessKind) {
+	err := s.DB.FileAccessRecord(ctx, db.FileAccessRecordParams{
+		UserID: user.ID,
+		FileID: file.ID,
+		Kind:   kind,
+	})
+	if err != nil {
+		slog.Error("error recording file access", "id", file.ID, "err", err)
+	}
+}
+
+// Star adds a file or folder to the starred files of the user.
+func (s *Service) Star(ctx context.Context, user *db.User, node Node) error {
+	if node.Kind != KindFile {
+		return ErrInvalid
+	}
+
+	return s.DB.FileStarCreate(ctx, db.FileStarCreateParams{
+		UserID: user.ID,
+		FileID: node.File.ID,
+	})
+}
+
+func (s *Service) Unstar(ctx context.Context, user *db.User, node Node) error {
+	if node.Kind != KindFile {
+		return ErrInvalid
+	}
+
+	return s.DB.FileStarDelete(ctx, db.FileStarDeleteParams{
+		UserID: user.ID,
+		FileID: node.File.ID,
+	})
+}
+
+// Starred returns a page of the files starred by the user, the latest first.
+func (s *Service) Starred(ctx context.Context, user *db.User, limit int, cursor string) (Page, error) {
+	source := s.DB.NewQueryBuilder().
+		Select("file_id", "created_at AS listed_at").
+		From("file_stars").
+		Where(squirrel.Eq{"user_id": user.ID})
+
+	return s.viewPage(ctx, user, source, limit, cursor)
+}
+
+// Recent returns a page of the files the user opened, downloaded or edited,
+// the latest first.
+func (s *Service) Recent(ctx context.Context, user *db.User, limit int, cursor string) (Page, error) {
+	source := s.DB.NewQueryBuilder().
+		Select("file_id", "accessed_at AS listed_at").
+		From("file_accesses").
+		Where(squirrel.Eq{"user_id": user.ID})
+
+	return s.viewPage(ctx, user, source, limit, cursor)
+}
+
+// SharedWithMe returns a page of the files shared with the user, directly or
+// through one of their groups, the latest shared first. Files in shared
+// folders are found through the folder, files the user owns are left out.
+func (s *Service) SharedWithMe(ctx context.Context, user *db.User, limit int, cursor string) (Page, error) {
+	groups := s.DB.NewQueryBuilder().
+		Select("gm.group_id").
+		From("group_members gm").
+		Join("groups g ON g.id = gm.group_id").
+		Where(squirrel.Eq{"gm.user_id": user.ID, "g.deleted_at": nil})
+
+	source := s.DB.NewQueryBuilder().
+		Select("p.file_id", "MAX(p.created_at) AS listed_at").
+		From("file_permissions p").
+		Join("files sf ON sf.id = p.file_id").
+		Where(squirrel.Eq{"p.deleted_at": nil}).
+		Where("sf.owner_id IS DISTINCT FROM ?", user.ID).
+		Where(squirrel.Or{
+			squirrel.Eq{"p.permission_type": db.PermissionTypeUser, "p.user_id": user.ID},
+			squirrel.And{
+				squirrel.Eq{"p.permission_type": db.PermissionTypeGroup},
+				inSubquery{column: "p.group_id", query: groups},
+			},
+		}).
+		GroupBy("p.file_id")
+
+	return s.viewPage(ctx, user, source, limit, cursor)
+}
+
+// inSubquery is "column IN (query)". Nested builders keep their placeholder
+// format, so the subquery is rendered with question marks first.
+type inSubquery struct {
+	column string
+	query  squirrel.SelectBuilder
+}
+
+func (in inSubquery) ToSql() (string, []any, error) {
+	sql, args, err := in.query.PlaceholderFormat(squirrel.Question).ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return in.column + " IN (" + sql + ")", args, nil
+}
+
+// viewCursor is the position after the last row of a page of a view.
+type viewCursor struct {
+	ListedAt time.Time `json:"t"`
+	ID       string    `json:"i"`
+}
+
+func (c viewCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseViewCursor(s string) (viewCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return viewCursor{}, ErrInvalid
+	}
+
+	var c viewCursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.ID == "" {
+		return viewCursor{}, ErrInvalid
+	}
+	return c, nil
+}
+
+type viewRow struct {
+	db.File
+	ListedAt time.Time `db:"listed_at"`
+}
+
+// viewPage returns a page of the files of source, a query of file_id and
+// listed_at, the latest first. Files the user can't see (anymore) and files
+// in the trash are skipped.
+func (s *Service) viewPage(ctx context.Context, user *db.User, source squirrel.SelectBuilder, limit int, cursor string) (Page, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := s.DB.NewQueryBuilder().
+		Select("f.*", "v.listed_at").
+		FromSelect(source, "v").
+		Join("files f ON f.id = v.file_id").
+		Where(squirrel.Eq{"f.organisation_id": user.OrganisationID, "f.deleted_at": nil}).
+		OrderBy("v.listed_at DESC", "f.id DESC")
+
+	after := viewCursor{}
+	if cursor != "" {
+		var err error
+		after, err = parseViewCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	page := Page{Nodes: make([]Node, 0, limit)}
+	for scanned := 0; scanned < maxPageScan; {
+		q := query
+		if after.ID != "" {
+			q = q.Where("(v.listed_at, f.id) < (?, ?)", after.ListedAt, after.ID)
+		}
+
+		// One more row than fits tells if there is another page
+		rows, err := database.ScanSelectMany[viewRow](s.DB, ctx, q.Limit(uint64(limit+1)))
+		if err != nil {
+			return Page{}, err
+		}
+		if len(rows) == 0 {
+			return page, nil
+		}
+
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+
+		accesses, trashed, err := s.accessByID(ctx, user, ids)
+		if err != nil {
+			return Page{}, err
+		}
+
+		for i, row := range rows {
+			a := accesses[row.ID]
+			role := a.role(user)
+			if trashed[row.ID] || role == RoleNone {
+				continue
+			}
+
+			if len(page.Nodes) == limit {
+				last := rows[i-1]
+				page.NextCursor = viewCursor{ListedAt: last.ListedAt, ID: last.ID}.String()
+				return page, nil
+			}
+			page.Nodes = append(page.Nodes, Node{Kind: KindFile, Name: row.Name, File: row.File, Role: role, access: a})
+		}
+
+		if len(rows) <= limit {
+			return page, nil
+		}
+
+		last := rows[len(rows)-1]
+		after = viewCursor{ListedAt: last.ListedAt, ID: last.ID}
+		scanned += len(rows)
+		if len(page.Nodes) == limit {
+			break
+		}
+	}
+
+	page.NextCursor = after.String()
+	return page, nil
+}
@@ -0,0 +1,123 @@
+// Package events wakes the event streams of an organisation when its files
+// change. Changes are announced with NOTIFY on the file_changes channel in
+// the transaction of the change, so the streams on every replica are woken
+// once it commits.
+package events
+
+import (
+	"context"
+	"example/internal/database"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// channel is the channel of ChangeNotify, the payload is the ID of the
+	// organisation.
+	channel = "file_changes"
+	// retryInterval is the wait before listening again after the connection
+	// failed.
+	retryInterval = 5 * time.Second
+)
+
+type Hub struct {
+	DB *database.DB
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func New(db *database.DB) *Hub {
+	return &Hub{DB: db, subscribers: make(map[string]map[chan struct{}]struct{})}
+}
+
+// Subscribe returns a channel that receives a value when files of the
+// organisation changed, and a function to unsubscribe. Changes in quick
+// succession may wake the subscriber only once.
+func (h *Hub) Subscribe(organisationID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[organisationID] == nil {
+		h.subscribers[organisationID] = make(map[chan struct{}]struct{})
+	}
+	h.subscribers[organisationID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subscribers[organisationID], ch)
+		if len(h.subscribers[organisationID]) == 0 {
+			delete(h.subscribers, organisationID)
+		}
+	}
+}
+
+// publish wakes the subscribers of an organisation, or of all organisations
+// if organisationID is empty.
+func (h *Hub) publish(organisationID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, subscribers := range h.subscribers {
+		if organisationID != "" && id != organisationID {
+			continue
+		}
+		for ch := range subscribers {
+			// A pending wake up covers this change as well
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Run listens for changes until ctx is done, reconnecting after errors.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		err := h.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("error listening for file changes", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	pooled, err := h.DB.DB.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The connection is taken out of the pool, it keeps listening until it
+	// is closed
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+channel)
+	if err != nil {
+		return err
+	}
+
+	// Changes made while not listening were missed
+	h.publish("")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		h.publish(notification.Payload)
+	}
+}
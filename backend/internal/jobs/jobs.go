@@ -0,0 +1,395 @@
+// Package jobs runs work off the request path. Jobs are rows of the jobs
+// table, taken by the workers of all replicas with FOR UPDATE SKIP LOCKED.
+// Failed jobs are retried with exponential backoff and are dead after their
+// last attempt, until an admin retries them.
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultTimeout     = 5 * time.Minute
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+
+	// retryDelay is the wait before the second attempt, it doubles with every
+	// attempt up to maxRetryDelay.
+	retryDelay    = 10 * time.Second
+	maxRetryDelay = time.Hour
+	// rescueGrace is added to the timeout of a kind before a running job is
+	// considered abandoned by its worker.
+	rescueGrace = time.Minute
+
+	// Finished jobs are deleted after these periods.
+	succeededRetention = 7 * 24 * time.Hour
+	deadRetention      = 30 * 24 * time.Hour
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Kind is a type of job with a payload of type T, which is stored as JSON.
+type Kind[T any] struct {
+	Name string
+	// MaxAttempts is the number of attempts before a job is dead,
+	// DefaultMaxAttempts if 0.
+	MaxAttempts int32
+	// Concurrency is the number of jobs of the kind a process runs at once,
+	// 1 if 0.
+	Concurrency int
+	// Timeout limits an attempt, DefaultTimeout if 0.
+	Timeout time.Duration
+}
+
+func (k Kind[T]) maxAttempts() int32 {
+	if k.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return k.MaxAttempts
+}
+
+// Enqueue adds a job to run right away. It is called with the transaction of
+// the change the job belongs to, if there is one. organisationID is empty for
+// jobs of the whole system.
+func (k Kind[T]) Enqueue(ctx context.Context, q *db.Queries, organisationID string, payload T) error {
+	return k.EnqueueAt(ctx, q, organisationID, payload, time.Now())
+}
+
+// EnqueueAt adds a job to run at the given time.
+func (k Kind[T]) EnqueueAt(ctx context.Context, q *db.Queries, organisationID string, payload T, at time.Time) error {
+	return k.create(ctx, q, organisationID, payload, at, "")
+}
+
+func (k Kind[T]) create(ctx context.Context, q *db.Queries, organisationID string, payload T, at time.Time, uniqueKey string) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return q.JobCreate(ctx, db.JobCreateParams{
+		OrganisationID: pgtype.Text{String: organisationID, Valid: organisationID != ""},
+		Kind:           k.Name,
+		Payload:        data,
+		MaxAttempts:    k.maxAttempts(),
+		RunAt:          at,
+		UniqueKey:      pgtype.Text{String: uniqueKey, Valid: uniqueKey != ""},
+	})
+}
+
+type worker struct {
+	kind        string
+	concurrency int
+	timeout     time.Duration
+	run         func(ctx context.Context, payload []byte) error
+}
+
+type schedule struct {
+	interval time.Duration
+	enqueue  func(ctx context.Context, slot time.Time) error
+	// last is the start of the last interval a job was created for.
+	last time.Time
+}
+
+type Queue struct {
+	DB *database.DB
+	// PollInterval is the wait between checks for due jobs.
+	PollInterval time.Duration
+
+	workers   []*worker
+	schedules []*schedule
+}
+
+// cleanupJob deletes finished jobs after their retention period.
+var cleanupJob = Kind[struct{}]{Name: "jobs.cleanup"}
+
+func New(conn *database.DB) *Queue {
+	q := &Queue{DB: conn, PollInterval: time.Second}
+
+	Handle(q, cleanupJob, func(ctx context.Context, _ struct{}) error {
+		now := time.Now()
+		deleted, err := q.DB.JobDeleteFinished(ctx, db.JobDeleteFinishedParams{
+			SucceededBefore: now.Add(-succeededRetention),
+			DeadBefore:      now.Add(-deadRetention),
+		})
+		if deleted > 0 {
+			slog.Info("deleted finished jobs", "count", deleted)
+		}
+		return err
+	})
+	Every(q, cleanupJob, time.Hour, struct{}{})
+
+	return q
+}
+
+// Handle registers the function running the jobs of a kind. All kinds are
+// registered before Run.
+func Handle[T any](q *Queue, kind Kind[T], fn func(ctx context.Context, payload T) error) {
+	timeout := kind.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	q.workers = append(q.workers, &worker{
+		kind:        kind.Name,
+		concurrency: max(kind.Concurrency, 1),
+		timeout:     timeout,
+		run: func(ctx context.Context, data []byte) error {
+			var payload T
+			err := json.Unmarshal(data, &payload)
+			if err != nil {
+				return fmt.Errorf("invalid payload: %w", err)
+			}
+			return fn(ctx, payload)
+		},
+	})
+}
+
+// Every schedules a job of the kind every interval, counted from the Unix
+// epoch, e.g. at the start of every hour. All replicas schedule it, but
+// only one job is created per interval.
+//
+// Cron expressions aren't supported on purpose: all periodic jobs of the
+// system are clean ups that run at fixed intervals, and a job that needs a
+// time of day can check it in its handler.
+func Every[T any](q *Queue, kind Kind[T], interval time.Duration, payload T) {
+	q.schedules = append(q.schedules, &schedule{
+		interval: interval,
+		enqueue: func(ctx context.Context, slot time.Time) error {
+			key := kind.Name + "@" + strconv.FormatInt(slot.Unix(), 10)
+			return kind.create(ctx, q.DB.Queries, "", payload, slot, key)
+		},
+	})
+}
+
+// Run schedules periodic jobs and runs the jobs of all registered kinds until
+// ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	for _, w := range q.workers {
+		go q.work(ctx, w)
+	}
+
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		for _, s := range q.schedules {
+			slot := now.Truncate(s.interval)
+			if slot.Equal(s.last) {
+				continue
+			}
+
+			err := s.enqueue(ctx, slot)
+			if err != nil {
+				slog.Error("error scheduling job", "err", err)
+				continue
+			}
+			s.last = slot
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work runs up to w.concurrency jobs of a kind at once.
+func (q *Queue) work(ctx context.Context, w *worker) {
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	running := make(chan struct{}, w.concurrency)
+	finished := make(chan struct{}, 1)
+
+	for {
+		rescued, err := q.DB.JobRescue(ctx, db.JobRescueParams{
+			Kind:   w.kind,
+			Before: time.Now().Add(-w.timeout - rescueGrace),
+		})
+		if err != nil {
+			slog.Error("error rescuing jobs", "kind", w.kind, "err", err)
+		} else if rescued > 0 {
+			slog.Warn("rescued abandoned jobs", "kind", w.kind, "count", rescued)
+		}
+
+		if free := w.concurrency - len(running); free > 0 {
+			jobs, err := q.DB.JobClaim(ctx, db.JobClaimParams{
+				Kind:      w.kind,
+				BatchSize: int32(free),
+			})
+			if err != nil {
+				slog.Error("error claiming jobs", "kind", w.kind, "err", err)
+			}
+
+			for _, job := range jobs {
+				running <- struct{}{}
+				go func() {
+					defer func() {
+						<-running
+						// Takes the next job right away
+						select {
+						case finished <- struct{}{}:
+						default:
+						}
+					}()
+					q.execute(ctx, w, job)
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-finished:
+		}
+	}
+}
+
+// backoff returns the wait before the next attempt after the given number of
+// attempts.
+func backoff(attempts int32) time.Duration {
+	delay := retryDelay
+	for i := int32(1); i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// execute makes an attempt to run a job and records the result. The result
+// is dropped if the job was rescued and taken by another worker meanwhile.
+func (q *Queue) execute(ctx context.Context, w *worker, job db.Job) {
+	err := q.call(ctx, w, job)
+
+	switch {
+	case err == nil:
+		err = q.DB.JobSucceed(ctx, db.JobSucceedParams{
+			ID:       job.ID,
+			LockedAt: job.LockedAt,
+		})
+	case job.Attempts >= job.MaxAttempts:
+		slog.Error("job failed permanently", "kind", job.Kind, "id", job.ID, "err", err)
+		err = q.DB.JobBury(ctx, db.JobBuryParams{
+			Error:    err.Error(),
+			ID:       job.ID,
+			LockedAt: job.LockedAt,
+		})
+	default:
+		slog.Warn("job failed", "kind", job.Kind, "id", job.ID, "attempt", job.Attempts, "err", err)
+		err = q.DB.JobRetry(ctx, db.JobRetryParams{
+			RunAt:    time.Now().Add(backoff(job.Attempts)),
+			Error:    err.Error(),
+			ID:       job.ID,
+			LockedAt: job.LockedAt,
+		})
+	}
+	if err != nil {
+		slog.Error("error recording job result", "kind", job.Kind, "id", job.ID, "err", err)
+	}
+}
+
+func (q *Queue) call(ctx context.Context, w *worker, job db.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return w.run(ctx, job.Payload)
+}
+
+// Filter selects jobs. Empty fields match all jobs.
+type Filter struct {
+	Status db.JobStatus
+	Kind   string
+}
+
+// cursor is the position after the last job of a page.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+}
+
+func (c cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Jobs returns a page of the jobs of an organisation matching the filter,
+// the latest first, and the cursor of the next page, which is empty on the
+// last page. organisationID is empty for the jobs of the whole system.
+func (q *Queue) Jobs(ctx context.Context, organisationID string, f Filter, limit int, after string) ([]db.Job, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := q.DB.NewQueryBuilder().
+		Select("*").
+		From("jobs").
+		OrderBy("created_at DESC", "id DESC")
+
+	if organisationID != "" {
+		query = query.Where(squirrel.Eq{"organisation_id": organisationID})
+	} else {
+		query = query.Where(squirrel.Eq{"organisation_id": nil})
+	}
+	if f.Status != "" {
+		query = query.Where(squirrel.Eq{"status": f.Status})
+	}
+	if f.Kind != "" {
+		query = query.Where(squirrel.Eq{"kind": f.Kind})
+	}
+	if after != "" {
+		c, err := parseCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", c.CreatedAt, c.ID)
+	}
+
+	// One more row than fits tells if there is another page
+	jobs, err := database.ScanSelectMany[db.Job](q.DB, ctx, query.Limit(uint64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(jobs) <= limit {
+		return jobs, "", nil
+	}
+
+	last := jobs[limit-1]
+	return jobs[:limit], cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String(), nil
+}
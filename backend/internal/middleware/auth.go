@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"example/internal/database"
 	"example/internal/database/db"
+	"log/slog"
 	"net/http"
 )
 
@@ -35,3 +38,31 @@ func GetUser(ctx context.Context, db *database.DB) (*db.User, bool) {
 	}
 	return &user, true
 }
+
+// HashToken returns the representation of a long-lived token (API tokens,
+// SCIM tokens) that is stored in the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUserByAPIToken returns the user owning the given API token.
+func GetUserByAPIToken(ctx context.Context, db *database.DB, token string) (*db.User, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	hash := HashToken(token)
+
+	user, err := db.GLOBAL_UserFindByApiToken(ctx, hash)
+	if err != nil {
+		return nil, false
+	}
+
+	err = db.ApiTokenTouch(ctx, hash)
+	if err != nil {
+		slog.Error("error updating api token", "err", err)
+	}
+
+	return &user, true
+}
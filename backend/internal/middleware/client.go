@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Client is the address and software a request came from, as recorded in the
+// audit log.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// trustProxy takes the address of the client from X-Forwarded-For, which is
+// only set by a reverse proxy in front of the server.
+var trustProxy = os.Getenv("TRUST_PROXY") == "true"
+
+// ClientInfo stores the Client of the request in its context.
+func ClientInfo(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := Client{IP: remoteIP(r), UserAgent: r.UserAgent()}
+		handler.ServeHTTP(w, r.WithContext(WithClient(r.Context(), client)))
+	})
+}
+
+// WithClient returns a context carrying the client, for connections that
+// aren't HTTP requests.
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// GetClient returns the Client stored by ClientInfo or WithClient.
+func GetClient(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+func remoteIP(r *http.Request) string {
+	if trustProxy {
+		// The proxy appends the address it got the request from
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -8,7 +8,9 @@ func CORS(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Multipart-Boundary")
 
-		if r.Method == "OPTIONS" {
+		// Only answer CORS preflight requests here, WebDAV clients send
+		// plain OPTIONS requests that have to reach the handler.
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
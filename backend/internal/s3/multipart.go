@@ -0,0 +1,249 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxParts = 10000
+	// minPartSize is the minimum size of all but the last part.
+	minPartSize = 5 << 20
+)
+
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// createMultipartUpload starts an upload. Permissions are checked again when
+// the upload is completed, as folders may change in the meantime.
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+	if bucket.Role < drive.RoleManager {
+		return errAccessDenied
+	}
+
+	_, _, err = splitKey(key)
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.DB.MultipartUploadCreate(ctx, db.MultipartUploadCreateParams{
+		UserID:   user.ID,
+		BucketID: bucket.File.ID,
+		Key:      key,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeXML(w, http.StatusOK, InitiateMultipartUploadResult{
+		Bucket:   name,
+		Key:      key,
+		UploadID: upload.ID,
+	})
+}
+
+// upload returns a multipart upload of the user for the given key.
+func (s *Server) upload(ctx context.Context, user *db.User, bucket drive.Node, key string, id string) (db.MultipartUpload, error) {
+	upload, err := s.DB.MultipartUploadFind(ctx, db.MultipartUploadFindParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.MultipartUpload{}, errNoSuchUpload
+	}
+	if err != nil {
+		return db.MultipartUpload{}, err
+	}
+	if upload.BucketID != bucket.File.ID || upload.Key != key {
+		return db.MultipartUpload{}, errNoSuchUpload
+	}
+
+	return upload, nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string, uploadID string, partNumber string) error {
+	ctx := r.Context()
+
+	number, err := strconv.Atoi(partNumber)
+	if err != nil || number < 1 || number > maxParts {
+		return errInvalidArgument("invalid part number")
+	}
+	if r.ContentLength < 0 {
+		return &Error{Code: "MissingContentLength", Message: "You must provide the Content-Length HTTP header.", Status: http.StatusLengthRequired}
+	}
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.upload(ctx, user, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	b := &body{r: r.Body}
+	part, err := s.Drive.PutPart(ctx, user, upload.ID, number, b, r.ContentLength)
+	if err != nil {
+		return bodyError(b, driveError(err, errNoSuchUpload))
+	}
+
+	w.Header().Set("ETag", `"`+part.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string, uploadID string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.upload(ctx, user, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var req CompleteMultipartUpload
+	err = decodeXML(r, &req)
+	if err != nil {
+		return err
+	}
+	if len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	uploaded, err := s.Drive.Parts(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[int]drive.Part, len(uploaded))
+	for _, part := range uploaded {
+		stored[part.Number] = part
+	}
+
+	parts := make([]drive.Part, 0, len(req.Parts))
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+
+		part, ok := stored[p.PartNumber]
+		if !ok || strings.Trim(p.ETag, `"`) != part.ETag {
+			return errInvalidPart
+		}
+		if i < len(req.Parts)-1 && part.Size < minPartSize {
+			return errEntityTooSmall
+		}
+
+		parts = append(parts, part)
+	}
+
+	dir, filename, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+
+	parent, err := s.mkdirAll(ctx, user, bucket, dir)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	file, err := s.Drive.ComposeParts(ctx, user, parent, filename, upload.ID, parts)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionUpload, file))
+
+	err = s.abort(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	node, err := s.Drive.Child(ctx, user, parent, filename)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	info, err := s.Drive.Stat(ctx, node)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	return writeXML(w, http.StatusOK, CompleteMultipartUploadResult{
+		Location: "/" + name + "/" + key,
+		Bucket:   name,
+		Key:      key,
+		ETag:     `"` + info.ETag + `"`,
+	})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string, uploadID string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	upload, err := s.upload(ctx, user, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	err = s.abort(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// abort removes the parts and the upload.
+func (s *Server) abort(ctx context.Context, uploadID string) error {
+	err := s.Drive.AbortParts(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	return s.DB.MultipartUploadDelete(ctx, uploadID)
+}
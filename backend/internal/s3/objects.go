@@ -0,0 +1,676 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxKeys is the default and maximum page size of listings.
+	maxKeys = 1000
+
+	timeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// bucket returns the shared drive with the given name.
+func (s *Server) bucket(ctx context.Context, user *db.User, name string) (drive.Node, error) {
+	node, err := s.Drive.Child(ctx, user, s.Drive.SharedDrives(user), name)
+	if err != nil {
+		return drive.Node{}, driveError(err, errNoSuchBucket)
+	}
+	return node, nil
+}
+
+// resolve returns the node for a key, i.e. a slash separated path inside the
+// bucket.
+func (s *Server) resolve(ctx context.Context, user *db.User, bucket drive.Node, key string) (drive.Node, error) {
+	node := bucket
+	for _, name := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		var err error
+		node, err = s.Drive.Child(ctx, user, node, name)
+		if err != nil {
+			return drive.Node{}, err
+		}
+	}
+	return node, nil
+}
+
+// mkdirAll returns the folder for dir, creating missing folders on the way
+// like S3 clients expect.
+func (s *Server) mkdirAll(ctx context.Context, user *db.User, bucket drive.Node, dir string) (drive.Node, error) {
+	node := bucket
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" {
+			continue
+		}
+
+		child, err := s.Drive.Child(ctx, user, node, name)
+		if errors.Is(err, drive.ErrNotFound) {
+			_, err = s.Drive.Mkdir(ctx, user, node, name)
+			if err != nil {
+				return drive.Node{}, err
+			}
+			child, err = s.Drive.Child(ctx, user, node, name)
+		}
+		if err != nil {
+			return drive.Node{}, err
+		}
+		if !child.IsDir() {
+			return drive.Node{}, drive.ErrExists
+		}
+
+		node = child
+	}
+	return node, nil
+}
+
+// splitKey returns the folder and the file name of a key.
+func splitKey(key string) (string, string, error) {
+	dir, name := path.Split(key)
+	if name == "" || name == "." || name == ".." {
+		return "", "", errInvalidArgument("invalid key")
+	}
+	return dir, name, nil
+}
+
+type Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+func owner(user *db.User) Owner {
+	return Owner{ID: user.ID, DisplayName: user.Email}
+}
+
+type Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type ListAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   Owner    `xml:"Owner"`
+	Buckets []Bucket `xml:"Buckets>Bucket"`
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request, user *db.User) error {
+	drives, err := s.Drive.List(r.Context(), user, s.Drive.SharedDrives(user))
+	if err != nil {
+		return err
+	}
+
+	resp := ListAllMyBucketsResult{Owner: owner(user), Buckets: make([]Bucket, 0, len(drives))}
+	for _, d := range drives {
+		resp.Buckets = append(resp.Buckets, Bucket{Name: d.Name, CreationDate: d.File.CreatedAt.UTC().Format(timeFormat)})
+	}
+
+	return writeXML(w, http.StatusOK, resp)
+}
+
+func (s *Server) headBucket(w http.ResponseWriter, r *http.Request, user *db.User, name string) error {
+	_, err := s.bucket(r.Context(), user, name)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type LocationConstraint struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+func (s *Server) getBucketLocation(w http.ResponseWriter, r *http.Request, user *db.User, name string) error {
+	_, err := s.bucket(r.Context(), user, name)
+	if err != nil {
+		return err
+	}
+
+	// us-east-1 is reported as an empty constraint
+	location := s.Region
+	if location == defaultRegion {
+		location = ""
+	}
+
+	return writeXML(w, http.StatusOK, LocationConstraint{Location: location})
+}
+
+type Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// etag returns the ETag of a file in listings. S3 clients expect the MD5 of
+// the contents, which files uploaded before checksums were recorded lack.
+func etag(file db.File) string {
+	if !file.Md5.Valid {
+		return ""
+	}
+	return `"` + file.Md5.String + `"`
+}
+
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type ListBucketResult struct {
+	XMLName        xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []Object       `xml:"Contents"`
+	CommonPrefixes []CommonPrefix `xml:"CommonPrefixes"`
+
+	// ListObjects (V1)
+	Marker     *string `xml:"Marker"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// ListObjectsV2
+	KeyCount              *int   `xml:"KeyCount"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+}
+
+// entry is a key found while walking the tree. Folders are only reported as
+// common prefixes, so empty folders don't show up without a delimiter.
+type entry struct {
+	key  string
+	node drive.Node
+}
+
+// listObjects implements ListObjects and ListObjectsV2. Keys are collected by
+// walking the folders below the prefix, so listings of large drives without
+// a delimiter are expensive.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, user *db.User, name string) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	v2 := query.Get("list-type") == "2"
+
+	limit := maxKeys
+	if query.Has("max-keys") {
+		limit, err = strconv.Atoi(query.Get("max-keys"))
+		if err != nil || limit < 0 {
+			return errInvalidArgument("invalid max-keys")
+		}
+		limit = min(limit, maxKeys)
+	}
+
+	resp := ListBucketResult{
+		Name:         name,
+		Prefix:       prefix,
+		Delimiter:    delimiter,
+		MaxKeys:      limit,
+		EncodingType: query.Get("encoding-type"),
+		Contents:     make([]Object, 0),
+	}
+
+	marker := query.Get("marker")
+	if v2 {
+		resp.StartAfter = query.Get("start-after")
+		resp.ContinuationToken = query.Get("continuation-token")
+
+		marker = resp.StartAfter
+		if resp.ContinuationToken != "" {
+			token, err := base64.URLEncoding.DecodeString(resp.ContinuationToken)
+			if err != nil {
+				return errInvalidArgument("invalid continuation token")
+			}
+			marker = string(token)
+		}
+	} else {
+		resp.Marker = &marker
+	}
+
+	// Only the folder the prefix points into needs to be walked
+	dir, _ := path.Split(prefix)
+	entries, err := s.walk(ctx, user, bucket, dir, delimiter != "/")
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	seen := make(map[string]bool)
+	count := 0
+	for _, e := range entries {
+		if !strings.HasPrefix(e.key, prefix) {
+			continue
+		}
+
+		// Keys containing the delimiter after the prefix are rolled up
+		key := e.key
+		isPrefix := e.node.IsDir()
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key = key[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		if key <= marker || seen[key] {
+			continue
+		}
+
+		if count == limit {
+			resp.IsTruncated = true
+			break
+		}
+		seen[key] = true
+		count++
+
+		if isPrefix {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, CommonPrefix{Prefix: encodeKey(key, resp.EncodingType)})
+		} else {
+			resp.Contents = append(resp.Contents, Object{
+				Key:          encodeKey(key, resp.EncodingType),
+				LastModified: e.node.File.UpdatedAt.UTC().Format(timeFormat),
+				ETag:         etag(e.node.File),
+				Size:         e.node.File.FileSize,
+				StorageClass: "STANDARD",
+			})
+		}
+
+		if resp.NextMarker < key {
+			resp.NextMarker = key
+		}
+	}
+
+	if v2 {
+		resp.KeyCount = &count
+		if resp.IsTruncated {
+			resp.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(resp.NextMarker))
+		}
+		resp.NextMarker = ""
+	} else if !resp.IsTruncated {
+		resp.NextMarker = ""
+	}
+
+	return writeXML(w, http.StatusOK, resp)
+}
+
+// walk returns the entries below dir. Folders are included with a trailing
+// slash, files of subfolders only if recursive is set.
+func (s *Server) walk(ctx context.Context, user *db.User, bucket drive.Node, dir string, recursive bool) ([]entry, error) {
+	node := bucket
+	if dir != "" {
+		var err error
+		node, err = s.resolve(ctx, user, bucket, dir)
+		if errors.Is(err, drive.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, driveError(err, errNoSuchKey)
+		}
+		if !node.IsDir() {
+			return nil, nil
+		}
+	}
+
+	children, err := s.Drive.List(ctx, user, node)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for _, child := range children {
+		key := dir + child.Name
+		if !child.IsDir() {
+			entries = append(entries, entry{key: key, node: child})
+			continue
+		}
+
+		key += "/"
+		if !recursive {
+			entries = append(entries, entry{key: key, node: child})
+			continue
+		}
+
+		sub, err := s.walk(ctx, user, bucket, key, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sub...)
+	}
+	return entries, nil
+}
+
+func encodeKey(key string, encodingType string) string {
+	if encodingType != "url" {
+		return key
+	}
+	return strings.ReplaceAll(uriEncode(key, false), "%20", "+")
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	node, err := s.resolve(ctx, user, bucket, key)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+	if node.IsDir() {
+		return errNoSuchKey
+	}
+
+	info, err := s.Drive.Stat(ctx, node)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	object, err := s.Drive.Open(ctx, node)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+	defer object.Close()
+
+	etag := info.ETag
+	if node.File.Md5.Valid {
+		etag = node.File.Md5.String
+	}
+
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Content-Type", node.File.MimeType)
+
+	// ServeContent handles ranges and conditional requests. Errors can't be
+	// reported as XML from here on.
+	http.ServeContent(w, r, "", info.LastModified, &download{ReadSeeker: object, record: func() {
+		s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionDownload, node.File))
+	}})
+	return nil
+}
+
+// download calls record with the first bytes read from the object, so that
+// HEAD and conditional requests, which serve none, aren't recorded.
+type download struct {
+	io.ReadSeeker
+	record func()
+	read   bool
+}
+
+func (d *download) Read(p []byte) (int, error) {
+	n, err := d.ReadSeeker.Read(p)
+	if n > 0 && !d.read {
+		d.read = true
+		d.record()
+	}
+	return n, err
+}
+
+// body records the errors of the verifying body readers, which minio-go
+// doesn't pass through unchanged.
+type body struct {
+	r   io.Reader
+	err error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.err = err
+	}
+	return n, err
+}
+
+// bodyError prefers the error reading the request body over err.
+func bodyError(b *body, err error) error {
+	var s3Err *Error
+	if errors.As(b.err, &s3Err) {
+		return s3Err
+	}
+	return err
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	// Keys with a trailing slash are folder markers
+	if strings.HasSuffix(key, "/") {
+		if r.ContentLength > 0 {
+			return errInvalidArgument("folder markers can't have contents")
+		}
+
+		_, err = s.mkdirAll(ctx, user, bucket, key)
+		if err != nil {
+			return driveError(err, errNoSuchKey)
+		}
+
+		w.Header().Set("ETag", `"`+hex.EncodeToString(md5.New().Sum(nil))+`"`)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	dir, filename, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+
+	parent, err := s.mkdirAll(ctx, user, bucket, dir)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	size := r.ContentLength
+	if size < 0 {
+		size = -1
+	}
+
+	digest, err := requestDigest(r)
+	if err != nil {
+		return err
+	}
+
+	b := &body{r: r.Body}
+
+	file, err := s.Drive.Put(ctx, user, parent, filename, drive.Verify(b, size, digest), size)
+	if err != nil {
+		return bodyError(b, driveError(err, errNoSuchKey))
+	}
+
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionUpload, file))
+
+	w.Header().Set("ETag", `"`+file.Md5.String+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type CopyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+// copyObject implements CopyObject. The copy references the contents of the
+// source, which aren't stored again. An existing object with the key is moved
+// to the trash in the same transaction, so it stays if the copy fails.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string) error {
+	ctx := r.Context()
+
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return errInvalidArgument("invalid copy source")
+	}
+	source, version, _ := strings.Cut(source, "?")
+	if version != "" {
+		return errNotImplemented
+	}
+	srcName, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if srcKey == "" || strings.HasSuffix(srcKey, "/") || strings.HasSuffix(key, "/") {
+		return errInvalidArgument("invalid copy source")
+	}
+
+	srcBucket, err := s.bucket(ctx, user, srcName)
+	if err != nil {
+		return err
+	}
+
+	src, err := s.resolve(ctx, user, srcBucket, srcKey)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+	if src.IsDir() {
+		return errNoSuchKey
+	}
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	dir, filename, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+
+	parent, err := s.mkdirAll(ctx, user, bucket, dir)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	existing, err := s.Drive.Child(ctx, user, parent, filename)
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+	case err != nil:
+		return driveError(err, errNoSuchKey)
+	case existing.IsDir():
+		return errKeyExists
+	case existing.File.ID == src.File.ID:
+		// Copies onto itself only replace metadata, which isn't stored
+		return writeXML(w, http.StatusOK, CopyObjectResult{
+			LastModified: src.File.UpdatedAt.UTC().Format(timeFormat),
+			ETag:         etag(src.File),
+		})
+	}
+
+	var file db.File
+	if existing.File.ID != "" {
+		file, err = s.Drive.CopyOver(ctx, user, src, parent, existing)
+	} else {
+		file, err = s.Drive.Copy(ctx, user, src, parent, filename)
+	}
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	if existing.File.ID != "" {
+		s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionDelete, existing.File))
+	}
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionUpload, file))
+
+	return writeXML(w, http.StatusOK, CopyObjectResult{
+		LastModified: file.UpdatedAt.UTC().Format(timeFormat),
+		ETag:         etag(file),
+	})
+}
+
+// requestDigest returns the checksums sent in the Content-MD5 and
+// x-amz-checksum-sha256 headers.
+func requestDigest(r *http.Request) (drive.Digest, error) {
+	var digest drive.Digest
+
+	if value := r.Header.Get("Content-MD5"); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != md5.Size {
+			return drive.Digest{}, errInvalidDigest
+		}
+		digest.MD5 = sum
+	}
+
+	if value := r.Header.Get("X-Amz-Checksum-Sha256"); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != sha256.Size {
+			return drive.Digest{}, errInvalidDigest
+		}
+		digest.SHA256 = sum
+	}
+
+	return digest, nil
+}
+
+// deleteObject moves the file to the trash. Like S3 it succeeds if the key
+// doesn't exist.
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, user *db.User, name string, key string) error {
+	ctx := r.Context()
+
+	bucket, err := s.bucket(ctx, user, name)
+	if err != nil {
+		return err
+	}
+
+	node, err := s.resolve(ctx, user, bucket, key)
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case err != nil:
+		return driveError(err, errNoSuchKey)
+	}
+
+	// Only empty folders can be deleted through their marker
+	if node.IsDir() {
+		if !strings.HasSuffix(key, "/") {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		children, err := s.Drive.List(ctx, user, node)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return &Error{Code: "InvalidRequest", Message: "The folder is not empty.", Status: http.StatusConflict}
+		}
+	}
+
+	err = s.Drive.Trash(ctx, user, node)
+	if err != nil {
+		return driveError(err, errNoSuchKey)
+	}
+
+	s.Audit.Record(ctx, user, audit.FileEvent(audit.ActionDelete, node.File))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package s3 implements an S3 compatible API on top of the virtual file tree,
+// so that backup tools like rclone or restic can use shared drives as
+// buckets. Only path-style addressing (http://host/bucket/key) is supported.
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultRegion = "us-east-1"
+
+type Server struct {
+	DB    *database.DB
+	Drive *drive.Service
+	Audit *audit.Log
+	// Region is reported by GetBucketLocation.
+	Region string
+}
+
+func NewServer(db *database.DB, drive *drive.Service, log *audit.Log) *Server {
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = defaultRegion
+	}
+
+	return &Server{DB: db, Drive: drive, Audit: log, Region: region}
+}
+
+// Error is an S3 error response.
+type Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	Status  int      `xml:"-"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied          = &Error{Code: "AccessDenied", Message: "Access Denied", Status: http.StatusForbidden}
+	errInvalidAccessKeyID    = &Error{Code: "InvalidAccessKeyId", Message: "The access key ID you provided does not exist.", Status: http.StatusForbidden}
+	errSignatureDoesNotMatch = &Error{Code: "SignatureDoesNotMatch", Message: "The request signature does not match.", Status: http.StatusForbidden}
+	errRequestTimeTooSkewed  = &Error{Code: "RequestTimeTooSkewed", Message: "The difference between the request time and the server's time is too large.", Status: http.StatusForbidden}
+	errExpired               = &Error{Code: "AccessDenied", Message: "Request has expired", Status: http.StatusForbidden}
+	errContentSHA256Mismatch = &Error{Code: "XAmzContentSHA256Mismatch", Message: "The provided x-amz-content-sha256 does not match the payload.", Status: http.StatusBadRequest}
+	errBadDigest             = &Error{Code: "BadDigest", Message: "The Content-MD5 or checksum you specified did not match what we received.", Status: http.StatusBadRequest}
+	errInvalidDigest         = &Error{Code: "InvalidDigest", Message: "The Content-MD5 or checksum you specified is not valid.", Status: http.StatusBadRequest}
+	errIncompleteBody        = &Error{Code: "IncompleteBody", Message: "The request body is malformed or incomplete.", Status: http.StatusBadRequest}
+	errNoSuchBucket          = &Error{Code: "NoSuchBucket", Message: "The specified bucket does not exist.", Status: http.StatusNotFound}
+	errNoSuchKey             = &Error{Code: "NoSuchKey", Message: "The specified key does not exist.", Status: http.StatusNotFound}
+	errNoSuchUpload          = &Error{Code: "NoSuchUpload", Message: "The specified multipart upload does not exist.", Status: http.StatusNotFound}
+	errInvalidPart           = &Error{Code: "InvalidPart", Message: "One or more of the specified parts could not be found.", Status: http.StatusBadRequest}
+	errInvalidPartOrder      = &Error{Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order.", Status: http.StatusBadRequest}
+	errEntityTooSmall        = &Error{Code: "EntityTooSmall", Message: "Your proposed upload is smaller than the minimum allowed object size.", Status: http.StatusBadRequest}
+	errMalformedXML          = &Error{Code: "MalformedXML", Message: "The XML you provided was not well-formed.", Status: http.StatusBadRequest}
+	errQuotaExceeded         = &Error{Code: "QuotaExceeded", Message: "The storage quota of the organisation is exceeded.", Status: http.StatusForbidden}
+	errKeyExists             = &Error{Code: "InvalidRequest", Message: "A folder or file with this key already exists.", Status: http.StatusConflict}
+	errNotImplemented        = &Error{Code: "NotImplemented", Message: "A header or query you provided implies functionality that is not implemented.", Status: http.StatusNotImplemented}
+	errMethodNotAllowed      = &Error{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource.", Status: http.StatusMethodNotAllowed}
+	errInternal              = &Error{Code: "InternalError", Message: "We encountered an internal error. Please try again.", Status: http.StatusInternalServerError}
+)
+
+func errInvalidArgument(message string) *Error {
+	return &Error{Code: "InvalidArgument", Message: message, Status: http.StatusBadRequest}
+}
+
+// driveError maps errors of the drive service to S3 errors. notFound is
+// returned for drive.ErrNotFound, as S3 distinguishes missing buckets, keys
+// and uploads.
+func driveError(err error, notFound *Error) error {
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+		return notFound
+	case errors.Is(err, drive.ErrForbidden):
+		return errAccessDenied
+	case errors.Is(err, drive.ErrExists):
+		return errKeyExists
+	case errors.Is(err, drive.ErrInvalid):
+		return errInvalidArgument(err.Error())
+	case errors.Is(err, drive.ErrQuotaExceeded):
+		return errQuotaExceeded
+	case errors.Is(err, drive.ErrChecksumMismatch):
+		return errBadDigest
+	default:
+		return err
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.route(w, r, user)
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// route dispatches path-style requests to the bucket and object handlers.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, user *db.User) error {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return s.listBuckets(w, r, user)
+	case bucket == "":
+		return errMethodNotAllowed
+	case key == "":
+		return s.routeBucket(w, r, user, bucket, query)
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		return s.createMultipartUpload(w, r, user, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		return s.completeMultipartUpload(w, r, user, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		return s.uploadPart(w, r, user, bucket, key, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		return s.abortMultipartUpload(w, r, user, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return s.copyObject(w, r, user, bucket, key)
+	case r.Method == http.MethodPut:
+		return s.putObject(w, r, user, bucket, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return s.getObject(w, r, user, bucket, key)
+	case r.Method == http.MethodDelete:
+		return s.deleteObject(w, r, user, bucket, key)
+	default:
+		return errMethodNotAllowed
+	}
+}
+
+func (s *Server) routeBucket(w http.ResponseWriter, r *http.Request, user *db.User, bucket string, query map[string][]string) error {
+	_, location := query["location"]
+
+	switch {
+	case r.Method == http.MethodHead:
+		return s.headBucket(w, r, user, bucket)
+	case r.Method == http.MethodGet && location:
+		return s.getBucketLocation(w, r, user, bucket)
+	case r.Method == http.MethodGet && len(query) > 0 && !isListQuery(query):
+		// Bucket configuration (policies, versioning, ...)
+		return errNotImplemented
+	case r.Method == http.MethodGet:
+		return s.listObjects(w, r, user, bucket)
+	case r.Method == http.MethodPut, r.Method == http.MethodDelete:
+		// Shared drives are managed in the app
+		return errAccessDenied
+	default:
+		return errMethodNotAllowed
+	}
+}
+
+func isListQuery(query map[string][]string) bool {
+	for k := range query {
+		switch {
+		case strings.HasPrefix(k, "X-Amz-"), k == "x-id":
+		case k == "list-type", k == "prefix", k == "delimiter", k == "max-keys", k == "marker",
+			k == "continuation-token", k == "start-after", k == "encoding-type", k == "fetch-owner":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+	return nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var s3Err *Error
+	if !errors.As(err, &s3Err) {
+		slog.Error("error handling s3 request", "method", r.Method, "path", r.URL.Path, "err", err)
+		s3Err = errInternal
+	}
+
+	// Responses to HEAD requests have no body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3Err.Status)
+		return
+	}
+
+	_ = writeXML(w, s3Err.Status, s3Err)
+}
+
+func decodeXML(r *http.Request, v any) error {
+	err := xml.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		var s3Err *Error
+		if errors.As(err, &s3Err) {
+			return err
+		}
+		return errMalformedXML
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"example/internal/database/db"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	amzDate     = "20060102T150405Z"
+	maxSkew     = 15 * time.Minute
+	maxExpires  = 7 * 24 * time.Hour
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	// maxChunkSize limits the chunks of aws-chunked bodies, which are
+	// buffered to verify their signature.
+	maxChunkSize = 16 << 20
+)
+
+// signature holds the parsed parts of a SigV4 signed request.
+type signature struct {
+	accessKeyID   string
+	date          time.Time
+	scope         string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	expires       time.Duration
+	presigned     bool
+}
+
+// authenticate verifies the SigV4 signature of the request, either from the
+// Authorization header or from a presigned URL. On success the request body
+// is replaced by one that verifies (and for aws-chunked uploads decodes) the
+// payload while it is read.
+func (s *Server) authenticate(r *http.Request) (*db.User, error) {
+	ctx := r.Context()
+
+	sig, err := parseSignature(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.DB.GLOBAL_AccessKeyFindByAccessKeyID(ctx, sig.accessKeyID)
+	if err != nil {
+		return nil, errInvalidAccessKeyID
+	}
+
+	// Presigned URLs may be used long after they were signed, but like
+	// other requests not before
+	now := time.Now()
+	switch {
+	case sig.date.Sub(now) > maxSkew:
+		return nil, errRequestTimeTooSkewed
+	case sig.presigned && now.After(sig.date.Add(sig.expires)):
+		return nil, errExpired
+	case !sig.presigned && now.Sub(sig.date) > maxSkew:
+		return nil, errRequestTimeTooSkewed
+	}
+
+	signingKey := deriveKey(key.SecretAccessKey, sig.scope)
+	stringToSign := strings.Join([]string{
+		algorithm,
+		sig.date.Format(amzDate),
+		sig.scope,
+		hexSHA256([]byte(canonicalRequest(r, sig))),
+	}, "\n")
+
+	if !hmac.Equal([]byte(hexHMAC(signingKey, stringToSign)), []byte(sig.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+
+	err = s.verifyPayload(r, sig, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.DB.UserFindByID(ctx, key.UserID)
+	if err != nil {
+		return nil, errInvalidAccessKeyID
+	}
+
+	err = s.DB.AccessKeyTouch(ctx, key.ID)
+	if err != nil {
+		slog.Error("error updating access key", "err", err)
+	}
+
+	return &user, nil
+}
+
+func parseSignature(r *http.Request) (signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return parsePresigned(query)
+	}
+
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), algorithm+" ")
+	if !ok {
+		return signature{}, errAccessDenied
+	}
+
+	var sig signature
+	var credential string
+	for _, field := range strings.Split(auth, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(v, ";")
+		case "Signature":
+			sig.signature = v
+		}
+	}
+
+	err := sig.parseCredential(credential)
+	if err != nil {
+		return signature{}, err
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		date = r.Header.Get("Date")
+	}
+	sig.date, err = parseDate(date)
+	if err != nil {
+		return signature{}, err
+	}
+
+	sig.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if sig.payloadHash == "" {
+		return signature{}, errInvalidArgument("missing x-amz-content-sha256")
+	}
+
+	return sig, sig.validate()
+}
+
+func parsePresigned(query url.Values) (signature, error) {
+	if query.Get("X-Amz-Algorithm") != algorithm {
+		return signature{}, errInvalidArgument("unsupported signature algorithm")
+	}
+
+	sig := signature{
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+		presigned:     true,
+	}
+
+	err := sig.parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return signature{}, err
+	}
+
+	sig.date, err = parseDate(query.Get("X-Amz-Date"))
+	if err != nil {
+		return signature{}, err
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxExpires {
+		return signature{}, errInvalidArgument("invalid X-Amz-Expires")
+	}
+	sig.expires = time.Duration(expires) * time.Second
+
+	return sig, sig.validate()
+}
+
+// parseCredential parses <access key>/<date>/<region>/s3/aws4_request. Any
+// region is accepted, since all drives live in the same place anyway.
+func (sig *signature) parseCredential(credential string) error {
+	accessKeyID, scope, ok := strings.Cut(credential, "/")
+	parts := strings.Split(scope, "/")
+	if !ok || len(parts) != 4 || parts[2] != "s3" || parts[3] != "aws4_request" {
+		return errInvalidArgument("malformed credential")
+	}
+
+	sig.accessKeyID = accessKeyID
+	sig.scope = scope
+	return nil
+}
+
+func (sig *signature) validate() error {
+	switch {
+	case sig.signature == "":
+		return errInvalidArgument("missing signature")
+	case !strings.HasPrefix(sig.scope, sig.date.Format("20060102")+"/"):
+		return errInvalidArgument("credential date does not match request date")
+	case !contains(sig.signedHeaders, "host"):
+		return errInvalidArgument("host header must be signed")
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	date, err := time.Parse(amzDate, value)
+	if err == nil {
+		return date, nil
+	}
+
+	date, err = http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, errAccessDenied
+	}
+	return date, nil
+}
+
+func canonicalRequest(r *http.Request, sig signature) string {
+	var headers strings.Builder
+	for _, name := range sig.signedHeaders {
+		var value string
+		if name == "host" {
+			value = r.Host
+		} else {
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values) string {
+	var params [][2]string
+	for k, values := range query {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			params = append(params, [2]string{uriEncode(k, true), uriEncode(v, true)})
+		}
+	}
+
+	// Sorted by key, then value
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	encoded := make([]string, 0, len(params))
+	for _, p := range params {
+		encoded = append(encoded, p[0]+"="+p[1])
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode escapes everything except the unreserved characters of RFC 3986,
+// as required by SigV4.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func deriveKey(secret string, scope string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexHMAC(key []byte, data string) string {
+	return hex.EncodeToString(hmacSHA256(key, data))
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPayload replaces the request body with a reader that checks the
+// payload against the signed hash.
+func (s *Server) verifyPayload(r *http.Request, sig signature, signingKey []byte) error {
+	switch sig.payloadHash {
+	case unsignedPayload:
+		return nil
+	case streamingPayload, streamingUnsignedTrailer:
+		size, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			return errInvalidArgument("missing x-amz-decoded-content-length")
+		}
+
+		cr := &chunkedReader{r: bufio.NewReader(r.Body), previous: sig.signature, trailer: sig.payloadHash == streamingUnsignedTrailer}
+		if !cr.trailer {
+			cr.key = signingKey
+			cr.prefix = "AWS4-HMAC-SHA256-PAYLOAD\n" + sig.date.Format(amzDate) + "\n" + sig.scope + "\n"
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{cr, r.Body}
+		r.ContentLength = size
+		return nil
+	default:
+		want, err := hex.DecodeString(sig.payloadHash)
+		if err != nil || len(want) != sha256.Size {
+			return errInvalidArgument("invalid x-amz-content-sha256")
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{&hashReader{r: r.Body, hash: sha256.New(), want: want}, r.Body}
+		return nil
+	}
+}
+
+// hashReader fails at the end of the body if its hash doesn't match.
+type hashReader struct {
+	r    io.Reader
+	hash hash.Hash
+	want []byte
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) && !bytes.Equal(h.hash.Sum(nil), h.want) {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body. Each chunk is signed with the
+// signature of the previous one, starting with the signature of the request.
+// Unsigned bodies end with trailing headers, which are skipped.
+type chunkedReader struct {
+	r        *bufio.Reader
+	key      []byte
+	prefix   string
+	previous string
+	trailer  bool
+
+	chunk []byte
+	err   error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.err = c.next()
+	}
+
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+// next reads the next chunk. It returns io.EOF after the final chunk.
+func (c *chunkedReader) next() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeHex, chunkSignature, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return errIncompleteBody
+	}
+
+	chunk := make([]byte, size)
+	_, err = io.ReadFull(c.r, chunk)
+	if err != nil {
+		return errIncompleteBody
+	}
+
+	if c.key != nil {
+		chunkSignature, _ = strings.CutPrefix(chunkSignature, "chunk-signature=")
+		expected := hexHMAC(c.key, c.prefix+c.previous+"\n"+emptySHA256+"\n"+hexSHA256(chunk))
+		if !hmac.Equal([]byte(expected), []byte(chunkSignature)) {
+			return errSignatureDoesNotMatch
+		}
+		c.previous = chunkSignature
+	}
+
+	if size == 0 {
+		if c.trailer {
+			return c.skipTrailer()
+		}
+		return io.EOF
+	}
+
+	line, err = c.readLine()
+	if err != nil || line != "" {
+		return errIncompleteBody
+	}
+
+	c.chunk = chunk
+	return nil
+}
+
+func (c *chunkedReader) skipTrailer() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return io.EOF
+		}
+	}
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", errIncompleteBody
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
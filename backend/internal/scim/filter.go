@@ -0,0 +1,64 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// Filter is a parsed SCIM filter expression. Only the equality operator on a
+// single attribute is supported, which is what identity providers use to
+// look up existing resources (e.g. `userName eq "jane@example.org"`).
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+func errInvalidFilter(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidFilter", Detail: detail}
+}
+
+// ParseFilter parses a filter of the form `attribute eq "value"`. An empty
+// filter returns nil.
+func ParseFilter(filter string) (*Filter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, nil
+	}
+
+	attribute, rest, ok := strings.Cut(filter, " ")
+	if !ok {
+		return nil, errInvalidFilter("filter must have the form `attribute eq \"value\"`")
+	}
+
+	op, value, ok := strings.Cut(strings.TrimSpace(rest), " ")
+	if !ok || !strings.EqualFold(op, "eq") {
+		return nil, errInvalidFilter("only the eq operator is supported")
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return nil, errInvalidFilter("filter value must be a quoted string")
+	}
+	value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+
+	return &Filter{Attribute: attribute, Value: value}, nil
+}
+
+// Where returns the condition for the filter. columns maps SCIM attribute
+// names (compared case-insensitively) to database columns, attributes in
+// caseInsensitive are compared ignoring case.
+func (f *Filter) Where(columns map[string]string, caseInsensitive map[string]bool) (squirrel.Sqlizer, error) {
+	for attribute, column := range columns {
+		if !strings.EqualFold(attribute, f.Attribute) {
+			continue
+		}
+		if caseInsensitive[attribute] {
+			return squirrel.Expr("LOWER("+column+") = LOWER(?)", f.Value), nil
+		}
+		return squirrel.Eq{column: f.Value}, nil
+	}
+
+	return nil, errInvalidFilter("filtering on " + f.Attribute + " is not supported")
+}
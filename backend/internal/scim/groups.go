@@ -0,0 +1,398 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/database"
+	"example/internal/database/db"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type GroupResource struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+func toGroupResource(group db.Group, members []db.User) GroupResource {
+	res := GroupResource{
+		Schemas:     []string{SchemaGroup},
+		ID:          group.ID,
+		ExternalID:  group.ExternalID.String,
+		DisplayName: group.Name,
+		Members:     make([]Member, 0, len(members)),
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt.Format(time.RFC3339),
+			Location:     basePath + "/Groups/" + group.ID,
+		},
+	}
+
+	for _, member := range members {
+		res.Members = append(res.Members, Member{
+			Value:   member.ID,
+			Display: member.Email,
+			Ref:     basePath + "/Users/" + member.ID,
+		})
+	}
+
+	return res
+}
+
+var groupColumns = map[string]string{
+	"displayName": "name",
+	"externalId":  "external_id",
+}
+
+var groupCaseInsensitive = map[string]bool{
+	"displayName": true,
+}
+
+func (s *Server) listGroups(ctx context.Context, r *http.Request) (int, any, error) {
+	filter, err := ParseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	startIndex, count := pagination(r)
+
+	// Identity providers exclude members when they only look up a group
+	excludeMembers := strings.Contains(r.URL.Query().Get("excludedAttributes"), "members")
+
+	inOrganisation := squirrel.Eq{"organisation_id": organisationID(ctx), "deleted_at": nil}
+	query := s.DB.NewQueryBuilder().Select("*").From("groups").Where(inOrganisation)
+	countQuery := s.DB.NewQueryBuilder().Select("COUNT(*) AS count").From("groups").Where(inOrganisation)
+
+	if filter != nil {
+		cond, err := filter.Where(groupColumns, groupCaseInsensitive)
+		if err != nil {
+			return 0, nil, err
+		}
+		query = query.Where(cond)
+		countQuery = countQuery.Where(cond)
+	}
+
+	total, err := database.ScanSelectOne[countRow](s.DB, ctx, countQuery)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	groups, err := database.ScanSelectMany[db.Group](s.DB, ctx, query.
+		OrderBy("created_at", "id").
+		Offset(uint64(startIndex-1)).
+		Limit(uint64(count)))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp := ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total.Count,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    make([]any, 0, len(groups)),
+	}
+	for _, group := range groups {
+		var members []db.User
+		if !excludeMembers {
+			members, err = s.DB.GroupMemberFindAll(ctx, group.ID)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		resp.Resources = append(resp.Resources, toGroupResource(group, members))
+	}
+
+	return http.StatusOK, resp, nil
+}
+
+func (s *Server) getGroup(ctx context.Context, r *http.Request) (int, any, error) {
+	group, err := s.DB.GroupFindByID(ctx, db.GroupFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	return s.groupResponse(ctx, http.StatusOK, group)
+}
+
+func (s *Server) createGroup(ctx context.Context, r *http.Request) (int, any, error) {
+	var res GroupResource
+	err := decode(r, &res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if res.DisplayName == "" {
+		return 0, nil, errInvalidValue("displayName is required")
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	group, err := qtx.GroupCreate(ctx, db.GroupCreateParams{
+		Name:           res.DisplayName,
+		ExternalID:     pgtype.Text{String: res.ExternalID, Valid: res.ExternalID != ""},
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	err = addMembers(ctx, qtx, group, res.Members)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return s.groupResponse(ctx, http.StatusCreated, group)
+}
+
+func (s *Server) replaceGroup(ctx context.Context, r *http.Request) (int, any, error) {
+	var res GroupResource
+	err := decode(r, &res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if res.DisplayName == "" {
+		return 0, nil, errInvalidValue("displayName is required")
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	group, err := qtx.GroupUpdate(ctx, db.GroupUpdateParams{
+		Name:           res.DisplayName,
+		ExternalID:     pgtype.Text{String: res.ExternalID, Valid: res.ExternalID != ""},
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	err = qtx.GroupMemberRemoveAll(ctx, group.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = addMembers(ctx, qtx, group, res.Members)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return s.groupResponse(ctx, http.StatusOK, group)
+}
+
+func (s *Server) patchGroup(ctx context.Context, r *http.Request) (int, any, error) {
+	var patch PatchRequest
+	err := decode(r, &patch)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tx, err := s.DB.DB.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.DB.WithTx(tx)
+
+	group, err := qtx.GroupFindByID(ctx, db.GroupFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	for _, operation := range patch.Operations {
+		group, err = applyGroupOperation(ctx, qtx, group, operation)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return s.groupResponse(ctx, http.StatusOK, group)
+}
+
+func (s *Server) deleteGroup(ctx context.Context, r *http.Request) (int, any, error) {
+	group, err := s.DB.GroupFindByID(ctx, db.GroupFindByIDParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	err = s.DB.GroupSoftDelete(ctx, db.GroupSoftDeleteParams{
+		ID:             group.ID,
+		OrganisationID: group.OrganisationID,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) groupResponse(ctx context.Context, status int, group db.Group) (int, any, error) {
+	members, err := s.DB.GroupMemberFindAll(ctx, group.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return status, toGroupResource(group, members), nil
+}
+
+// addMembers adds the members to the group. Users of other organisations are
+// silently skipped by the query.
+func addMembers(ctx context.Context, q *db.Queries, group db.Group, members []Member) error {
+	for _, member := range members {
+		err := q.GroupMemberAdd(ctx, db.GroupMemberAddParams{
+			GroupID:        group.ID,
+			UserID:         member.Value,
+			OrganisationID: group.OrganisationID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyGroupOperation(ctx context.Context, q *db.Queries, group db.Group, operation PatchOperation) (db.Group, error) {
+	op, err := operation.op()
+	if err != nil {
+		return group, err
+	}
+
+	attribute, memberID, hasFilter := valueFilter(operation.Path)
+
+	switch strings.ToLower(attribute) {
+	case "members":
+		var members []Member
+		if len(operation.Value) > 0 {
+			err = json.Unmarshal(operation.Value, &members)
+			if err != nil {
+				return group, errInvalidValue("expected a list of members")
+			}
+		}
+
+		switch {
+		case op == "remove" && hasFilter:
+			return group, q.GroupMemberRemove(ctx, db.GroupMemberRemoveParams{GroupID: group.ID, UserID: memberID})
+		case op == "remove" && len(members) == 0:
+			return group, q.GroupMemberRemoveAll(ctx, group.ID)
+		case op == "remove":
+			for _, member := range members {
+				err = q.GroupMemberRemove(ctx, db.GroupMemberRemoveParams{GroupID: group.ID, UserID: member.Value})
+				if err != nil {
+					return group, err
+				}
+			}
+			return group, nil
+		case op == "replace":
+			err = q.GroupMemberRemoveAll(ctx, group.ID)
+			if err != nil {
+				return group, err
+			}
+		}
+
+		return group, addMembers(ctx, q, group, members)
+	case "displayname", "externalid":
+		if op == "remove" {
+			if strings.EqualFold(attribute, "displayName") {
+				return group, errInvalidValue("displayName is required")
+			}
+			group.ExternalID = pgtype.Text{}
+			return updateGroup(ctx, q, group)
+		}
+
+		value, err := parseString(operation.Value)
+		if err != nil {
+			return group, err
+		}
+		if strings.EqualFold(attribute, "displayName") {
+			group.Name = value
+		} else {
+			group.ExternalID = pgtype.Text{String: value, Valid: value != ""}
+		}
+		return updateGroup(ctx, q, group)
+	case "":
+		if op == "remove" {
+			return group, errInvalidPath("remove requires a path")
+		}
+
+		var attributes map[string]json.RawMessage
+		err = json.Unmarshal(operation.Value, &attributes)
+		if err != nil {
+			return group, errInvalidValue("expected an object value")
+		}
+
+		for path, value := range attributes {
+			group, err = applyGroupOperation(ctx, q, group, PatchOperation{Op: op, Path: path, Value: value})
+			if err != nil {
+				return group, err
+			}
+		}
+		return group, nil
+	default:
+		return group, errInvalidPath("unsupported path " + operation.Path)
+	}
+}
+
+func updateGroup(ctx context.Context, q *db.Queries, group db.Group) (db.Group, error) {
+	updated, err := q.GroupUpdate(ctx, db.GroupUpdateParams{
+		Name:           group.Name,
+		ExternalID:     group.ExternalID,
+		ID:             group.ID,
+		OrganisationID: group.OrganisationID,
+	})
+	if err != nil {
+		return group, dbError(err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,84 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request as defined in RFC 7644
+// section 3.5.2.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// op returns the normalised operation name. Some identity providers send
+// them capitalised ("Replace").
+func (o PatchOperation) op() (string, error) {
+	op := strings.ToLower(o.Op)
+	switch op {
+	case "add", "replace", "remove":
+		return op, nil
+	default:
+		return "", errInvalidValue("unsupported patch operation " + o.Op)
+	}
+}
+
+func errInvalidPath(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidPath", Detail: detail}
+}
+
+// parseString decodes a JSON string value.
+func parseString(value json.RawMessage) (string, error) {
+	var s string
+	err := json.Unmarshal(value, &s)
+	if err != nil {
+		return "", errInvalidValue("expected a string value")
+	}
+	return s, nil
+}
+
+// parseBool decodes a JSON boolean. Strings like "False" are accepted as
+// well because Azure AD sends booleans as strings.
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	err := json.Unmarshal(value, &b)
+	if err == nil {
+		return b, nil
+	}
+
+	var s string
+	err = json.Unmarshal(value, &s)
+	if err != nil {
+		return false, errInvalidValue("expected a boolean value")
+	}
+
+	b, err = strconv.ParseBool(s)
+	if err != nil {
+		return false, errInvalidValue("expected a boolean value")
+	}
+	return b, nil
+}
+
+// valueFilter extracts the id from a path like `members[value eq "id"]`.
+func valueFilter(path string) (attribute string, value string, ok bool) {
+	attribute, rest, ok := strings.Cut(path, "[")
+	if !ok || !strings.HasSuffix(rest, "]") {
+		return path, "", false
+	}
+
+	filter, err := ParseFilter(strings.TrimSuffix(rest, "]"))
+	if err != nil || filter == nil || !strings.EqualFold(filter.Attribute, "value") {
+		return attribute, "", false
+	}
+
+	return attribute, filter.Value, true
+}
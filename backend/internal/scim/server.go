@@ -0,0 +1,273 @@
+// Package scim implements a SCIM 2.0 (RFC 7643/7644) service provider so that
+// identity providers can create, update and deprovision users and groups of an
+// organisation.
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	contentType = "application/scim+json"
+	basePath    = "/scim/v2"
+
+	// maxResults caps the page size a client can request.
+	maxResults = 200
+)
+
+type tokenKey struct{}
+
+type Server struct {
+	DB    *database.DB
+	Audit *audit.Log
+	mux   *http.ServeMux
+}
+
+func NewServer(db *database.DB, log *audit.Log) *Server {
+	s := &Server{DB: db, Audit: log, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET "+basePath+"/ServiceProviderConfig", s.wrap(s.serviceProviderConfig))
+
+	s.mux.HandleFunc("GET "+basePath+"/Users", s.wrap(s.listUsers))
+	s.mux.HandleFunc("POST "+basePath+"/Users", s.wrap(s.createUser))
+	s.mux.HandleFunc("GET "+basePath+"/Users/{id}", s.wrap(s.getUser))
+	s.mux.HandleFunc("PUT "+basePath+"/Users/{id}", s.wrap(s.replaceUser))
+	s.mux.HandleFunc("PATCH "+basePath+"/Users/{id}", s.wrap(s.patchUser))
+	s.mux.HandleFunc("DELETE "+basePath+"/Users/{id}", s.wrap(s.deleteUser))
+
+	s.mux.HandleFunc("GET "+basePath+"/Groups", s.wrap(s.listGroups))
+	s.mux.HandleFunc("POST "+basePath+"/Groups", s.wrap(s.createGroup))
+	s.mux.HandleFunc("GET "+basePath+"/Groups/{id}", s.wrap(s.getGroup))
+	s.mux.HandleFunc("PUT "+basePath+"/Groups/{id}", s.wrap(s.replaceGroup))
+	s.mux.HandleFunc("PATCH "+basePath+"/Groups/{id}", s.wrap(s.patchGroup))
+	s.mux.HandleFunc("DELETE "+basePath+"/Groups/{id}", s.wrap(s.deleteGroup))
+
+	return s
+}
+
+// ServeHTTP authenticates the organisation-scoped bearer token and dispatches
+// the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, &Error{Status: http.StatusUnauthorized, Detail: "missing bearer token"})
+		return
+	}
+
+	scimToken, err := s.DB.GLOBAL_ScimTokenFindByHash(ctx, middleware.HashToken(token))
+	if err != nil {
+		writeError(w, &Error{Status: http.StatusUnauthorized, Detail: "invalid bearer token"})
+		return
+	}
+
+	err = s.DB.ScimTokenTouch(ctx, scimToken.ID)
+	if err != nil {
+		slog.Error("error updating scim token", "err", err)
+	}
+
+	ctx = context.WithValue(ctx, tokenKey{}, scimToken)
+	s.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func organisationID(ctx context.Context) string {
+	return ctx.Value(tokenKey{}).(db.ScimToken).OrganisationID
+}
+
+// record appends an event of a change to a user to the audit log. The
+// identity provider isn't a user, the event names the token it used
+// instead.
+func (s *Server) record(ctx context.Context, e audit.Event) {
+	token := ctx.Value(tokenKey{}).(db.ScimToken)
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.Details["scim_token_id"] = token.ID
+	e.Details["scim_token_name"] = token.Name
+
+	s.Audit.RecordWithoutActor(ctx, token.OrganisationID, e)
+}
+
+// Error is a SCIM error response as defined in RFC 7644 section 3.12.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	})
+}
+
+var (
+	errNotFound = &Error{Status: http.StatusNotFound, Detail: "resource not found"}
+	errConflict = &Error{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "resource already exists"}
+)
+
+func errInvalidValue(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: detail}
+}
+
+// dbError maps database errors to SCIM errors.
+func dbError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return errNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return errConflict
+	default:
+		return err
+	}
+}
+
+type handlerFunc func(ctx context.Context, r *http.Request) (int, any, error)
+
+// wrap is a helper function that writes SCIM responses and errors.
+func (s *Server) wrap(handler handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, res, err := handler(r.Context(), r)
+
+		var scimErr *Error
+		switch {
+		case errors.As(err, &scimErr):
+			writeError(w, scimErr)
+		case err != nil:
+			slog.Error("error handling scim request", "err", err)
+			writeError(w, &Error{Status: http.StatusInternalServerError, Detail: "internal server error"})
+		case res == nil:
+			w.WriteHeader(status)
+		default:
+			body, err := json.Marshal(res)
+			if err != nil {
+				slog.Error("error encoding scim response", "err", err)
+				writeError(w, &Error{Status: http.StatusInternalServerError, Detail: "internal server error"})
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(status)
+			_, _ = w.Write(body)
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	body, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(e.Status)
+	_, _ = w.Write(body)
+}
+
+func decode(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return &Error{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()}
+	}
+	return nil
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// pagination reads the 1-based startIndex and count query parameters.
+func pagination(r *http.Request) (startIndex int, count int) {
+	startIndex, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err = strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count > maxResults {
+		count = maxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	return startIndex, count
+}
+
+func (s *Server) serviceProviderConfig(ctx context.Context, r *http.Request) (int, any, error) {
+	type supported struct {
+		Supported bool `json:"supported"`
+	}
+	type filter struct {
+		Supported  bool `json:"supported"`
+		MaxResults int  `json:"maxResults"`
+	}
+	type authScheme struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	return http.StatusOK, struct {
+		Schemas               []string     `json:"schemas"`
+		Patch                 supported    `json:"patch"`
+		Bulk                  supported    `json:"bulk"`
+		Filter                filter       `json:"filter"`
+		ChangePassword        supported    `json:"changePassword"`
+		Sort                  supported    `json:"sort"`
+		Etag                  supported    `json:"etag"`
+		AuthenticationSchemes []authScheme `json:"authenticationSchemes"`
+	}{
+		Schemas:        []string{SchemaServiceProviderConfig},
+		Patch:          supported{true},
+		Bulk:           supported{false},
+		Filter:         filter{Supported: true, MaxResults: maxResults},
+		ChangePassword: supported{false},
+		Sort:           supported{false},
+		Etag:           supported{false},
+		AuthenticationSchemes: []authScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer Token",
+			Description: "Organisation scoped SCIM token",
+		}},
+	}, nil
+}
@@ -0,0 +1,506 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"example/internal/audit"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/webhook"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Name struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Role is a value of the roles attribute of a user, which is admin or user.
+// Owners are shown as owner, but can't be made owner through SCIM.
+type Role struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type UserResource struct {
+	Schemas    []string `json:"schemas"`
+	ID         string   `json:"id,omitempty"`
+	ExternalID string   `json:"externalId,omitempty"`
+	UserName   string   `json:"userName"`
+	Name       Name     `json:"name"`
+	Emails     []Email  `json:"emails,omitempty"`
+	Roles      []Role   `json:"roles,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+	Meta       *Meta    `json:"meta,omitempty"`
+}
+
+func toUserResource(user db.User) UserResource {
+	active := !user.DeletedAt.Valid
+
+	return UserResource{
+		Schemas:    []string{SchemaUser},
+		ID:         user.ID,
+		ExternalID: user.ExternalID.String,
+		UserName:   user.Email,
+		Name: Name{
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		Emails: []Email{{Value: user.Email, Type: "work", Primary: true}},
+		Roles:  []Role{{Value: string(user.Role), Primary: true}},
+		Active: &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.Format(time.RFC3339),
+			Location:     basePath + "/Users/" + user.ID,
+		},
+	}
+}
+
+// userColumns maps the filterable SCIM attributes to columns of the users
+// table.
+var userColumns = map[string]string{
+	"userName":     "email",
+	"emails.value": "email",
+	"externalId":   "external_id",
+}
+
+var userCaseInsensitive = map[string]bool{
+	"userName":     true,
+	"emails.value": true,
+}
+
+type countRow struct {
+	Count int64 `db:"count"`
+}
+
+func (s *Server) listUsers(ctx context.Context, r *http.Request) (int, any, error) {
+	filter, err := ParseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	startIndex, count := pagination(r)
+
+	inOrganisation := squirrel.Eq{"organisation_id": organisationID(ctx)}
+	query := s.DB.NewQueryBuilder().Select("*").From("users").Where(inOrganisation)
+	countQuery := s.DB.NewQueryBuilder().Select("COUNT(*) AS count").From("users").Where(inOrganisation)
+
+	if filter != nil {
+		cond, err := filter.Where(userColumns, userCaseInsensitive)
+		if err != nil {
+			return 0, nil, err
+		}
+		query = query.Where(cond)
+		countQuery = countQuery.Where(cond)
+	}
+
+	total, err := database.ScanSelectOne[countRow](s.DB, ctx, countQuery)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	users, err := database.ScanSelectMany[db.User](s.DB, ctx, query.
+		OrderBy("created_at", "id").
+		Offset(uint64(startIndex-1)).
+		Limit(uint64(count)))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp := ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total.Count,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    make([]any, 0, len(users)),
+	}
+	for _, user := range users {
+		resp.Resources = append(resp.Resources, toUserResource(user))
+	}
+
+	return http.StatusOK, resp, nil
+}
+
+func (s *Server) getUser(ctx context.Context, r *http.Request) (int, any, error) {
+	user, err := s.DB.UserFindIncludingArchived(ctx, db.UserFindIncludingArchivedParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	return http.StatusOK, toUserResource(user), nil
+}
+
+func (s *Server) createUser(ctx context.Context, r *http.Request) (int, any, error) {
+	var res UserResource
+	err := decode(r, &res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if res.UserName == "" {
+		return 0, nil, errInvalidValue("userName is required")
+	}
+
+	// Checked before the user exists, so a failure doesn't leave it behind
+	role, err := parseRoles(res.Roles)
+	if err != nil {
+		return 0, nil, err
+	}
+	if role == db.UserRoleOwner {
+		return 0, nil, errInvalidValue("owners can't be provisioned")
+	}
+
+	user, err := s.DB.UserProvision(ctx, db.UserProvisionParams{
+		Email:          res.UserName,
+		FirstName:      res.Name.GivenName,
+		LastName:       res.Name.FamilyName,
+		OrganisationID: organisationID(ctx),
+		ExternalID:     pgtype.Text{String: res.ExternalID, Valid: res.ExternalID != ""},
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	s.record(ctx, audit.UserEvent(audit.ActionUserCreate, user))
+
+	if res.Roles != nil {
+		user, err = s.setRole(ctx, user, res.Roles)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if res.Active != nil && !*res.Active {
+		user, err = s.setActive(ctx, user, false)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// The user exists already, a failure must not make the client retry
+	err = webhook.Enqueue(ctx, s.DB.Queries, user.OrganisationID, webhook.EventUserInvited, webhook.NewUserData(user))
+	if err != nil {
+		slog.Error("error queueing webhooks", "user", user.ID, "err", err)
+	}
+
+	return http.StatusCreated, toUserResource(user), nil
+}
+
+func (s *Server) replaceUser(ctx context.Context, r *http.Request) (int, any, error) {
+	user, err := s.DB.UserFindIncludingArchived(ctx, db.UserFindIncludingArchivedParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	var res UserResource
+	err = decode(r, &res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	user, err = s.saveUser(ctx, user, res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, toUserResource(user), nil
+}
+
+func (s *Server) patchUser(ctx context.Context, r *http.Request) (int, any, error) {
+	user, err := s.DB.UserFindIncludingArchived(ctx, db.UserFindIncludingArchivedParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	var patch PatchRequest
+	err = decode(r, &patch)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	res := toUserResource(user)
+	for _, operation := range patch.Operations {
+		err = applyUserOperation(&res, operation)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	user, err = s.saveUser(ctx, user, res)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, toUserResource(user), nil
+}
+
+// deleteUser deprovisions the user. Users are archived rather than deleted
+// so that their files and the audit trail stay intact.
+func (s *Server) deleteUser(ctx context.Context, r *http.Request) (int, any, error) {
+	user, err := s.DB.UserFindIncludingArchived(ctx, db.UserFindIncludingArchivedParams{
+		ID:             r.PathValue("id"),
+		OrganisationID: organisationID(ctx),
+	})
+	if err != nil {
+		return 0, nil, dbError(err)
+	}
+
+	_, err = s.setActive(ctx, user, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+// saveUser writes the attributes of res to the user.
+func (s *Server) saveUser(ctx context.Context, user db.User, res UserResource) (db.User, error) {
+	if res.UserName == "" {
+		return user, errInvalidValue("userName is required")
+	}
+
+	updated, err := s.DB.UserUpdateProfile(ctx, db.UserUpdateProfileParams{
+		Email:          res.UserName,
+		FirstName:      res.Name.GivenName,
+		LastName:       res.Name.FamilyName,
+		ExternalID:     pgtype.Text{String: res.ExternalID, Valid: res.ExternalID != ""},
+		ID:             user.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return user, dbError(err)
+	}
+
+	changes := profileChanges(user, updated)
+	if len(changes) > 0 {
+		e := audit.UserEvent(audit.ActionUserUpdate, updated)
+		e.Details = changes
+		s.record(ctx, e)
+	}
+
+	// Without roles the user keeps the role they have
+	if res.Roles != nil {
+		updated, err = s.setRole(ctx, updated, res.Roles)
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	if res.Active != nil {
+		return s.setActive(ctx, updated, *res.Active)
+	}
+
+	return updated, nil
+}
+
+// profileChanges returns the new values of the attributes that differ
+// between before and after.
+func profileChanges(before db.User, after db.User) map[string]string {
+	changes := map[string]string{}
+	if before.Email != after.Email {
+		changes["email"] = after.Email
+	}
+	if before.FirstName != after.FirstName {
+		changes["first_name"] = after.FirstName
+	}
+	if before.LastName != after.LastName {
+		changes["last_name"] = after.LastName
+	}
+	if before.ExternalID != after.ExternalID {
+		changes["external_id"] = after.ExternalID.String
+	}
+	return changes
+}
+
+// parseRoles returns owner if one of roles is owner, admin if one is admin,
+// otherwise user.
+func parseRoles(roles []Role) (db.UserRole, error) {
+	role := db.UserRoleUser
+	for _, r := range roles {
+		switch db.UserRole(strings.ToLower(r.Value)) {
+		case db.UserRoleOwner:
+			return db.UserRoleOwner, nil
+		case db.UserRoleAdmin:
+			role = db.UserRoleAdmin
+		case db.UserRoleUser:
+		default:
+			return "", errInvalidValue("unknown role " + r.Value)
+		}
+	}
+	return role, nil
+}
+
+// setRole changes the role of the user to the one of roles. Owners keep their
+// role, and nobody is made owner.
+func (s *Server) setRole(ctx context.Context, user db.User, roles []Role) (db.User, error) {
+	role, err := parseRoles(roles)
+	if err != nil {
+		return user, err
+	}
+	if role == db.UserRoleOwner && user.Role != db.UserRoleOwner {
+		return user, errInvalidValue("owners can't be provisioned")
+	}
+	if user.Role == db.UserRoleOwner || user.Role == role {
+		return user, nil
+	}
+
+	updated, err := s.DB.UserUpdateRole(ctx, db.UserUpdateRoleParams{
+		Role:           role,
+		ID:             user.ID,
+		OrganisationID: user.OrganisationID,
+	})
+	if err != nil {
+		return user, dbError(err)
+	}
+
+	s.record(ctx, audit.RoleChangeEvent(user, updated))
+	return updated, nil
+}
+
+// setActive archives or restores the user. Archiving revokes all sessions of
+// the user in the same transaction.
+func (s *Server) setActive(ctx context.Context, user db.User, active bool) (db.User, error) {
+	archived := user.DeletedAt.Valid
+	params := db.UserArchiveParams{ID: user.ID, OrganisationID: user.OrganisationID}
+
+	switch {
+	case active && archived:
+		err := s.DB.UserRestore(ctx, db.UserRestoreParams(params))
+		if err != nil {
+			return user, err
+		}
+
+		s.record(ctx, audit.UserEvent(audit.ActionUserReactivate, user))
+	case !active:
+		tx, err := s.DB.DB.Begin(ctx)
+		if err != nil {
+			return user, err
+		}
+		defer tx.Rollback(ctx)
+
+		qtx := s.DB.WithTx(tx)
+
+		err = qtx.UserArchive(ctx, params)
+		if err != nil {
+			return user, err
+		}
+
+		err = qtx.RemoveAllSessions(ctx, user.ID)
+		if err != nil {
+			return user, err
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return user, err
+		}
+
+		// Deprovisioning an archived user again only revokes sessions
+		if !archived {
+			s.record(ctx, audit.UserEvent(audit.ActionUserDeactivate, user))
+		}
+	default:
+		return user, nil
+	}
+
+	return s.DB.UserFindIncludingArchived(ctx, db.UserFindIncludingArchivedParams(params))
+}
+
+// applyUserOperation applies a single PATCH operation to the resource.
+// Attributes we don't store are ignored so that identity providers sending
+// their full attribute set don't fail.
+func applyUserOperation(res *UserResource, operation PatchOperation) error {
+	op, err := operation.op()
+	if err != nil {
+		return err
+	}
+
+	if op == "remove" {
+		switch strings.ToLower(operation.Path) {
+		case "":
+			return errInvalidPath("remove requires a path")
+		case "externalid":
+			res.ExternalID = ""
+		case "name.givenname":
+			res.Name.GivenName = ""
+		case "name.familyname":
+			res.Name.FamilyName = ""
+		case "roles":
+			res.Roles = []Role{}
+		}
+		return nil
+	}
+
+	if operation.Path == "" {
+		var attributes map[string]json.RawMessage
+		err = json.Unmarshal(operation.Value, &attributes)
+		if err != nil {
+			return errInvalidValue("expected an object value")
+		}
+
+		for path, value := range attributes {
+			err = setUserAttribute(res, path, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return setUserAttribute(res, operation.Path, operation.Value)
+}
+
+func setUserAttribute(res *UserResource, path string, value json.RawMessage) error {
+	var err error
+
+	switch strings.ToLower(strings.TrimPrefix(path, SchemaUser+":")) {
+	case "username":
+		res.UserName, err = parseString(value)
+	case "externalid":
+		res.ExternalID, err = parseString(value)
+	case "name.givenname":
+		res.Name.GivenName, err = parseString(value)
+	case "name.familyname":
+		res.Name.FamilyName, err = parseString(value)
+	case "name":
+		err = json.Unmarshal(value, &res.Name)
+		if err != nil {
+			err = errInvalidValue("expected a name object")
+		}
+	case "roles":
+		var roles []Role
+		err = json.Unmarshal(value, &roles)
+		if err != nil {
+			return errInvalidValue("expected a list of roles")
+		}
+		res.Roles = roles
+	case "active":
+		var active bool
+		active, err = parseBool(value)
+		res.Active = &active
+	}
+
+	return err
+}
@@ -1,16 +1,50 @@
+// Package mail sends emails through an outbox. Emails are written to the
+// emails table in the transaction of the change that sends them, together
+// with a SendJob that delivers them and retries failed attempts with backoff.
 package mail
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"example/internal/jobs"
 	"fmt"
 	"log/slog"
-	"net/smtp"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// MaxAttempts is the number of attempts before an email fails.
+	MaxAttempts = 8
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+
+	TemplateLoginLink = "login_link"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Delivery is the payload of SendJob.
+type Delivery struct {
+	EmailID string `json:"email_id"`
+}
+
+// SendJob delivers an email of the outbox, see Mailer.Deliver.
+var SendJob = jobs.Kind[Delivery]{Name: "mail.send", MaxAttempts: MaxAttempts, Concurrency: 4, Timeout: time.Minute}
+
 type Mailer struct {
-	auth smtp.Auth
-	cfg  Config
+	DB        *database.DB
+	Transport Transport
+	cfg       Config
 }
 
 type Config struct {
@@ -19,9 +53,13 @@ type Config struct {
 	Username    string `env:"SMTP_USERNAME"`
 	Password    string `env:"SMTP_PASSWORD"`
 	FrontendURL string `env:"FRONTEND_URL"`
+	// Transport is smtp, file or console.
+	Transport string `env:"MAIL_TRANSPORT"`
+	// Dir is where the file transport writes emails.
+	Dir string `env:"MAIL_DIR"`
 }
 
-func NewClient() Mailer {
+func NewClient(conn *database.DB) (Mailer, error) {
 	mailPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
 
 	cfg := Config{
@@ -30,40 +68,163 @@ func NewClient() Mailer {
 		Username:    os.Getenv("SMTP_USERNAME"),
 		Password:    os.Getenv("SMTP_PASSWORD"),
 		FrontendURL: os.Getenv("FRONTEND_URL"),
+		Transport:   os.Getenv("MAIL_TRANSPORT"),
+		Dir:         os.Getenv("MAIL_DIR"),
+	}
+
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return Mailer{}, err
 	}
 
-	auth := smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
-	return Mailer{auth: auth, cfg: cfg}
+	return Mailer{DB: conn, Transport: transport, cfg: cfg}, nil
 }
 
-func (m Mailer) Send(to []string, subject string, message string) error {
-	msg := []byte(
-		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\r\n" +
-			"From: Dokedu Support <support@dokedu.org>\r\n" +
-			"To: " + to[0] + "\r\n" +
-			"Subject: " + subject + "\r\n" +
-			"\r\n" +
-			message + "\r\n")
-
-	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
-	err := smtp.SendMail(addr, m.auth, "support@dokedu.org", to, msg)
+// Send writes an email to the outbox. It is called with the transaction of
+// the change the email belongs to, the email is sent once it commits.
+func (m Mailer) Send(ctx context.Context, q *db.Queries, organisationID string, template string, to string, subject string, body string) (db.Email, error) {
+	email, err := q.EmailCreate(ctx, db.EmailCreateParams{
+		OrganisationID: organisationID,
+		Template:       template,
+		ToAddress:      to,
+		Subject:        subject,
+		Body:           body,
+	})
 	if err != nil {
-		slog.Error("error while trying to send email", "err", err)
-		return err
+		return db.Email{}, err
 	}
 
-	return nil
+	err = SendJob.Enqueue(ctx, q, organisationID, Delivery{EmailID: email.ID})
+	if err != nil {
+		return db.Email{}, err
+	}
+
+	return email, nil
 }
 
-func (m Mailer) SendToken(to string, name string, token string) error {
+// SendToken writes the email with the login link of the user to the outbox.
+func (m Mailer) SendToken(ctx context.Context, q *db.Queries, user db.User, token string) error {
 	link := fmt.Sprintf("%s/login#token=%s", m.cfg.FrontendURL, token)
 	subject := "Dokedu Drive Login Link"
 
-	template, err := LoginLinkMailTemplate(name, link)
+	template, err := LoginLinkMailTemplate(user.FirstName, link)
 	if err != nil {
 		slog.Error("error while trying to generate password reset mail template", "err", err)
 		return err
 	}
 
-	return m.Send([]string{to}, subject, template)
+	_, err = m.Send(ctx, q, user.OrganisationID, TemplateLoginLink, user.Email, subject, template)
+	return err
+}
+
+// Deliver runs SendJob. A failed attempt is returned to retry the job, until
+// the last one, after which the email failed.
+func (m Mailer) Deliver(ctx context.Context, d Delivery) error {
+	email, err := m.DB.EmailFindPending(ctx, d.EmailID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Sent already
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sendErr := m.Transport.Send(ctx, Message{
+		ID:      email.ID,
+		To:      email.ToAddress,
+		Subject: email.Subject,
+		Body:    email.Body,
+	})
+
+	params := db.EmailFinishParams{Status: db.EmailStatusSent, ID: email.ID}
+	if sendErr != nil {
+		params.Status = db.EmailStatusPending
+		params.Error = sendErr.Error()
+		if email.Attempts+1 >= MaxAttempts {
+			params.Status = db.EmailStatusFailed
+			slog.Error("error while trying to send email", "id", email.ID, "err", sendErr)
+		}
+	}
+
+	err = m.DB.EmailFinish(ctx, params)
+	if err != nil {
+		return err
+	}
+	if params.Status == db.EmailStatusPending {
+		return sendErr
+	}
+	return nil
+}
+
+// Filter selects emails. Empty fields match all emails.
+type Filter struct {
+	Status   db.EmailStatus
+	Template string
+}
+
+// cursor is the position after the last email of a page.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+}
+
+func (c cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Emails returns a page of the emails of an organisation matching the filter,
+// the latest first, and the cursor of the next page, which is empty on the
+// last page.
+func (m Mailer) Emails(ctx context.Context, organisationID string, f Filter, limit int, after string) ([]db.Email, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := m.DB.NewQueryBuilder().
+		Select("*").
+		From("emails").
+		Where(squirrel.Eq{"organisation_id": organisationID}).
+		OrderBy("created_at DESC", "id DESC")
+
+	if f.Status != "" {
+		query = query.Where(squirrel.Eq{"status": f.Status})
+	}
+	if f.Template != "" {
+		query = query.Where(squirrel.Eq{"template": f.Template})
+	}
+	if after != "" {
+		c, err := parseCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", c.CreatedAt, c.ID)
+	}
+
+	// One more row than fits tells if there is another page
+	emails, err := database.ScanSelectMany[db.Email](m.DB, ctx, query.Limit(uint64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(emails) <= limit {
+		return emails, "", nil
+	}
+
+	last := emails[limit-1]
+	return emails[:limit], cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String(), nil
 }
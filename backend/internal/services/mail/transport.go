@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"path/filepath"
+)
+
+const from = "support@dokedu.org"
+
+// Message is an email as the transports send it. ID is the one of the email
+// in the outbox.
+type Message struct {
+	ID      string
+	To      string
+	Subject string
+	// Body is HTML.
+	Body string
+}
+
+func (msg Message) bytes() []byte {
+	return []byte(
+		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\r\n" +
+			"From: Dokedu Support <" + from + ">\r\n" +
+			"To: " + msg.To + "\r\n" +
+			"Subject: " + msg.Subject + "\r\n" +
+			"\r\n" +
+			msg.Body + "\r\n")
+}
+
+// Transport delivers emails, MAIL_TRANSPORT selects one.
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPTransport sends emails to an SMTP server.
+type SMTPTransport struct {
+	Addr string
+	Auth smtp.Auth
+}
+
+func (t SMTPTransport) Send(_ context.Context, msg Message) error {
+	return smtp.SendMail(t.Addr, t.Auth, from, []string{msg.To}, msg.bytes())
+}
+
+// FileTransport writes every email to <id>.eml in Dir, for development and
+// tests.
+type FileTransport struct {
+	Dir string
+}
+
+func (t FileTransport) Send(_ context.Context, msg Message) error {
+	return os.WriteFile(filepath.Join(t.Dir, msg.ID+".eml"), msg.bytes(), 0o644)
+}
+
+// ConsoleTransport prints emails, for development.
+type ConsoleTransport struct {
+	Out io.Writer
+}
+
+func (t ConsoleTransport) Send(_ context.Context, msg Message) error {
+	_, err := fmt.Fprintf(t.Out, "----- email %s -----\n%s\n", msg.ID, msg.bytes())
+	return err
+}
+
+// newTransport returns the transport selected by cfg.Transport, SMTP if it is
+// empty. The file and console transports must be selected explicitly, since
+// they expose login links to whoever reads the files or the logs.
+func newTransport(cfg Config) (Transport, error) {
+	name := cfg.Transport
+	if name == "" {
+		name = "smtp"
+	}
+
+	switch name {
+	case "smtp":
+		if cfg.Host == "" {
+			return nil, errors.New("SMTP_HOST is required for the smtp mail transport")
+		}
+		return SMTPTransport{
+			Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Auth: smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host),
+		}, nil
+	case "file":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = "mails"
+		}
+		err := os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return nil, err
+		}
+		return FileTransport{Dir: dir}, nil
+	case "console":
+		return ConsoleTransport{Out: os.Stdout}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", name)
+	}
+}
@@ -0,0 +1,337 @@
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database/db"
+	"example/internal/drive"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// maxPending limits how much out of order data an upload buffers. Clients
+// send several write requests at once, which can arrive out of order.
+const maxPending = 64 << 20
+
+// fileSystem implements the sftp request handlers on top of the virtual tree
+// for one user.
+type fileSystem struct {
+	ctx   context.Context
+	drive *drive.Service
+	audit *audit.Log
+	user  *db.User
+}
+
+func newFileSystem(ctx context.Context, service *drive.Service, log *audit.Log, user *db.User) *fileSystem {
+	return &fileSystem{ctx: ctx, drive: service, audit: log, user: user}
+}
+
+func (fs *fileSystem) resolve(name string) (drive.Node, error) {
+	return fs.drive.Resolve(fs.ctx, fs.user, name)
+}
+
+func (fs *fileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	node, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	object, err := fs.drive.Open(fs.ctx, node)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	fs.audit.Record(fs.ctx, fs.user, audit.FileEvent(audit.ActionDownload, node.File))
+
+	// The request server closes the object once the handle is closed
+	return object, nil
+}
+
+// Filewrite streams the upload into the storage. Only whole files can be written,
+// resuming or appending is not supported.
+func (fs *fileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if r.Pflags().Append {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+
+	parent, err := fs.resolve(path.Dir(r.Filepath))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	name := path.Base(r.Filepath)
+	node, err := fs.drive.Child(fs.ctx, fs.user, parent, name)
+	switch {
+	case errors.Is(err, drive.ErrNotFound):
+	case err != nil:
+		return nil, statusError(err)
+	case node.IsDir():
+		return nil, sftp.ErrSSHFxFailure
+	case node.Role < drive.RoleManager:
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	pr, pw := io.Pipe()
+	w := &uploadWriter{pw: pw, pending: make(map[int64][]byte), done: make(chan error, 1)}
+
+	go func() {
+		file, err := fs.drive.Put(fs.ctx, fs.user, parent, name, pr, -1)
+		if err == nil {
+			fs.audit.Record(fs.ctx, fs.user, audit.FileEvent(audit.ActionUpload, file))
+		}
+		// Unblock the writer if the upload failed early
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (fs *fileSystem) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		// Permissions and times can't be changed, but clients set them
+		// after every upload
+		return nil
+	case "Mkdir":
+		parent, err := fs.resolve(path.Dir(r.Filepath))
+		if err != nil {
+			return statusError(err)
+		}
+
+		_, err = fs.drive.Mkdir(fs.ctx, fs.user, parent, path.Base(r.Filepath))
+		return statusError(err)
+	case "Rename":
+		node, err := fs.resolve(r.Filepath)
+		if err != nil {
+			return statusError(err)
+		}
+
+		parent, err := fs.resolve(path.Dir(r.Target))
+		if err != nil {
+			return statusError(err)
+		}
+
+		file, err := fs.drive.Move(fs.ctx, fs.user, node, parent, path.Base(r.Target))
+		if err != nil {
+			return statusError(err)
+		}
+
+		fs.audit.Record(fs.ctx, fs.user, audit.MoveEvent(node.File, file))
+		return nil
+	case "Remove":
+		node, err := fs.resolve(r.Filepath)
+		if err != nil {
+			return statusError(err)
+		}
+		if node.IsDir() {
+			return sftp.ErrSSHFxFailure
+		}
+
+		return fs.trash(node)
+	case "Rmdir":
+		node, err := fs.resolve(r.Filepath)
+		if err != nil {
+			return statusError(err)
+		}
+		if !node.IsDir() {
+			return sftp.ErrSSHFxFailure
+		}
+
+		children, err := fs.drive.List(fs.ctx, fs.user, node)
+		if err != nil {
+			return statusError(err)
+		}
+		if len(children) > 0 {
+			return sftp.ErrSSHFxFailure
+		}
+
+		return fs.trash(node)
+	default:
+		// Links aren't supported
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+func (fs *fileSystem) trash(node drive.Node) error {
+	err := fs.drive.Trash(fs.ctx, fs.user, node)
+	if err != nil {
+		return statusError(err)
+	}
+
+	fs.audit.Record(fs.ctx, fs.user, audit.FileEvent(audit.ActionDelete, node.File))
+	return nil
+}
+
+func (fs *fileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	node, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	switch r.Method {
+	case "List":
+		children, err := fs.drive.List(fs.ctx, fs.user, node)
+		if err != nil {
+			return nil, statusError(err)
+		}
+
+		infos := make(listerAt, 0, len(children))
+		for _, child := range children {
+			infos = append(infos, fileInfo{node: child})
+		}
+		return infos, nil
+	case "Stat":
+		return listerAt{fileInfo{node: node}}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// statusError translates drive errors into SFTP status codes. Other errors,
+// like an exceeded quota, are reported as failure with their message.
+func statusError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, drive.ErrNotFound):
+		return sftp.ErrSSHFxNoSuchFile
+	case errors.Is(err, drive.ErrForbidden):
+		return sftp.ErrSSHFxPermissionDenied
+	case errors.Is(err, drive.ErrExists), errors.Is(err, drive.ErrInvalid):
+		return sftp.ErrSSHFxFailure
+	default:
+		return err
+	}
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fileInfo implements os.FileInfo for a node.
+type fileInfo struct {
+	node drive.Node
+}
+
+func (fi fileInfo) Name() string {
+	return fi.node.Name
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.node.File.FileSize
+}
+
+func (fi fileInfo) Mode() os.FileMode {
+	mode := os.FileMode(0444)
+	if fi.node.Role >= drive.RoleManager {
+		mode |= 0200
+	}
+	if fi.node.IsDir() {
+		mode |= os.ModeDir | 0111
+	}
+	return mode
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	return fi.node.File.UpdatedAt
+}
+
+func (fi fileInfo) IsDir() bool {
+	return fi.node.IsDir()
+}
+
+func (fi fileInfo) Sys() any {
+	return nil
+}
+
+// uploadWriter passes the written data in order to the upload through a pipe.
+// Writes ahead of the current offset are buffered until the gap is filled.
+type uploadWriter struct {
+	mu           sync.Mutex
+	pw           *io.PipeWriter
+	offset       int64
+	pending      map[int64][]byte
+	pendingBytes int64
+	done         chan error
+}
+
+func (w *uploadWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case off < w.offset:
+		return 0, sftp.ErrSSHFxOpUnsupported
+	case off > w.offset:
+		if w.pendingBytes+int64(len(p)) > maxPending {
+			return 0, sftp.ErrSSHFxOpUnsupported
+		}
+		w.pending[off] = append([]byte(nil), p...)
+		w.pendingBytes += int64(len(p))
+		return len(p), nil
+	}
+
+	_, err := w.pw.Write(p)
+	if err != nil {
+		return 0, err
+	}
+	w.offset += int64(len(p))
+
+	// Flush buffered writes that are now in order
+	for {
+		data, ok := w.pending[w.offset]
+		if !ok {
+			return len(p), nil
+		}
+		delete(w.pending, w.offset)
+		w.pendingBytes -= int64(len(data))
+
+		_, err = w.pw.Write(data)
+		if err != nil {
+			return 0, err
+		}
+		w.offset += int64(len(data))
+	}
+}
+
+// Close finishes the upload and returns its result.
+func (w *uploadWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Data after a gap would be lost
+	if len(w.pending) > 0 {
+		w.pw.CloseWithError(sftp.ErrSSHFxFailure)
+		<-w.done
+		return sftp.ErrSSHFxFailure
+	}
+
+	err := w.pw.Close()
+	if err != nil {
+		return err
+	}
+
+	return statusError(<-w.done)
+}
+
+// TransferError aborts the upload if the connection is lost.
+func (w *uploadWriter) TransferError(err error) {
+	w.pw.CloseWithError(err)
+}
@@ -0,0 +1,221 @@
+// Package sftpd serves the virtual file tree over SFTP. Users authenticate
+// with the SSH public keys they registered in the app.
+package sftpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"example/internal/audit"
+	"example/internal/database"
+	"example/internal/drive"
+	"example/internal/middleware"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	userIDKey = "user-id"
+
+	defaultHostKeyFile = "sftp_host_key"
+)
+
+type Server struct {
+	DB    *database.DB
+	Drive *drive.Service
+	Audit *audit.Log
+
+	config *ssh.ServerConfig
+}
+
+// NewServer loads the host key from hostKeyFile, or sftp_host_key if it is
+// empty. If the file doesn't exist a new ed25519 key is generated and stored
+// there, so clients see the same host key after a restart.
+func NewServer(db *database.DB, drive *drive.Service, log *audit.Log, hostKeyFile string) (*Server, error) {
+	s := &Server{DB: db, Drive: drive, Audit: log}
+
+	if hostKeyFile == "" {
+		hostKeyFile = defaultHostKeyFile
+	}
+
+	hostKey, err := loadHostKey(hostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.config = &ssh.ServerConfig{PublicKeyCallback: s.authenticate}
+	s.config.AddHostKey(hostKey)
+
+	return s, nil
+}
+
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return generateHostKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+func generateHostKey(path string) (ssh.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("generated sftp host key", "path", path)
+	return ssh.NewSignerFromKey(key)
+}
+
+// authenticate accepts registered public keys. The user name has to be the
+// email address of the key's owner.
+func (s *Server) authenticate(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	ctx := context.Background()
+
+	sshKey, err := s.DB.GLOBAL_SshKeyFindByFingerprint(ctx, ssh.FingerprintSHA256(key))
+	if err != nil {
+		return nil, fmt.Errorf("unknown public key for %s", conn.User())
+	}
+
+	registered, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshKey.PublicKey))
+	if err != nil || !bytes.Equal(registered.Marshal(), key.Marshal()) {
+		return nil, fmt.Errorf("unknown public key for %s", conn.User())
+	}
+
+	user, err := s.DB.UserFindByID(ctx, sshKey.UserID)
+	if err != nil || !strings.EqualFold(user.Email, conn.User()) {
+		return nil, fmt.Errorf("unknown public key for %s", conn.User())
+	}
+
+	err = s.DB.SshKeyTouch(ctx, sshKey.ID)
+	if err != nil {
+		slog.Error("error updating ssh key", "err", err)
+	}
+
+	return &ssh.Permissions{Extensions: map[string]string{userIDKey: user.ID}}, nil
+}
+
+// ListenAndServe accepts SSH connections on addr.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		slog.Debug("sftp handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	defer sshConn.Close()
+
+	go ssh.DiscardRequests(requests)
+
+	ctx := middleware.WithClient(context.Background(), middleware.Client{
+		IP:        remoteIP(sshConn.RemoteAddr()),
+		UserAgent: string(sshConn.ClientVersion()),
+	})
+	user, err := s.DB.UserFindByID(ctx, sshConn.Permissions.Extensions[userIDKey])
+	if err != nil {
+		slog.Error("error loading sftp user", "err", err)
+		return
+	}
+
+	s.Audit.Record(ctx, &user, audit.Event{Action: audit.ActionLogin, Details: map[string]string{"protocol": "sftp"}})
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			slog.Error("error accepting sftp channel", "err", err)
+			return
+		}
+
+		go s.serveSession(channel, requests, newFileSystem(ctx, s.Drive, s.Audit, &user))
+	}
+}
+
+// remoteIP returns the IP address of addr without port.
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// serveSession only allows the sftp subsystem, there is no shell.
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request, fs *fileSystem) {
+	defer channel.Close()
+
+	started := false
+	for req := range requests {
+		// The payload is the subsystem name as SSH string
+		ok := !started && req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		if req.WantReply {
+			_ = req.Reply(ok, nil)
+		}
+		if !ok {
+			continue
+		}
+		started = true
+
+		go func() {
+			server := sftp.NewRequestServer(channel, sftp.Handlers{
+				FileGet:  fs,
+				FilePut:  fs,
+				FileCmd:  fs,
+				FileList: fs,
+			})
+
+			err := server.Serve()
+			if err != nil && !errors.Is(err, io.EOF) {
+				slog.Error("error serving sftp", "err", err)
+			}
+			_ = server.Close()
+			_ = channel.Close()
+		}()
+	}
+}
@@ -0,0 +1,525 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// encryptedChunkSize is the size of the plaintext chunks. Each chunk is
+	// sealed on its own, so ranges are read without decrypting the whole
+	// object.
+	encryptedChunkSize = 64 << 10
+	// sealedChunkSize is the stored size of a full chunk, including the GCM
+	// tag.
+	sealedChunkSize = encryptedChunkSize + 16
+	// encryptedHeaderSize is the magic followed by the ID of the data key.
+	encryptedHeaderSize = 8 + 16
+
+	// rotateBatchSize is the number of data keys re-wrapped per query.
+	rotateBatchSize = 1000
+)
+
+// encryptedMagic starts every encrypted object.
+var encryptedMagic = []byte("DRVENC\x00\x01")
+
+// Encrypted encrypts the objects of another driver with envelope
+// encryption. Every object gets its own data key for AES-256-GCM, which is
+// stored in the data_keys table, wrapped with the key encryption key of the
+// organisation. The ID of the data key is in the header of the object, so
+// copies share their key and objects written before encryption was enabled
+// are still read.
+//
+// List reports the stored sizes, which include the header and the GCM tags.
+// Reading the header of every listed object would be too slow.
+type Encrypted struct {
+	Storage
+	db        dataKeys
+	keyring   Keyring
+	presigner *presigner
+}
+
+// dataKeys are the queries of the data_keys table.
+type dataKeys interface {
+	DataKeyCreate(ctx context.Context, arg db.DataKeyCreateParams) error
+	DataKeyFind(ctx context.Context, id string) (db.DataKey, error)
+	DataKeyFindAfter(ctx context.Context, arg db.DataKeyFindAfterParams) ([]db.DataKey, error)
+	DataKeyRewrap(ctx context.Context, arg db.DataKeyRewrapParams) (int64, error)
+}
+
+// NewEncrypted encrypts the objects of s. Presigned URLs point to Handler
+// under baseURL and are signed with secret, as the URLs of s would return
+// the encrypted contents.
+func NewEncrypted(s Storage, db *database.DB, keyring Keyring, baseURL string, secret string) (*Encrypted, error) {
+	presigner, err := newPresigner(baseURL, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypted{Storage: s, db: db, keyring: keyring, presigner: presigner}, nil
+}
+
+// sealedSize returns the stored size of plaintext of size bytes. Empty objects
+// consist of a single empty chunk.
+func sealedSize(size int64) int64 {
+	chunks := max(1, (size+encryptedChunkSize-1)/encryptedChunkSize)
+	return encryptedHeaderSize + size + chunks*(sealedChunkSize-encryptedChunkSize)
+}
+
+// plainSize is the inverse of sealedSize.
+func plainSize(stored int64) (int64, error) {
+	body := stored - encryptedHeaderSize
+	chunks := (body + sealedChunkSize - 1) / sealedChunkSize
+	size := body - chunks*(sealedChunkSize-encryptedChunkSize)
+	if chunks < 1 || size < 0 {
+		return 0, errors.New("encrypted object is truncated")
+	}
+	return size, nil
+}
+
+// chunkNonce returns the nonce of a chunk. The last chunk is flagged, so
+// truncating an object at a chunk boundary is noticed.
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// newDataKey creates the data key for a new object and returns its header.
+func (e *Encrypted) newDataKey(ctx context.Context, organisationID string) ([]byte, cipher.AEAD, error) {
+	if organisationID == "" {
+		return nil, nil, errors.New("encrypted objects need an organisation")
+	}
+
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic)
+	_, err = rand.Read(header[len(encryptedMagic):])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kekID, wrapped, err := e.keyring.Wrap(ctx, organisationID, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = e.db.DataKeyCreate(ctx, db.DataKeyCreateParams{
+		ID:             hex.EncodeToString(header[len(encryptedMagic):]),
+		OrganisationID: organisationID,
+		KekID:          kekID,
+		WrappedKey:     wrapped,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	return header, aead, err
+}
+
+// dataKey looks up and unwraps the data key named in a header.
+func (e *Encrypted) dataKey(ctx context.Context, header []byte) (cipher.AEAD, error) {
+	key, err := e.db.DataKeyFind(ctx, hex.EncodeToString(header[len(encryptedMagic):]))
+	if err != nil {
+		return nil, fmt.Errorf("finding data key: %w", err)
+	}
+
+	dataKey, err := e.keyring.Unwrap(ctx, key.OrganisationID, key.KekID, key.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key %s: %w", key.ID, err)
+	}
+	return newGCM(dataKey)
+}
+
+// Put encrypts the object with a new data key of opts.OrganisationID.
+func (e *Encrypted) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	header, aead, err := e.newDataKey(ctx, opts.OrganisationID)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stored := int64(-1)
+	if size >= 0 {
+		// Like the drivers, ignore anything after size bytes
+		r = io.LimitReader(r, size)
+		stored = sealedSize(size)
+	}
+
+	er := &encryptingReader{r: r, aead: aead, header: header, out: header}
+	info, err := e.Storage.Put(ctx, key, er, stored, opts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info.Size = er.n
+	return info, nil
+}
+
+// Open decrypts the object if it starts with the header, otherwise it was
+// stored before encryption was enabled and is returned as is.
+func (e *Encrypted) Open(ctx context.Context, key string) (Object, error) {
+	object, err := e.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read instead of ReadAt, so the contents are fetched in the same
+	// request as the header
+	header := make([]byte, encryptedHeaderSize)
+	_, err = io.ReadFull(object, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		object.Close()
+		return nil, err
+	}
+
+	if err != nil || !bytes.Equal(header[:len(encryptedMagic)], encryptedMagic) {
+		_, err = object.Seek(0, io.SeekStart)
+		if err != nil {
+			object.Close()
+			return nil, err
+		}
+		return object, nil
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+
+	size, err := plainSize(info.Size)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+
+	aead, err := e.dataKey(ctx, header)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+
+	return &encryptedObject{
+		object: object,
+		aead:   aead,
+		header: header,
+		info:   info,
+		size:   size,
+		next:   0,
+		index:  -1,
+		sealed: make([]byte, sealedChunkSize),
+		chunk:  make([]byte, 0, encryptedChunkSize),
+	}, nil
+}
+
+// Stat reads the header to report the size of the plaintext.
+func (e *Encrypted) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	object, err := e.Open(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer object.Close()
+
+	return object.Stat()
+}
+
+// Compose decrypts the sources and encrypts them again with a new data key,
+// as the chunks are sealed with the key of their object. Unlike with MinIO
+// alone, the contents pass through the app.
+func (e *Encrypted) Compose(ctx context.Context, dst string, srcs []string, opts PutOptions) (ObjectInfo, error) {
+	readers := make([]io.Reader, 0, len(srcs))
+	var size int64
+
+	for _, src := range srcs {
+		object, err := e.Open(ctx, src)
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		defer object.Close()
+
+		info, err := object.Stat()
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+
+		readers = append(readers, object)
+		size += info.Size
+	}
+
+	return e.Put(ctx, dst, io.MultiReader(readers...), size, opts)
+}
+
+func (e *Encrypted) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return e.presigner.sign(key, expiry)
+}
+
+func (e *Encrypted) signer() *presigner {
+	return e.presigner
+}
+
+// Rotate re-wraps the data keys that aren't wrapped with the current key
+// encryption key of their organisation. The contents aren't touched. It
+// returns the number of re-wrapped keys.
+func (e *Encrypted) Rotate(ctx context.Context) (int, error) {
+	current := make(map[string]string)
+	rotated := 0
+	after := ""
+
+	for {
+		keys, err := e.db.DataKeyFindAfter(ctx, db.DataKeyFindAfterParams{
+			After:    after,
+			MaxCount: rotateBatchSize,
+		})
+		if err != nil {
+			return rotated, err
+		}
+
+		for _, key := range keys {
+			kekID, ok := current[key.OrganisationID]
+			if !ok {
+				kekID, err = e.keyring.Current(ctx, key.OrganisationID)
+				if err != nil {
+					return rotated, err
+				}
+				current[key.OrganisationID] = kekID
+			}
+			if key.KekID == kekID {
+				continue
+			}
+
+			dataKey, err := e.keyring.Unwrap(ctx, key.OrganisationID, key.KekID, key.WrappedKey)
+			if err != nil {
+				return rotated, fmt.Errorf("unwrapping data key %s: %w", key.ID, err)
+			}
+
+			kekID, wrapped, err := e.keyring.Wrap(ctx, key.OrganisationID, dataKey)
+			if err != nil {
+				return rotated, err
+			}
+
+			// Skipped if it was re-wrapped concurrently
+			n, err := e.db.DataKeyRewrap(ctx, db.DataKeyRewrapParams{
+				KekID:         kekID,
+				WrappedKey:    wrapped,
+				ID:            key.ID,
+				PreviousKekID: key.KekID,
+			})
+			if err != nil {
+				return rotated, err
+			}
+			rotated += int(n)
+		}
+
+		if len(keys) < rotateBatchSize {
+			return rotated, nil
+		}
+		after = keys[len(keys)-1].ID
+	}
+}
+
+// encryptingReader returns the header followed by the sealed chunks of r.
+type encryptingReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	// out is the remainder of the header or the current sealed chunk.
+	out   []byte
+	chunk []byte
+	// peek holds the first byte of the next chunk, read to find out whether
+	// the current chunk is the last one.
+	peek  []byte
+	index int64
+	done  bool
+	// n is the number of plaintext bytes read.
+	n int64
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	if len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+
+		err := e.seal()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+func (e *encryptingReader) seal() error {
+	if e.chunk == nil {
+		e.chunk = make([]byte, encryptedChunkSize, sealedChunkSize)
+	}
+
+	n := copy(e.chunk, e.peek)
+	e.peek = e.peek[:0]
+
+	m, err := io.ReadFull(e.r, e.chunk[n:])
+	n += m
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		e.done = true
+	case err != nil:
+		return err
+	default:
+		if e.peek == nil {
+			e.peek = make([]byte, 1)
+		}
+		e.peek = e.peek[:1]
+		_, err = io.ReadFull(e.r, e.peek)
+		if errors.Is(err, io.EOF) {
+			e.done = true
+			e.peek = e.peek[:0]
+		} else if err != nil {
+			return err
+		}
+	}
+
+	e.n += int64(n)
+	e.out = e.aead.Seal(e.chunk[:0], chunkNonce(e.index, e.done), e.chunk[:n], e.header)
+	e.index++
+	return nil
+}
+
+// encryptedObject decrypts the chunks of an object as they are read.
+// Sequential reads continue the request of the underlying object.
+type encryptedObject struct {
+	mu     sync.Mutex
+	object Object
+	aead   cipher.AEAD
+	header []byte
+	info   ObjectInfo
+	// size is the size of the plaintext.
+	size   int64
+	offset int64
+	// next is the index of the chunk the underlying object is positioned
+	// at.
+	next int64
+	// index is the index of the chunk decrypted into chunk.
+	index  int64
+	sealed []byte
+	chunk  []byte
+}
+
+func (o *encryptedObject) load(index int64) error {
+	if o.index == index {
+		return nil
+	}
+
+	start := encryptedHeaderSize + index*sealedChunkSize
+	if o.next != index {
+		_, err := o.object.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	sealed := o.sealed[:min(sealedChunkSize, o.info.Size-start)]
+	_, err := io.ReadFull(o.object, sealed)
+	if err != nil {
+		o.next = -1
+		return err
+	}
+	o.next = index + 1
+
+	last := start+int64(len(sealed)) == o.info.Size
+	chunk, err := o.aead.Open(o.chunk[:0], chunkNonce(index, last), sealed, o.header)
+	if err != nil {
+		o.index = -1
+		return fmt.Errorf("decrypting chunk %d: %w", index, err)
+	}
+
+	o.chunk = chunk
+	o.index = index
+	return nil
+}
+
+func (o *encryptedObject) readAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+
+	index := off / encryptedChunkSize
+	err := o.load(index)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, o.chunk[off-index*encryptedChunkSize:]), nil
+}
+
+func (o *encryptedObject) Read(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n, err := o.readAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *encryptedObject) ReadAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	read := 0
+	for read < len(p) {
+		n, err := o.readAt(p[read:], off+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (o *encryptedObject) Seek(offset int64, whence int) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *encryptedObject) Close() error {
+	return o.object.Close()
+}
+
+func (o *encryptedObject) Stat() (ObjectInfo, error) {
+	info := o.info
+	info.Size = o.size
+	return info, nil
+}
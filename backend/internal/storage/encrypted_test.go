@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"example/internal/database/db"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryDataKeys keeps data keys in memory instead of the data_keys table.
+type memoryDataKeys struct {
+	mu   sync.Mutex
+	keys map[string]db.DataKey
+}
+
+func (m *memoryDataKeys) DataKeyCreate(ctx context.Context, arg db.DataKeyCreateParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[arg.ID] = db.DataKey{ID: arg.ID, OrganisationID: arg.OrganisationID, KekID: arg.KekID, WrappedKey: arg.WrappedKey}
+	return nil
+}
+
+func (m *memoryDataKeys) DataKeyFind(ctx context.Context, id string) (db.DataKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return db.DataKey{}, pgx.ErrNoRows
+	}
+	return key, nil
+}
+
+func (m *memoryDataKeys) DataKeyFindAfter(ctx context.Context, arg db.DataKeyFindAfterParams) ([]db.DataKey, error) {
+	return nil, nil
+}
+
+func (m *memoryDataKeys) DataKeyRewrap(ctx context.Context, arg db.DataKeyRewrapParams) (int64, error) {
+	return 0, nil
+}
+
+// newTestEncrypted returns encrypted storage on top of memory storage, which
+// holds the encrypted objects.
+func newTestEncrypted(t *testing.T) (*Encrypted, *Memory) {
+	memory, err := NewMemory("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := &FileKeyring{current: "test", keys: map[string][]byte{"test": bytes.Repeat([]byte{1}, 32)}}
+	presigner, err := newPresigner("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Encrypted{
+		Storage:   memory,
+		db:        &memoryDataKeys{keys: make(map[string]db.DataKey)},
+		keyring:   keyring,
+		presigner: presigner,
+	}
+	return e, memory
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, encryptedChunkSize + 1, 3 * encryptedChunkSize}
+
+	for _, size := range sizes {
+		e, memory := newTestEncrypted(t)
+		ctx := context.Background()
+		data := pattern(size)
+
+		for _, known := range []bool{true, false} {
+			putSize := int64(size)
+			if !known {
+				putSize = -1
+			}
+
+			info, err := e.Put(ctx, "key", bytes.NewReader(data), putSize, testOptions)
+			if err != nil {
+				t.Fatalf("Put %d bytes: %v", size, err)
+			}
+			if info.Size != int64(size) {
+				t.Fatalf("Put %d bytes: Size = %d", size, info.Size)
+			}
+
+			stored, err := memory.Stat(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Size != sealedSize(int64(size)) {
+				t.Fatalf("stored size of %d bytes = %d, want %d", size, stored.Size, sealedSize(int64(size)))
+			}
+
+			if !bytes.Equal(read(t, e, "key"), data) {
+				t.Fatalf("read %d bytes: wrong data", size)
+			}
+
+			info, err = e.Stat(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(size) {
+				t.Fatalf("Stat of %d bytes: Size = %d", size, info.Size)
+			}
+		}
+	}
+}
+
+func TestEncryptedReadAt(t *testing.T) {
+	e, _ := newTestEncrypted(t)
+	data := pattern(3*encryptedChunkSize + 100)
+	put(t, e, "key", data)
+
+	o, err := e.Open(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	ranges := []struct {
+		off, n int
+	}{
+		{0, 10},
+		{encryptedChunkSize - 10, 20},
+		{encryptedChunkSize, 1},
+		// Spans three chunks
+		{encryptedChunkSize - 1, encryptedChunkSize + 2},
+		{2*encryptedChunkSize - 5, encryptedChunkSize + 105},
+		// Going back to an earlier chunk
+		{5, 5},
+	}
+	for _, r := range ranges {
+		got := make([]byte, r.n)
+		n, err := o.ReadAt(got, int64(r.off))
+		if err != nil || n != r.n {
+			t.Fatalf("ReadAt(%d, %d) = %d, %v", r.off, r.n, n, err)
+		}
+		if !bytes.Equal(got, data[r.off:r.off+r.n]) {
+			t.Fatalf("ReadAt(%d, %d) returned wrong data", r.off, r.n)
+		}
+	}
+
+	// Reading past the end returns what there is
+	got := make([]byte, 200)
+	n, err := o.ReadAt(got, int64(len(data)-100))
+	if err != io.EOF || n != 100 {
+		t.Fatalf("ReadAt past the end = %d, %v, want 100, EOF", n, err)
+	}
+	if !bytes.Equal(got[:n], data[len(data)-100:]) {
+		t.Fatal("ReadAt past the end returned wrong data")
+	}
+}
+
+func TestEncryptedTruncated(t *testing.T) {
+	e, memory := newTestEncrypted(t)
+	ctx := context.Background()
+	put(t, e, "key", pattern(2*encryptedChunkSize))
+
+	// Drop the last chunk, so the first one ends the object
+	stored := read(t, memory, "key")
+	truncated := stored[:encryptedHeaderSize+sealedChunkSize]
+	put(t, memory, "key", truncated)
+
+	o, err := e.Open(ctx, "key")
+	if err != nil {
+		// Rejecting it right away is fine too
+		return
+	}
+	defer o.Close()
+
+	_, err = io.ReadAll(o)
+	if err == nil {
+		t.Fatal("read an object truncated at a chunk boundary")
+	}
+}
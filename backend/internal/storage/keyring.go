@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrUnknownKey is returned for data keys wrapped with a key encryption key
+// the keyring doesn't have (anymore).
+var ErrUnknownKey = errors.New("unknown key encryption key")
+
+// Keyring wraps data keys with the key encryption key (KEK) of their
+// organisation.
+type Keyring interface {
+	// Current returns the ID of the key new data keys of the organisation
+	// are wrapped with. Rotate re-wraps data keys wrapped with another one.
+	Current(ctx context.Context, organisationID string) (string, error)
+	Wrap(ctx context.Context, organisationID string, dataKey []byte) (kekID string, wrapped []byte, err error)
+	Unwrap(ctx context.Context, organisationID string, kekID string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyring holds master keys in a JSON file:
+//
+//	{
+//	  "current": "2024-06",
+//	  "keys": {"2024-06": "<base64 encoded 32 random bytes>"}
+//	}
+//
+// The key encryption key of an organisation is derived from a master key with
+// HKDF, so every organisation has its own key without listing them. To rotate,
+// add a new master key, make it current and run rotate-keys. The old key can
+// be removed once rotate-keys is done.
+type FileKeyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+func LoadKeyring(path string) (*FileKeyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyringFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("parsing keyring: %w", err)
+	}
+
+	k := &FileKeyring{current: file.Current, keys: make(map[string][]byte, len(file.Keys))}
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("keyring: key %q has to be 32 base64 encoded bytes", id)
+		}
+		k.keys[id] = key
+	}
+
+	if _, ok := k.keys[k.current]; !ok {
+		return nil, fmt.Errorf("keyring: current key %q is missing", k.current)
+	}
+	return k, nil
+}
+
+// kek derives the key encryption key of an organisation.
+func (k *FileKeyring) kek(organisationID string, kekID string) (cipher.AEAD, error) {
+	master, ok := k.keys[kekID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("organisation:"+organisationID)), key)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func (k *FileKeyring) Current(ctx context.Context, organisationID string) (string, error) {
+	return k.current, nil
+}
+
+// Wrap seals the data key with AES-256-GCM. The organisation is authenticated
+// too, so a data key can't be moved to another organisation.
+func (k *FileKeyring) Wrap(ctx context.Context, organisationID string, dataKey []byte) (string, []byte, error) {
+	aead, err := k.kek(organisationID, k.current)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.current, aead.Seal(nonce, nonce, dataKey, []byte(organisationID)), nil
+}
+
+func (k *FileKeyring) Unwrap(ctx context.Context, organisationID string, kekID string, wrapped []byte) ([]byte, error) {
+	aead, err := k.kek(organisationID, kekID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(organisationID))
+}
+
+// KMS is the part of a key management service (e.g. AWS KMS or the transit
+// engine of Vault) used to wrap data keys. Decrypt gets the same encryption
+// context Encrypt got.
+type KMS interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]string) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]string) ([]byte, error)
+}
+
+// KMSKeyring wraps data keys with a key of a KMS per organisation. The key
+// material never leaves the KMS. Keys rotated within the KMS keep their ID,
+// so only changing the key of an organisation makes Rotate re-wrap its data
+// keys.
+type KMSKeyring struct {
+	KMS KMS
+	// KeyID returns the key of an organisation, e.g.
+	// "alias/drive-<organisation id>".
+	KeyID func(organisationID string) string
+}
+
+func (k *KMSKeyring) Current(ctx context.Context, organisationID string) (string, error) {
+	return k.KeyID(organisationID), nil
+}
+
+func (k *KMSKeyring) Wrap(ctx context.Context, organisationID string, dataKey []byte) (string, []byte, error) {
+	keyID := k.KeyID(organisationID)
+	wrapped, err := k.KMS.Encrypt(ctx, keyID, dataKey, map[string]string{"organisation_id": organisationID})
+	return keyID, wrapped, err
+}
+
+func (k *KMSKeyring) Unwrap(ctx context.Context, organisationID string, kekID string, wrapped []byte) ([]byte, error) {
+	return k.KMS.Decrypt(ctx, kekID, wrapped, map[string]string{"organisation_id": organisationID})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
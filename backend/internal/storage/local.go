@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Local stores objects as files below a directory. Objects are spread over
+// two levels of directories by the hash of their key and written to a
+// temporary file first, which is renamed once it is complete.
+type Local struct {
+	root      string
+	presigner *presigner
+}
+
+// NewLocal creates the driver for the directory root. Presigned URLs point to
+// Handler under baseURL and are signed with secret.
+func NewLocal(root string, baseURL string, secret string) (*Local, error) {
+	if root == "" {
+		root = "data"
+	}
+
+	presigner, err := newPresigner(baseURL, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{"objects", "tmp"} {
+		err = os.MkdirAll(filepath.Join(root, dir), 0o750)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Local{root: root, presigner: presigner}, nil
+}
+
+// path returns the file of an object. Keys are escaped, so they can't
+// contain separators.
+func (l *Local) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	shard := hex.EncodeToString(hash[:2])
+	return filepath.Join(l.root, "objects", shard[:2], shard[2:], url.PathEscape(key))
+}
+
+func localInfo(key string, fi fs.FileInfo) ObjectInfo {
+	// Files have no checksum, the ETag changes with every write instead
+	etag := md5.Sum([]byte(fmt.Sprintf("%d-%d", fi.Size(), fi.ModTime().UnixNano())))
+	return ObjectInfo{Key: key, Size: fi.Size(), ETag: hex.EncodeToString(etag[:]), LastModified: fi.ModTime()}
+}
+
+// write calls fn with a temporary file and renames it to the object
+// afterwards.
+func (l *Local) write(key string, fn func(f *os.File) error) (ObjectInfo, error) {
+	f, err := os.CreateTemp(filepath.Join(l.root, "tmp"), "object-")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = fn(f)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return l.rename(key, f.Name())
+}
+
+func (l *Local) rename(key string, tmp string) (ObjectInfo, error) {
+	path := l.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return localInfo(key, fi), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	return l.write(key, func(f *os.File) error {
+		n, err := io.Copy(f, r)
+		if err != nil {
+			return err
+		}
+		if size >= 0 && n != size {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+}
+
+func (l *Local) Open(ctx context.Context, key string) (Object, error) {
+	f, err := os.Open(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &localObject{File: f, key: key}, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	fi, err := os.Stat(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return localInfo(key, fi), nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	err := os.Remove(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Copy hard links the object if possible, the contents of objects are never
+// changed in place.
+func (l *Local) Copy(ctx context.Context, dst string, src string) (ObjectInfo, error) {
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	tmp := filepath.Join(l.root, "tmp", "link-"+hex.EncodeToString(suffix))
+	err = os.Link(l.path(src), tmp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotExist
+	}
+	if err != nil {
+		return l.Compose(ctx, dst, []string{src}, PutOptions{})
+	}
+	defer os.Remove(tmp)
+
+	return l.rename(dst, tmp)
+}
+
+func (l *Local) Compose(ctx context.Context, dst string, srcs []string, opts PutOptions) (ObjectInfo, error) {
+	return l.write(dst, func(f *os.File) error {
+		for _, src := range srcs {
+			err := l.append(f, src)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (l *Local) append(w io.Writer, key string) error {
+	src, err := os.Open(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// List walks all objects, as they are spread by the hash of their key.
+func (l *Local) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(filepath.Join(l.root, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+
+		key, err := url.PathUnescape(d.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted in the meantime
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, localInfo(key, fi))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	for _, info := range objects {
+		err = fn(info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return l.presigner.sign(key, expiry)
+}
+
+func (l *Local) signer() *presigner {
+	return l.presigner
+}
+
+type localObject struct {
+	*os.File
+	key string
+}
+
+func (o *localObject) Stat() (ObjectInfo, error) {
+	fi, err := o.File.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return localInfo(o.key, fi), nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps objects in memory, for development and tests. All objects
+// are lost when the process exits.
+type Memory struct {
+	mu        sync.RWMutex
+	objects   map[string]memoryObject
+	presigner *presigner
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// NewMemory creates an empty driver. Presigned URLs point to Handler under
+// baseURL and are signed with secret.
+func NewMemory(baseURL string, secret string) (*Memory, error) {
+	presigner, err := newPresigner(baseURL, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{objects: make(map[string]memoryObject), presigner: presigner}, nil
+}
+
+func (m *Memory) store(key string, data []byte) ObjectInfo {
+	sum := md5.Sum(data)
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{data: data, info: info}
+	return info
+}
+
+func (m *Memory) get(key string) (memoryObject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	if !ok {
+		return memoryObject{}, ErrNotExist
+	}
+	return object, nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return ObjectInfo{}, io.ErrUnexpectedEOF
+	}
+
+	return m.store(key, data), nil
+}
+
+func (m *Memory) Open(ctx context.Context, key string) (Object, error) {
+	object, err := m.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryReader{Reader: bytes.NewReader(object.data), info: object.info}, nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	object, err := m.get(key)
+	return object.info, err
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
+
+// Copy shares the data, which is never modified.
+func (m *Memory) Copy(ctx context.Context, dst string, src string) (ObjectInfo, error) {
+	object, err := m.get(src)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return m.store(dst, object.data), nil
+}
+
+func (m *Memory) Compose(ctx context.Context, dst string, srcs []string, opts PutOptions) (ObjectInfo, error) {
+	var data []byte
+	for _, src := range srcs {
+		object, err := m.get(src)
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		data = append(data, object.data...)
+	}
+	return m.store(dst, data), nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	m.mu.RLock()
+	objects := make([]ObjectInfo, 0)
+	for key, object := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.info)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	for _, info := range objects {
+		err := fn(info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return m.presigner.sign(key, expiry)
+}
+
+func (m *Memory) signer() *presigner {
+	return m.presigner
+}
+
+type memoryReader struct {
+	*bytes.Reader
+	info ObjectInfo
+}
+
+func (r *memoryReader) Close() error {
+	return nil
+}
+
+func (r *memoryReader) Stat() (ObjectInfo, error) {
+	return r.info, nil
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// uploadPartSize is used for uploads of unknown size, otherwise minio-go
+// buffers parts of several hundred megabytes.
+const uploadPartSize = 16 << 20
+
+// MinIO stores objects in a bucket of MinIO or another S3 compatible service.
+type MinIO struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewMinIO(client *minio.Client, bucket string) *MinIO {
+	return &MinIO{client: client, bucket: bucket}
+}
+
+// minioError translates missing objects to ErrNotExist.
+func minioError(err error) error {
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotExist
+	}
+	return err
+}
+
+func minioInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{Key: info.Key, Size: info.Size, ETag: info.ETag, LastModified: info.LastModified}
+}
+
+func (m *MinIO) Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	putOpts := minio.PutObjectOptions{ContentType: opts.ContentType}
+	if size < 0 {
+		putOpts.PartSize = uploadPartSize
+	}
+
+	info, err := m.client.PutObject(ctx, m.bucket, key, r, size, putOpts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{Key: key, Size: info.Size, ETag: info.ETag, LastModified: info.LastModified}, nil
+}
+
+func (m *MinIO) Open(ctx context.Context, key string) (Object, error) {
+	object, err := m.client.GetObject(ctx, m.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minioError(err)
+	}
+	return &minioObject{object: object}, nil
+}
+
+func (m *MinIO) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return minioInfo(info), nil
+}
+
+func (m *MinIO) Delete(ctx context.Context, key string) error {
+	return m.client.RemoveObject(ctx, m.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Copy uses ComposeObject, which unlike CopyObject also copies objects larger
+// than 5 GiB.
+func (m *MinIO) Copy(ctx context.Context, dst string, src string) (ObjectInfo, error) {
+	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket: m.bucket,
+		Object: dst,
+	}, minio.CopySrcOptions{
+		Bucket: m.bucket,
+		Object: src,
+	})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+
+	// Copies of a single object report no size
+	return m.Stat(ctx, dst)
+}
+
+// Compose is done by MinIO, without downloading the sources. All sources but
+// the last have to be at least 5 MiB.
+func (m *MinIO) Compose(ctx context.Context, dst string, srcs []string, opts PutOptions) (ObjectInfo, error) {
+	sources := make([]minio.CopySrcOptions, 0, len(srcs))
+	for _, src := range srcs {
+		sources = append(sources, minio.CopySrcOptions{Bucket: m.bucket, Object: src})
+	}
+
+	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:          m.bucket,
+		Object:          dst,
+		UserMetadata:    map[string]string{"Content-Type": opts.ContentType},
+		ReplaceMetadata: true,
+	}, sources...)
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+
+	// A single source is copied, which reports no size
+	return m.Stat(ctx, dst)
+}
+
+func (m *MinIO) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Cancelling stops the listing goroutine of minio-go if fn fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for info := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return info.Err
+		}
+
+		err := fn(minioInfo(info))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MinIO) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return m.client.PresignedGetObject(ctx, m.bucket, key, expiry, nil)
+}
+
+// minioObject fetches the object on the first read.
+type minioObject struct {
+	object *minio.Object
+}
+
+func (o *minioObject) Read(p []byte) (int, error) {
+	n, err := o.object.Read(p)
+	return n, minioError(err)
+}
+
+func (o *minioObject) ReadAt(p []byte, off int64) (int, error) {
+	n, err := o.object.ReadAt(p, off)
+	return n, minioError(err)
+}
+
+func (o *minioObject) Seek(offset int64, whence int) (int64, error) {
+	n, err := o.object.Seek(offset, whence)
+	return n, minioError(err)
+}
+
+func (o *minioObject) Close() error {
+	return o.object.Close()
+}
+
+func (o *minioObject) Stat() (ObjectInfo, error) {
+	info, err := o.object.Stat()
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return minioInfo(info), nil
+}
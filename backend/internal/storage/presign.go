@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// presigner signs download URLs for drivers without URLs of their own. They
+// are served by Handler.
+type presigner struct {
+	url    string
+	secret []byte
+}
+
+func newPresigner(baseURL string, secret string) (*presigner, error) {
+	p := &presigner{url: baseURL + "/storage", secret: []byte(secret)}
+	if secret == "" {
+		// Only for tests, New requires a secret since other replicas
+		// couldn't verify the URLs
+		p.secret = make([]byte, 32)
+		_, err := rand.Read(p.secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *presigner) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *presigner) sign(key string, expiry time.Duration) (*url.URL, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(expiry).Unix()
+	u.RawQuery = url.Values{
+		"key":       {key},
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {p.signature(key, expires)},
+	}.Encode()
+	return u, nil
+}
+
+func (p *presigner) verify(query url.Values) (string, bool) {
+	key := query.Get("key")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	signature := p.signature(key, expires)
+	return key, hmac.Equal([]byte(signature), []byte(query.Get("signature")))
+}
+
+// signed are the drivers whose presigned URLs point to Handler.
+type signed interface {
+	Storage
+	signer() *presigner
+}
+
+// Handler serves the presigned URLs of the local and memory drivers and of
+// encrypted objects. It has to be mounted at /storage of Config.URL. MinIO
+// serves its URLs itself, for it Handler responds with 404.
+func Handler(s Storage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store, ok := s.(signed)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		key, ok := store.signer().verify(r.URL.Query())
+		if !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		object, err := store.Open(r.Context(), key)
+		if errors.Is(err, ErrNotExist) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error opening object", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer object.Close()
+
+		info, err := object.Stat()
+		if err != nil {
+			slog.Error("error opening object", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+		http.ServeContent(w, r, "", info.LastModified, object)
+	})
+}
@@ -0,0 +1,149 @@
+// Package storage abstracts the object store holding file contents. Drivers
+// exist for MinIO (or any S3 compatible service), the local file system and
+// memory.
+package storage
+
+import (
+	"context"
+	"errors"
+	"example/internal/database"
+	"example/internal/services/minio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrNotExist is returned for objects that don't exist.
+var ErrNotExist = errors.New("object does not exist")
+
+// ObjectInfo is the metadata of an object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// Object is an opened object. Ranges are read with Seek or ReadAt.
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	// Stat returns the metadata of the object or ErrNotExist.
+	Stat() (ObjectInfo, error)
+}
+
+type PutOptions struct {
+	ContentType string
+	// OrganisationID is the owner of the object, whose key encryption key
+	// wraps its data key if encryption is enabled.
+	OrganisationID string
+}
+
+type Storage interface {
+	// Put stores the contents of r as key, replacing an existing object.
+	// size may be -1 if it is unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) (ObjectInfo, error)
+	// Open returns the object for reading. Drivers may fetch the object
+	// lazily, so ErrNotExist can also be returned by the first read.
+	Open(ctx context.Context, key string) (Object, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object. Deleting a missing object is no error.
+	Delete(ctx context.Context, key string) error
+	// Copy copies the object src to dst.
+	Copy(ctx context.Context, dst string, src string) (ObjectInfo, error)
+	// Compose stores the concatenation of srcs as dst. Multipart uploads
+	// are stored as separate objects and composed once they are complete.
+	Compose(ctx context.Context, dst string, srcs []string, opts PutOptions) (ObjectInfo, error)
+	// List calls fn for every object whose key starts with prefix, ordered
+	// by key. An error returned by fn stops the listing.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// PresignGet returns a URL to download the object without further
+	// authentication until expiry has passed.
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+}
+
+const (
+	DriverMinIO  = "minio"
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// Config selects and configures the driver.
+type Config struct {
+	// Driver is one of DriverMinIO (the default), DriverLocal or
+	// DriverMemory.
+	Driver string
+	MinIO  minio.Config
+	Bucket string
+	// Path is the directory of the local driver.
+	Path string
+	// URL is the public address of the app. The local and memory drivers
+	// have no URLs of their own, their presigned URLs point to Handler
+	// under URL.
+	URL string
+	// Secret signs the presigned URLs of the local and memory drivers, and of
+	// all drivers with encryption. It is the same on all replicas, so that
+	// any of them accepts the URLs.
+	Secret string
+	// Keyring is the path of a FileKeyring. If it is set, objects are
+	// encrypted and presigned URLs point to Handler for all drivers.
+	Keyring string
+}
+
+// ConfigFromEnv reads the configuration from STORAGE_* and MINIO_* variables.
+func ConfigFromEnv() Config {
+	return Config{
+		Driver: os.Getenv("STORAGE_DRIVER"),
+		MinIO: minio.Config{
+			Host:      os.Getenv("MINIO_HOST"),
+			Port:      os.Getenv("MINIO_PORT"),
+			AccessKey: os.Getenv("MINIO_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("MINIO_SECRET_ACCESS_KEY"),
+			SSL:       os.Getenv("MINIO_SSL") == "true",
+		},
+		Bucket:  os.Getenv("MINIO_BUCKET"),
+		Path:    os.Getenv("STORAGE_PATH"),
+		URL:     os.Getenv("STORAGE_URL"),
+		Secret:  os.Getenv("STORAGE_SECRET"),
+		Keyring: os.Getenv("STORAGE_KEYRING"),
+	}
+}
+
+// New creates the driver selected by the configuration. db stores the data
+// keys if encryption is enabled.
+func New(cfg Config, db *database.DB) (Storage, error) {
+	presigned := cfg.Driver == DriverLocal || cfg.Driver == DriverMemory || cfg.Keyring != ""
+	if presigned && cfg.Secret == "" {
+		return nil, errors.New("STORAGE_SECRET is required to sign the URLs of the storage driver")
+	}
+
+	s, err := newDriver(cfg)
+	if err != nil || cfg.Keyring == "" {
+		return s, err
+	}
+
+	keyring, err := LoadKeyring(cfg.Keyring)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncrypted(s, db, keyring, cfg.URL, cfg.Secret)
+}
+
+func newDriver(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case DriverMinIO, "":
+		client, err := minio.New(cfg.MinIO)
+		if err != nil {
+			return nil, err
+		}
+		return NewMinIO(client, cfg.Bucket), nil
+	case DriverLocal:
+		return NewLocal(cfg.Path, cfg.URL, cfg.Secret)
+	case DriverMemory:
+		return NewMemory(cfg.URL, cfg.Secret)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
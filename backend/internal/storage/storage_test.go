@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		s, err := NewMemory("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestLocal(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		s, err := NewLocal(t.TempDir(), "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+// testStorage checks that a driver behaves as described by Storage. Every
+// subtest gets a new, empty driver from newStorage.
+func testStorage(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Run("PutSizeMismatch", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		for _, size := range []int64{3, 10} {
+			_, err := s.Put(ctx, "key", strings.NewReader("hello"), size, PutOptions{})
+			if err == nil {
+				t.Fatalf("Put with size %d of 5 bytes succeeded", size)
+			}
+			_, err = s.Stat(ctx, "key")
+			if !errors.Is(err, ErrNotExist) {
+				t.Fatalf("Stat after failed Put = %v, want ErrNotExist", err)
+			}
+		}
+
+		info, err := s.Put(ctx, "key", strings.NewReader("hello"), -1, PutOptions{})
+		if err != nil {
+			t.Fatalf("Put with unknown size: %v", err)
+		}
+		if info.Size != 5 {
+			t.Fatalf("Size = %d, want 5", info.Size)
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+		data := pattern(1000)
+		put(t, s, "key", data)
+
+		o, err := s.Open(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer o.Close()
+
+		info, err := o.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != int64(len(data)) {
+			t.Fatalf("Size = %d, want %d", info.Size, len(data))
+		}
+
+		pos, err := o.Seek(100, io.SeekStart)
+		if err != nil || pos != 100 {
+			t.Fatalf("Seek = %d, %v, want 100", pos, err)
+		}
+		got := make([]byte, 50)
+		_, err = io.ReadFull(o, got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data[100:150]) {
+			t.Fatal("read after Seek from the start returned wrong data")
+		}
+
+		pos, err = o.Seek(-10, io.SeekEnd)
+		if err != nil || pos != 990 {
+			t.Fatalf("Seek = %d, %v, want 990", pos, err)
+		}
+		got, err = io.ReadAll(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data[990:]) {
+			t.Fatal("read after Seek from the end returned wrong data")
+		}
+
+		got = make([]byte, 20)
+		_, err = o.ReadAt(got, 500)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data[500:520]) {
+			t.Fatal("ReadAt returned wrong data")
+		}
+	})
+
+	t.Run("OpenMissing", func(t *testing.T) {
+		s := newStorage(t)
+
+		// Drivers may only notice on the first read
+		o, err := s.Open(context.Background(), "missing")
+		if err == nil {
+			defer o.Close()
+			_, err = o.Read(make([]byte, 1))
+		}
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatalf("err = %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("Compose", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+		parts := [][]byte{pattern(10), pattern(0), pattern(1000)}
+		put(t, s, "part/1", parts[0])
+		put(t, s, "part/2", parts[1])
+		put(t, s, "part/3", parts[2])
+
+		info, err := s.Compose(ctx, "dst", []string{"part/1", "part/2", "part/3"}, PutOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := bytes.Join(parts, nil)
+		if info.Size != int64(len(want)) {
+			t.Fatalf("Size = %d, want %d", info.Size, len(want))
+		}
+		if !bytes.Equal(read(t, s, "dst"), want) {
+			t.Fatal("composed object has wrong data")
+		}
+
+		_, err = s.Compose(ctx, "dst", []string{"part/1", "missing"}, PutOptions{})
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatalf("Compose with missing part = %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+		data := pattern(100)
+		put(t, s, "src", data)
+
+		info, err := s.Copy(ctx, "dst", "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Key != "dst" || info.Size != int64(len(data)) {
+			t.Fatalf("info = %+v, want key dst and size %d", info, len(data))
+		}
+
+		// The copy is independent of its source
+		put(t, s, "src", []byte("changed"))
+		if !bytes.Equal(read(t, s, "dst"), data) {
+			t.Fatal("copy has wrong data")
+		}
+
+		_, err = s.Copy(ctx, "dst", "missing")
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatalf("Copy of missing object = %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+		for _, key := range []string{"p/b", "q/a", "p/c/1", "p/a", "p/aa", "p"} {
+			put(t, s, key, []byte(key))
+		}
+
+		var keys []string
+		err := s.List(ctx, "p/", func(info ObjectInfo) error {
+			if info.Size != int64(len(info.Key)) {
+				t.Errorf("Size of %s = %d, want %d", info.Key, info.Size, len(info.Key))
+			}
+			keys = append(keys, info.Key)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"p/a", "p/aa", "p/b", "p/c/1"}
+		if !slices.Equal(keys, want) {
+			t.Fatalf("keys = %v, want %v", keys, want)
+		}
+
+		stop := errors.New("stop")
+		keys = nil
+		err = s.List(ctx, "p/", func(info ObjectInfo) error {
+			keys = append(keys, info.Key)
+			return stop
+		})
+		if !errors.Is(err, stop) || len(keys) != 1 {
+			t.Fatalf("List = %v after %v, want stop after one key", err, keys)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+		put(t, s, "key", []byte("data"))
+
+		for range 2 {
+			err := s.Delete(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := s.Stat(ctx, "key")
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatalf("Stat after Delete = %v, want ErrNotExist", err)
+		}
+	})
+}
+
+// pattern returns n bytes in which a read at the wrong offset shows.
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// testOptions are the options of test objects. Only encrypted storage needs
+// an organisation.
+var testOptions = PutOptions{OrganisationID: "org"}
+
+func put(t *testing.T, s Storage, key string, data []byte) {
+	t.Helper()
+
+	_, err := s.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), testOptions)
+	if err != nil {
+		t.Fatalf("Put %s: %v", key, err)
+	}
+}
+
+func read(t *testing.T, s Storage, key string) []byte {
+	t.Helper()
+
+	o, err := s.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open %s: %v", key, err)
+	}
+	defer o.Close()
+
+	data, err := io.ReadAll(o)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return data
+}
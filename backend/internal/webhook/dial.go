@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// insecure allows webhooks with http URLs and on private networks, e.g. a
+// receiver on localhost during development. Otherwise admins could make the
+// server send requests to internal services and read their responses in the
+// delivery log.
+var insecure = os.Getenv("WEBHOOK_INSECURE") == "true"
+
+// ErrForbiddenAddress is returned when a webhook resolves to an address on a
+// private network.
+var ErrForbiddenAddress = errors.New("webhook address not allowed")
+
+// reserved are ranges that aren't reachable on the internet and aren't
+// covered by the methods of netip.Addr.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether webhooks may be sent to the address.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidURL reports whether events can be sent to the URL. The host is checked
+// again for every connection, since a name may resolve to another address
+// later.
+func ValidURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" || u.User != nil {
+		return false
+	}
+	if insecure {
+		return u.Scheme == "https" || u.Scheme == "http"
+	}
+	if u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return false
+	}
+	return true
+}
+
+// control rejects connections to addresses on private networks, after the
+// host was resolved.
+func control(network, address string, _ syscall.RawConn) error {
+	if insecure {
+		return nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !publicAddr(addrPort.Addr()) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: requestTimeout,
+		Control: control,
+	}
+}
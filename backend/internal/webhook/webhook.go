@@ -0,0 +1,452 @@
+// Package webhook sends events of an organisation to the endpoints its admins
+// registered. Events are queued in webhook_deliveries, in the transaction of
+// the change where there is one, and sent by Send. Failed deliveries are
+// retried with exponential backoff, endpoints that keep failing are disabled.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example/internal/database"
+	"example/internal/database/db"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// Types of events webhooks subscribe to. Only types that are enqueued are
+// listed, share.created follows once files can be shared.
+const (
+	EventFileCreated = "file.created"
+	EventFileDeleted = "file.deleted"
+	EventUserInvited = "user.invited"
+)
+
+var EventTypes = []string{EventFileCreated, EventFileDeleted, EventUserInvited}
+
+const (
+	// SignatureHeader carries "t=<unix time>,v1=<signature>" of a delivery,
+	// see Sign.
+	SignatureHeader = "X-Dokedu-Signature"
+	EventHeader     = "X-Dokedu-Event"
+	DeliveryHeader  = "X-Dokedu-Delivery"
+
+	// MaxAttempts is the number of attempts of a delivery before it fails.
+	MaxAttempts = 8
+	// DisableAfter is the number of failed attempts in a row, of any
+	// deliveries, after which a webhook is disabled.
+	DisableAfter = 20
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+
+	// retryDelay is the wait before the second attempt, it doubles with every
+	// attempt up to maxRetryDelay.
+	retryDelay    = 30 * time.Second
+	maxRetryDelay = 6 * time.Hour
+	// requestTimeout limits an attempt, lease the time a sender has for a
+	// batch before other senders may take its deliveries.
+	requestTimeout      = 10 * time.Second
+	tlsHandshakeTimeout = 5 * time.Second
+	batchSize           = 10
+	lease               = 5 * time.Minute
+	// maxResponseBody is the length of the response body kept in the log.
+	maxResponseBody = 1024
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrDisabled is returned when replaying a delivery of a disabled
+	// webhook.
+	ErrDisabled = errors.New("webhook disabled")
+)
+
+// Event is the body of a delivery. The ID is the same for all deliveries of
+// the event, including replays.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type File struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	MimeType    string  `json:"mime_type"`
+	FileSize    int64   `json:"file_size"`
+	ParentID    *string `json:"parent_id"`
+	IsFolder    bool    `json:"is_folder"`
+	SharedDrive bool    `json:"shared_drive"`
+	OwnerID     *string `json:"owner_id"`
+}
+
+type User struct {
+	ID        string      `json:"id"`
+	Email     string      `json:"email"`
+	FirstName string      `json:"first_name"`
+	LastName  string      `json:"last_name"`
+	Role      db.UserRole `json:"role"`
+}
+
+// FileData is the data of file.created and file.deleted events. ActorID is
+// the user who made the change.
+type FileData struct {
+	File    File   `json:"file"`
+	ActorID string `json:"actor_id"`
+}
+
+// UserData is the data of user.invited events.
+type UserData struct {
+	User User `json:"user"`
+}
+
+func text(t pgtype.Text) *string {
+	if !t.Valid {
+		return nil
+	}
+	return &t.String
+}
+
+func NewFileData(file db.File, actor *db.User) FileData {
+	return FileData{
+		File: File{
+			ID:          file.ID,
+			Name:        file.Name,
+			MimeType:    file.MimeType,
+			FileSize:    file.FileSize,
+			ParentID:    text(file.ParentID),
+			IsFolder:    file.IsFolder,
+			SharedDrive: file.SharedDrive,
+			OwnerID:     text(file.OwnerID),
+		},
+		ActorID: actor.ID,
+	}
+}
+
+func NewUserData(user db.User) UserData {
+	return UserData{User: User{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+	}}
+}
+
+// ValidEventTypes reports whether webhooks can subscribe to all the types.
+func ValidEventTypes(types []string) bool {
+	if len(types) == 0 {
+		return false
+	}
+	for _, t := range types {
+		if !slices.Contains(EventTypes, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSecret returns a random secret to sign deliveries with.
+func NewSecret() string {
+	return "whsec_" + gonanoid.Must(32)
+}
+
+// Sign returns the value of SignatureHeader of a payload sent at t. The
+// signature is the hex encoded HMAC-SHA256 of "<unix time>.<payload>" with
+// the secret of the webhook. Receivers should reject old timestamps to
+// prevent replay attacks.
+func Sign(secret string, t time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue queues an event for the webhooks of the organisation subscribed to
+// its type. Called with the transaction of a change, the event is only sent
+// if the change is committed.
+func Enqueue(ctx context.Context, q *db.Queries, organisationID string, eventType string, data any) error {
+	id := gonanoid.Must()
+	payload, err := json.Marshal(Event{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return q.WebhookDeliveryEnqueue(ctx, db.WebhookDeliveryEnqueueParams{
+		EventID:        id,
+		EventType:      eventType,
+		Payload:        payload,
+		OrganisationID: organisationID,
+	})
+}
+
+type Service struct {
+	DB     *database.DB
+	Client *http.Client
+}
+
+func New(db *database.DB) *Service {
+	return &Service{
+		DB: db,
+		Client: &http.Client{
+			Timeout: requestTimeout,
+			// Without a proxy, which would connect to private addresses
+			// on behalf of the server
+			Transport: &http.Transport{
+				DialContext:         newDialer().DialContext,
+				TLSHandshakeTimeout: tlsHandshakeTimeout,
+			},
+			// A redirect is a failed delivery, the signature is only meant
+			// for the registered URL
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// backoff returns the wait before the next attempt after the given number of
+// attempts.
+func backoff(attempts int32) time.Duration {
+	delay := retryDelay
+	for i := int32(1); i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// Send sends the due deliveries and returns how many there were. Several
+// senders, e.g. on other replicas, take different deliveries.
+func (s *Service) Send(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		deliveries, err := s.DB.WebhookDeliveryClaim(ctx, db.WebhookDeliveryClaimParams{
+			Lease:     pgtype.Interval{Microseconds: lease.Microseconds(), Valid: true},
+			BatchSize: batchSize,
+		})
+		if err != nil {
+			return sent, err
+		}
+
+		for _, delivery := range deliveries {
+			err = s.deliver(ctx, delivery)
+			if err != nil {
+				return sent, err
+			}
+			sent++
+		}
+
+		if len(deliveries) < batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// deliver makes an attempt to send a delivery and records the result.
+func (s *Service) deliver(ctx context.Context, delivery db.WebhookDelivery) error {
+	hook, err := s.DB.WebhookFindByID(ctx, db.WebhookFindByIDParams{
+		ID:             delivery.WebhookID,
+		OrganisationID: delivery.OrganisationID,
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return s.finish(ctx, delivery, db.WebhookDeliveryStatusFailed, nil, "", "webhook deleted")
+	case err != nil:
+		return err
+	case hook.DisabledAt.Valid:
+		return s.finish(ctx, delivery, db.WebhookDeliveryStatusFailed, nil, "", "webhook disabled")
+	}
+
+	status, body, err := s.post(ctx, hook, delivery)
+	if err == nil && status >= 200 && status < 300 {
+		err = s.finish(ctx, delivery, db.WebhookDeliveryStatusSucceeded, &status, body, "")
+		if err != nil {
+			return err
+		}
+		return s.DB.WebhookRecordSuccess(ctx, hook.ID)
+	}
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	} else {
+		message = fmt.Sprintf("unexpected status %d", status)
+	}
+
+	result := db.WebhookDeliveryStatusPending
+	if delivery.Attempts+1 >= MaxAttempts {
+		result = db.WebhookDeliveryStatusFailed
+	}
+
+	var response *int
+	if err == nil {
+		response = &status
+	}
+	err = s.finish(ctx, delivery, result, response, body, message)
+	if err != nil {
+		return err
+	}
+
+	hook, err = s.DB.WebhookRecordFailure(ctx, db.WebhookRecordFailureParams{
+		DisableAfter: DisableAfter,
+		ID:           hook.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if !hook.DisabledAt.Valid {
+		return nil
+	}
+
+	slog.Warn("disabled failing webhook", "webhook", hook.ID, "organisation", hook.OrganisationID)
+	return s.DB.WebhookDeliveryFailPending(ctx, db.WebhookDeliveryFailPendingParams{
+		Error:     "webhook disabled after repeated failures",
+		WebhookID: hook.ID,
+	})
+}
+
+// post sends the payload of a delivery and returns the status and the start
+// of the body of the response.
+func (s *Service) post(ctx context.Context, hook db.Webhook, delivery db.WebhookDelivery) (int, string, error) {
+	// The URL may have been registered before it was checked
+	if !ValidURL(hook.Url) {
+		return 0, "", ErrForbiddenAddress
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Dokedu-Webhook")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, time.Now(), delivery.Payload))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, string(bytes.ToValidUTF8(body, nil)), nil
+}
+
+func (s *Service) finish(ctx context.Context, delivery db.WebhookDelivery, status db.WebhookDeliveryStatus, response *int, body string, message string) error {
+	params := db.WebhookDeliveryFinishParams{
+		Status:        status,
+		NextAttemptAt: time.Now(),
+		ResponseBody:  body,
+		Error:         message,
+		ID:            delivery.ID,
+	}
+	if status == db.WebhookDeliveryStatusPending {
+		params.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts + 1))
+	}
+	if response != nil {
+		params.ResponseStatus = pgtype.Int4{Int32: int32(*response), Valid: true}
+	}
+
+	return s.DB.WebhookDeliveryFinish(ctx, params)
+}
+
+// Replay queues the event of a delivery again, as a new delivery.
+func (s *Service) Replay(ctx context.Context, hook db.Webhook, deliveryID string) (db.WebhookDelivery, error) {
+	if hook.DisabledAt.Valid {
+		return db.WebhookDelivery{}, ErrDisabled
+	}
+
+	return s.DB.WebhookDeliveryReplay(ctx, db.WebhookDeliveryReplayParams{
+		ID:             deliveryID,
+		WebhookID:      hook.ID,
+		OrganisationID: hook.OrganisationID,
+	})
+}
+
+// cursor is the position after the last delivery of a page.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+}
+
+func (c cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Deliveries returns a page of the deliveries of a webhook, the latest first,
+// and the cursor of the next page, which is empty on the last page.
+func (s *Service) Deliveries(ctx context.Context, hook db.Webhook, limit int, after string) ([]db.WebhookDelivery, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	query := s.DB.NewQueryBuilder().
+		Select("*").
+		From("webhook_deliveries").
+		Where(squirrel.Eq{"webhook_id": hook.ID, "organisation_id": hook.OrganisationID}).
+		OrderBy("created_at DESC", "id DESC")
+
+	if after != "" {
+		c, err := parseCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", c.CreatedAt, c.ID)
+	}
+
+	// One more row than fits tells if there is another page
+	deliveries, err := database.ScanSelectMany[db.WebhookDelivery](s.DB, ctx, query.Limit(uint64(limit+1)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(deliveries) <= limit {
+		return deliveries, "", nil
+	}
+
+	last := deliveries[limit-1]
+	return deliveries[:limit], cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String(), nil
+}